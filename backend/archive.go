@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// How an admin delete treats the documents that depend on the one deleted
+const (
+	deleteRestrict = "restrict" // refuse while anything depends on it (default)
+	deleteCascade  = "cascade"  // archive, detach or refund the dependents too
+)
+
+// Documents in one collection that a delete affects, and what cascade does to them
+type Dependency struct {
+	Collection string   `json:"collection"`
+	Effect     string   `json:"effect"`
+	IDs        []string `json:"ids"`
+}
+
+// Outcome of an admin delete, or with dryRun what it would do. Blockers are
+// reasons no mode can delete yet, such as a match being played.
+type DeleteResult struct {
+	Collection   string       `json:"collection"`
+	ID           string       `json:"id"`
+	Mode         string       `json:"mode"`
+	DryRun       bool         `json:"dryRun"`
+	Archived     bool         `json:"archived"`
+	Dependencies []Dependency `json:"dependencies"`
+	Blockers     []string     `json:"blockers"`
+	Refunds      int          `json:"refunds"`
+	RefundTotal  int          `json:"refundTotal"`
+}
+
+type planWrite struct {
+	ref     *firestore.DocumentRef
+	data    interface{}        // set the document to this
+	updates []firestore.Update // or apply these updates
+}
+
+// Everything a soft delete touches, gathered before anything is written so a
+// dry run and a restricted delete can report it
+type archivePlan struct {
+	s       *Server
+	now     time.Time
+	result  DeleteResult
+	deps    map[string]int  // collection and effect -> index into result.Dependencies
+	planned map[string]bool // document paths already in the plan
+	writes  []planWrite
+
+	edit     SquadEdit      // ?override and ?reason for squads past their lock
+	removals []squadRemoval // squad writes, each made in its own transaction
+}
+
+// A player taken out of a match's squad
+type squadRemoval struct {
+	matchID, playerID string
+}
+
+// Read mode and dryRun from the request for a delete of collection/id
+func (s *Server) newArchivePlan(r *http.Request, collection, id string) (*archivePlan, error) {
+	params := r.URL.Query()
+	mode := params.Get("mode")
+	if mode == "" {
+		mode = deleteRestrict
+	}
+	if mode != deleteRestrict && mode != deleteCascade {
+		return nil, errorf(ErrInvalidRequest, "mode must be %s or %s", deleteRestrict, deleteCascade)
+	}
+	dryRun := false
+	if raw := params.Get("dryRun"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			return nil, errorf(ErrInvalidRequest, "dryRun must be true or false")
+		}
+	}
+	edit, err := squadEditFrom(r, models.SquadSourceArchive)
+	if err != nil {
+		return nil, err
+	}
+	return &archivePlan{
+		s:    s,
+		now:  time.Now().UTC(),
+		edit: edit,
+		result: DeleteResult{
+			Collection:   collection,
+			ID:           id,
+			Mode:         mode,
+			DryRun:       dryRun,
+			Dependencies: []Dependency{},
+			Blockers:     []string{},
+		},
+		deps:    map[string]int{},
+		planned: map[string]bool{},
+	}, nil
+}
+
+func (p *archivePlan) depend(collection, effect, id string) {
+	key := collection + "\x00" + effect
+	i, ok := p.deps[key]
+	if !ok {
+		i = len(p.result.Dependencies)
+		p.deps[key] = i
+		p.result.Dependencies = append(p.result.Dependencies, Dependency{Collection: collection, Effect: effect})
+	}
+	p.result.Dependencies[i].IDs = append(p.result.Dependencies[i].IDs, id)
+}
+
+func (p *archivePlan) block(format string, args ...interface{}) {
+	p.result.Blockers = append(p.result.Blockers, fmt.Sprintf(format, args...))
+}
+
+// Whether ref is already in the plan, marking it if not
+func (p *archivePlan) seen(ref *firestore.DocumentRef) bool {
+	if p.planned[ref.Path] {
+		return true
+	}
+	p.planned[ref.Path] = true
+	return false
+}
+
+func (p *archivePlan) update(ref *firestore.DocumentRef, updates ...firestore.Update) {
+	p.writes = append(p.writes, planWrite{ref: ref, updates: updates})
+}
+
+func (p *archivePlan) archive(ref *firestore.DocumentRef, updates ...firestore.Update) {
+	p.update(ref, append([]firestore.Update{{Path: "archivedAt", Value: p.now}}, updates...)...)
+}
+
+// Cancel a contest, refunding its entries
+func (p *archivePlan) planContest(ctx context.Context, ref *firestore.DocumentRef) error {
+	if p.seen(ref) {
+		return nil
+	}
+	if err := p.planRefunds(ctx, ref.ID); err != nil {
+		return err
+	}
+	p.archive(ref, firestore.Update{Path: "status", Value: "cancelled"})
+	return nil
+}
+
+// Entries of a contest deleted directly are refunded before it is archived.
+// Once its match has started the entries are in play and the contest stays.
+func (p *archivePlan) planContestEntries(ctx context.Context, contestID string, contest Contest) error {
+	if contest.MatchID == "" {
+		return p.planRefunds(ctx, contestID)
+	}
+	doc, err := p.s.firestoreClient.Collection("matches").Doc(contest.MatchID).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	if err == nil {
+		var match Match
+		doc.DataTo(&match)
+		if match.Status == models.MatchLive || match.Status == models.MatchCompleted {
+			p.block("match %s is %s", match.MatchID, match.Status)
+		}
+	}
+	return p.planRefunds(ctx, contestID)
+}
+
+// Refund every entry of a contest that has not been refunded yet
+func (p *archivePlan) planRefunds(ctx context.Context, contestID string) error {
+	docs, err := p.s.firestoreClient.Collection("contestTeams").Where("contestId", "==", contestID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		var entry ContestTeam
+		doc.DataTo(&entry)
+		if !entry.RefundedAt.IsZero() {
+			continue
+		}
+		p.depend("contestTeams", "entry fee refunded", doc.Ref.ID)
+		refundID := "refund_" + doc.Ref.ID
+		p.writes = append(p.writes, planWrite{
+			ref: p.s.firestoreClient.Collection("refunds").Doc(refundID),
+			data: Refund{
+				RefundID:      refundID,
+				ContestTeamID: doc.Ref.ID,
+				ContestID:     contestID,
+				MatchID:       entry.MatchID,
+				UserID:        entry.UserID,
+				Amount:        entry.EntryFee,
+				Reason:        "contest cancelled",
+				Status:        "pending",
+				CreatedAt:     p.now,
+			},
+		})
+		p.update(doc.Ref, firestore.Update{Path: "refundedAt", Value: p.now})
+		p.result.Refunds++
+		p.result.RefundTotal += entry.EntryFee
+	}
+	return nil
+}
+
+// Cancel a match that has not been played and its contests. A match being
+// played cannot be cancelled, and a completed one is history and stays.
+func (p *archivePlan) planMatch(ctx context.Context, match Match) error {
+	ref := p.s.firestoreClient.Collection("matches").Doc(match.MatchID)
+	if !match.ArchivedAt.IsZero() || match.Status == models.MatchCompleted || p.seen(ref) {
+		return nil
+	}
+	if match.Status == models.MatchLive {
+		p.block("match %s is live", match.MatchID)
+		return nil
+	}
+	contests, err := p.s.firestoreClient.Collection("contests").Where("matchId", "==", match.MatchID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range contests {
+		var contest Contest
+		doc.DataTo(&contest)
+		if !contest.ArchivedAt.IsZero() {
+			continue
+		}
+		p.depend("contests", "cancelled and entries refunded", doc.Ref.ID)
+		if err := p.planContest(ctx, doc.Ref); err != nil {
+			return err
+		}
+	}
+	p.depend("matches", "cancelled", match.MatchID)
+	p.archive(ref)
+	return nil
+}
+
+// End a player's or team's current and future memberships
+func (p *archivePlan) planTeamPlayers(ctx context.Context, field, id string) error {
+	docs, err := p.s.firestoreClient.Collection("teamPlayers").Where(field, "==", id).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		var tp TeamPlayer
+		doc.DataTo(&tp)
+		if p.seen(doc.Ref) || !tp.OpenAt(p.now) {
+			continue
+		}
+		p.depend("teamPlayers", "deactivated", doc.Ref.ID)
+		p.update(doc.Ref,
+			firestore.Update{Path: "isActive", Value: false},
+			firestore.Update{Path: "endDate", Value: p.now},
+		)
+	}
+	return nil
+}
+
+// A team's unplayed matches are cancelled and its roster released
+func (p *archivePlan) planTeam(ctx context.Context, teamID string) error {
+	q, _ := filterMatchesByTeam(ctx, p.s, p.s.firestoreClient.Collection("matches").Query, teamID)
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		var match Match
+		doc.DataTo(&match)
+		if err := p.planMatch(ctx, match); err != nil {
+			return err
+		}
+	}
+	return p.planTeamPlayers(ctx, "teamId", teamID)
+}
+
+// A league's teams and every unplayed match in it go with it
+func (p *archivePlan) planLeague(ctx context.Context, leagueID string) error {
+	teams, err := p.s.firestoreClient.Collection("teams").Where("leagueId", "==", leagueID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range teams {
+		var team Team
+		doc.DataTo(&team)
+		if !team.ArchivedAt.IsZero() || p.seen(doc.Ref) {
+			continue
+		}
+		if err := p.planTeam(ctx, doc.Ref.ID); err != nil {
+			return err
+		}
+		p.depend("teams", "archived", doc.Ref.ID)
+		p.archive(doc.Ref)
+	}
+
+	matches, err := p.s.firestoreClient.Collection("matches").Where("leagueId", "==", leagueID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range matches {
+		var match Match
+		doc.DataTo(&match)
+		if err := p.planMatch(ctx, match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A player leaves their teams and the squads of unplayed matches. Fantasy
+// teams that picked them are reported but kept; the player scores nothing.
+func (p *archivePlan) planPlayer(ctx context.Context, playerID string) error {
+	if err := p.planTeamPlayers(ctx, "playerId", playerID); err != nil {
+		return err
+	}
+
+	upcoming, err := p.s.firestoreClient.Collection("matches").Where("status", "==", models.MatchUpcoming).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	open := map[string]Match{}
+	var squadRefs []*firestore.DocumentRef
+	for _, doc := range upcoming {
+		var match Match
+		doc.DataTo(&match)
+		if !match.ArchivedAt.IsZero() {
+			continue
+		}
+		match.MatchID = doc.Ref.ID
+		open[match.MatchID] = match
+		squadRefs = append(squadRefs, p.s.firestoreClient.Collection("matchSquads").Doc(match.MatchID))
+	}
+	if len(squadRefs) > 0 {
+		squads, err := p.s.firestoreClient.GetAll(ctx, squadRefs)
+		if err != nil {
+			return err
+		}
+		for _, doc := range squads {
+			if !doc.Exists() {
+				continue
+			}
+			var squad MatchSquad
+			doc.DataTo(&squad)
+			p.planSquadRemoval(open[doc.Ref.ID], squad, playerID)
+		}
+	}
+
+	picked, err := p.s.firestoreClient.Collection("userTeams").Where("players", "array-contains", playerID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range picked {
+		var team UserTeam
+		doc.DataTo(&team)
+		if _, ok := open[team.MatchID]; ok {
+			p.depend("userTeams", "kept; the player scores no points", doc.Ref.ID)
+		}
+	}
+	return nil
+}
+
+// Take the player out of an upcoming match's squad. Once the match has locked
+// that takes ?override=true, as any squad edit after lock does.
+func (p *archivePlan) planSquadRemoval(match Match, squad MatchSquad, playerID string) {
+	if !squadHasPlayer(squad, playerID) {
+		return
+	}
+	if squadLocked(match, p.now) && (!p.edit.Override || strings.TrimSpace(p.edit.Reason) == "") {
+		p.block("match squad %s is locked; pass override=true with a reason to remove player %s", match.MatchID, playerID)
+		return
+	}
+	p.depend("matchSquads", "player removed", match.MatchID)
+	p.removals = append(p.removals, squadRemoval{matchID: match.MatchID, playerID: playerID})
+}
+
+// Write a squad without the player through saveSquad, which numbers the
+// version in the transaction and records the fantasy teams an edit after lock
+// touches
+func (s *Server) removeSquadPlayer(ctx context.Context, removal squadRemoval, edit SquadEdit) error {
+	if strings.TrimSpace(edit.Reason) == "" {
+		edit.Reason = fmt.Sprintf("player %s archived", removal.playerID)
+	}
+	return s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(s.firestoreClient.Collection("matches").Doc(removal.matchID))
+		if err != nil {
+			return err
+		}
+		var match Match
+		doc.DataTo(&match)
+		match.MatchID = removal.matchID
+		prev, err := s.loadSquadTx(tx, removal.matchID)
+		if err != nil || prev == nil {
+			return err
+		}
+		next := prev.Clone()
+		next.Team1Players, _ = withoutSquadPlayer(next.Team1Players, removal.playerID)
+		next.Team2Players, _ = withoutSquadPlayer(next.Team2Players, removal.playerID)
+		_, err = s.saveSquad(tx, match, prev, &next, edit)
+		return err
+	})
+}
+
+func withoutSquadPlayer(players []MatchSquadPlayer, playerID string) ([]MatchSquadPlayer, bool) {
+	kept := make([]MatchSquadPlayer, 0, len(players))
+	for _, player := range players {
+		if player.PlayerID != playerID {
+			kept = append(kept, player)
+		}
+	}
+	return kept, len(kept) != len(players)
+}
+
+// Archive root after its dependents, or report why not. Restrict refuses while
+// anything depends on root; blockers refuse in every mode.
+func (p *archivePlan) execute(ctx context.Context, root *firestore.DocumentRef, updates ...firestore.Update) (*DeleteResult, error) {
+	if len(p.result.Blockers) > 0 && !p.result.DryRun {
+		return nil, errorWithDetails(ErrConflict, p.result, "Cannot delete %s %s yet", p.result.Collection, p.result.ID)
+	}
+	if p.result.Mode == deleteRestrict && len(p.result.Dependencies) > 0 && !p.result.DryRun {
+		return nil, errorWithDetails(ErrConflict, p.result, "%s %s has dependents; delete with mode=cascade to archive them too", p.result.Collection, p.result.ID)
+	}
+	if p.result.DryRun {
+		return &p.result, nil
+	}
+
+	// Root last, so a failure part way leaves it live and the delete can be retried
+	for _, removal := range p.removals {
+		if err := p.s.removeSquadPlayer(ctx, removal, p.edit); err != nil {
+			return nil, err
+		}
+	}
+	p.archive(root, updates...)
+	for start := 0; start < len(p.writes); start += maxBatchWrites {
+		batch := p.s.firestoreClient.Batch()
+		for _, write := range p.writes[start:min(start+maxBatchWrites, len(p.writes))] {
+			if write.data != nil {
+				batch.Set(write.ref, write.data)
+			} else {
+				batch.Update(write.ref, write.updates)
+			}
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	p.result.Archived = true
+	return &p.result, nil
+}
+
+// Shared flow of the soft-delete handlers: load the document, refuse if it is
+// already archived, plan its dependents and archive it with rootUpdates
+func (s *Server) softDelete(w http.ResponseWriter, r *http.Request, collection, what, id string, plan func(ctx context.Context, p *archivePlan, doc *firestore.DocumentSnapshot) error, rootUpdates ...firestore.Update) {
+	p, err := s.newArchivePlan(r, collection, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection(collection).Doc(id), what)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if isArchived(doc) {
+		writeError(w, r, errorf(ErrConflict, "%s is already archived", what))
+		return
+	}
+	p.seen(doc.Ref)
+
+	if err := plan(ctx, p, doc); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := p.execute(ctx, doc.Ref, rootUpdates...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
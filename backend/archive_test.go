@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func testArchivePlan(t *testing.T, query string) *archivePlan {
+	t.Helper()
+	var s *Server // execute only reaches Firestore when it archives
+	p, err := s.newArchivePlan(httptest.NewRequest("DELETE", "/api/admin/players/p1?"+query, nil), "players", "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNewArchivePlan(t *testing.T) {
+	p := testArchivePlan(t, "")
+	if p.result.Mode != deleteRestrict || p.result.DryRun || p.edit.Override {
+		t.Errorf("defaults: mode %q dryRun %v override %v; want restrict, false, false", p.result.Mode, p.result.DryRun, p.edit.Override)
+	}
+	p = testArchivePlan(t, "mode=cascade&dryRun=true&override=true&reason=retired")
+	want := SquadEdit{Source: models.SquadSourceArchive, Reason: "retired", Override: true}
+	if p.result.Mode != deleteCascade || !p.result.DryRun || p.edit != want {
+		t.Errorf("mode %q dryRun %v edit %+v; want cascade, true, %+v", p.result.Mode, p.result.DryRun, p.edit, want)
+	}
+
+	for _, query := range []string{"mode=purge", "dryRun=maybe", "override=yes please"} {
+		req := httptest.NewRequest("DELETE", "/api/admin/players/p1", nil)
+		req.URL.RawQuery = query
+		if _, err := (*Server)(nil).newArchivePlan(req, "players", "p1"); !errors.Is(err, ErrInvalidRequest) {
+			t.Errorf("%s: err %v, want invalid request", query, err)
+		}
+	}
+}
+
+func TestPlanSquadRemoval(t *testing.T) {
+	now := time.Now().UTC()
+	squad := MatchSquad{
+		MatchID:      "m1",
+		Team1Players: []MatchSquadPlayer{{PlayerID: "p1"}, {PlayerID: "p2"}},
+		Team2Players: []MatchSquadPlayer{{PlayerID: "p3"}},
+	}
+	upcoming := Match{MatchID: "m1", Status: models.MatchUpcoming, StartTime: now.Add(24 * time.Hour)}
+	started := Match{MatchID: "m1", Status: models.MatchUpcoming, StartTime: now.Add(-time.Minute)}
+	live := Match{MatchID: "m1", Status: models.MatchLive, StartTime: now.Add(-time.Hour)}
+
+	locked := []string{"match squad m1 is locked; pass override=true with a reason to remove player p1"}
+	tests := []struct {
+		name     string
+		query    string
+		match    Match
+		playerID string
+		blockers []string
+		removed  bool
+	}{
+		{"unlocked", "", upcoming, "p1", nil, true},
+		{"not in the squad", "", upcoming, "p9", nil, false},
+		{"past start time", "", started, "p1", locked, false},
+		{"live", "", live, "p1", locked, false},
+		{"override without reason", "override=true", live, "p1", locked, false},
+		{"override with blank reason", "override=true&reason=%20", live, "p1", locked, false},
+		{"reason without override", "reason=retired", live, "p1", locked, false},
+		{"override with reason", "override=true&reason=retired", live, "p1", nil, true},
+	}
+	for _, tt := range tests {
+		p := testArchivePlan(t, tt.query)
+		p.planSquadRemoval(tt.match, squad, tt.playerID)
+
+		if !reflect.DeepEqual(p.result.Blockers, append([]string{}, tt.blockers...)) {
+			t.Errorf("%s: blockers %q, want %q", tt.name, p.result.Blockers, tt.blockers)
+		}
+		var wantRemovals []squadRemoval
+		wantDeps := []Dependency{}
+		if tt.removed {
+			wantRemovals = []squadRemoval{{matchID: "m1", playerID: tt.playerID}}
+			wantDeps = []Dependency{{Collection: "matchSquads", Effect: "player removed", IDs: []string{"m1"}}}
+		}
+		if !reflect.DeepEqual(p.removals, wantRemovals) || !reflect.DeepEqual(p.result.Dependencies, wantDeps) {
+			t.Errorf("%s: removals %+v dependencies %+v; want %+v %+v", tt.name, p.removals, p.result.Dependencies, wantRemovals, wantDeps)
+		}
+	}
+}
+
+func TestArchivePlanExecuteRefusals(t *testing.T) {
+	locked := Match{MatchID: "m1", Status: models.MatchLive}
+	squad := MatchSquad{MatchID: "m1", Team1Players: []MatchSquadPlayer{{PlayerID: "p1"}}}
+
+	tests := []struct {
+		name    string
+		query   string
+		plan    func(p *archivePlan)
+		refused bool
+	}{
+		{"blocked", "mode=cascade", func(p *archivePlan) { p.planSquadRemoval(locked, squad, "p1") }, true},
+		{"blocked dry run", "mode=cascade&dryRun=true", func(p *archivePlan) { p.planSquadRemoval(locked, squad, "p1") }, false},
+		{"restricted with dependents", "override=true&reason=retired", func(p *archivePlan) { p.planSquadRemoval(locked, squad, "p1") }, true},
+		{"restricted dry run", "dryRun=true&override=true&reason=retired", func(p *archivePlan) { p.planSquadRemoval(locked, squad, "p1") }, false},
+		{"cascade dry run", "mode=cascade&dryRun=true&override=true&reason=retired", func(p *archivePlan) { p.planSquadRemoval(locked, squad, "p1") }, false},
+	}
+	for _, tt := range tests {
+		p := testArchivePlan(t, tt.query)
+		tt.plan(p)
+		result, err := p.execute(context.Background(), nil)
+		if tt.refused {
+			if !errors.Is(err, ErrConflict) || result != nil {
+				t.Errorf("%s: %+v, %v; want a conflict", tt.name, result, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		// A dry run reports the plan and writes nothing
+		if result.Archived || !result.DryRun || len(p.writes) != 0 {
+			t.Errorf("%s: archived %v dryRun %v writes %d; want a report only", tt.name, result.Archived, result.DryRun, len(p.writes))
+		}
+		if len(result.Blockers)+len(result.Dependencies) == 0 {
+			t.Errorf("%s: dry run reported neither blockers nor dependents", tt.name)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Availability as submitted by an admin
+type AvailabilityRequest struct {
+	Status         string `json:"status"`
+	Reason         string `json:"reason"`
+	ExpectedReturn string `json:"expectedReturn"` // optional; date or RFC 3339 in the player's league time zone
+	Source         string `json:"source"`
+}
+
+type AvailabilityResult struct {
+	Availability       models.Availability `json:"availability"`
+	MatchSquadsUpdated int                 `json:"matchSquadsUpdated"`
+	NotificationsSent  int                 `json:"notificationsSent"`
+}
+
+func (s *Server) availabilityRef(playerID string) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("availability").Doc(playerID)
+}
+
+// Availability of the given players by ID. Players without a record are
+// available and get a zero record.
+func (s *Server) availabilityOf(ctx context.Context, playerIDs []string) (map[string]models.Availability, error) {
+	byPlayer := make(map[string]models.Availability, len(playerIDs))
+	if len(playerIDs) == 0 {
+		return byPlayer, nil
+	}
+	refs := make([]*firestore.DocumentRef, len(playerIDs))
+	for i, id := range playerIDs {
+		refs[i] = s.availabilityRef(id)
+	}
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		var a models.Availability
+		if doc.Exists() {
+			doc.DataTo(&a)
+		}
+		a.PlayerID = doc.Ref.ID
+		byPlayer[doc.Ref.ID] = a
+	}
+	return byPlayer, nil
+}
+
+// Mark each squad player's availability for the match
+func (s *Server) applyAvailability(ctx context.Context, match Match, sides ...[]MatchSquadPlayer) error {
+	var ids []string
+	for _, players := range sides {
+		for _, player := range players {
+			ids = append(ids, player.PlayerID)
+		}
+	}
+	byPlayer, err := s.availabilityOf(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, players := range sides {
+		for i := range players {
+			players[i].Availability = byPlayer[players[i].PlayerID].ForMatch(match.StartTime)
+		}
+	}
+	return nil
+}
+
+// Squad players who can play the match, and the IDs of those left out
+func withoutUnavailable(players []MatchSquadPlayer) ([]MatchSquadPlayer, []string) {
+	kept := make([]MatchSquadPlayer, 0, len(players))
+	var left []string
+	for _, player := range players {
+		if player.Availability != nil && player.Availability.Status != models.Doubtful {
+			left = append(left, player.PlayerID)
+			continue
+		}
+		kept = append(kept, player)
+	}
+	return kept, left
+}
+
+// Lineup problems for players who cannot play the match
+func unavailableProblems(players []string, byPlayer map[string]models.Availability, match Match) []string {
+	var problems []string
+	for _, id := range players {
+		a := byPlayer[id]
+		if a.AvailableOn(match.StartTime) {
+			continue
+		}
+		problem := fmt.Sprintf("player %s is %s", id, statusLabel(a.Status))
+		if !a.ExpectedReturn.IsZero() {
+			problem += " until " + a.ExpectedReturn.Format(time.RFC3339)
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+func statusLabel(status string) string {
+	return strings.ReplaceAll(status, "_", " ")
+}
+
+// Write a player's availability onto the squads of unlocked matches and notify
+// the owners of fantasy teams in unlocked matches the player can no longer
+// play. Notifications go out only when the change makes the player miss a
+// match, and their IDs are fixed per user, match and player, so running it
+// again does not notify twice.
+func (s *Server) availabilityChanged(ctx context.Context, player Player, previous, current models.Availability) (squads, notified int, err error) {
+	upcoming, err := s.firestoreClient.Collection("matches").Where("status", "==", models.MatchUpcoming).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now().UTC()
+	matches := map[string]Match{}
+	for _, doc := range upcoming {
+		var match Match
+		doc.DataTo(&match)
+		if !match.ArchivedAt.IsZero() || squadLocked(match, now) {
+			continue
+		}
+		match.MatchID = doc.Ref.ID
+		matches[match.MatchID] = match
+	}
+
+	// Each squad is versioned in a transaction of its own; locked squads keep
+	// the availability they locked with
+	edit := SquadEdit{Source: models.SquadSourceAvailability, Reason: fmt.Sprintf("%s is %s", player.Name, statusLabel(current.Status)), By: current.UpdatedBy}
+	for _, match := range matches {
+		status := current.ForMatch(match.StartTime)
+		saved := false
+		err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			saved = false
+			prev, err := s.loadSquadTx(tx, match.MatchID)
+			if err != nil || prev == nil {
+				return err
+			}
+			next := prev.Clone()
+			changed := false
+			for _, players := range [][]MatchSquadPlayer{next.Team1Players, next.Team2Players} {
+				for i := range players {
+					if players[i].PlayerID == player.PlayerID && !sameAvailability(players[i].Availability, status) {
+						players[i].Availability = status
+						changed = true
+					}
+				}
+			}
+			if !changed {
+				return nil
+			}
+			_, err = s.saveSquad(tx, match, prev, &next, edit)
+			saved = err == nil
+			return err
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		if saved {
+			squads++
+		}
+	}
+
+	var writes []planWrite
+
+	picked, err := s.firestoreClient.Collection("userTeams").Where("players", "array-contains", player.PlayerID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, 0, err
+	}
+	notifications := map[string]*models.Notification{}
+	for _, doc := range picked {
+		var team UserTeam
+		doc.DataTo(&team)
+		match, ok := matches[team.MatchID]
+		if !ok || checkMatchOpen(match, "change teams") != nil {
+			continue
+		}
+		if current.AvailableOn(match.StartTime) || !previous.AvailableOn(match.StartTime) {
+			continue
+		}
+		id := fmt.Sprintf("unavailable_%s_%s_%s", team.MatchID, player.PlayerID, team.UserID)
+		n, ok := notifications[id]
+		if !ok {
+			n = &models.Notification{
+				NotificationID: id,
+				UserID:         team.UserID,
+				Type:           models.NotificationPlayerUnavailable,
+				MatchID:        team.MatchID,
+				PlayerID:       player.PlayerID,
+				TeamIDs:        []string{},
+				Message: fmt.Sprintf("%s is %s for %s vs %s; change your team before the match locks",
+					player.Name, statusLabel(current.Status), match.Team1.Name, match.Team2.Name),
+				LocksAt:   match.StartTime,
+				CreatedAt: now,
+			}
+			notifications[id] = n
+		}
+		n.TeamIDs = append(n.TeamIDs, doc.Ref.ID)
+	}
+	for id, n := range notifications {
+		sort.Strings(n.TeamIDs)
+		writes = append(writes, planWrite{ref: s.firestoreClient.Collection("notifications").Doc(id), data: n})
+	}
+
+	for start := 0; start < len(writes); start += maxBatchWrites {
+		batch := s.firestoreClient.Batch()
+		for _, write := range writes[start:min(start+maxBatchWrites, len(writes))] {
+			if write.data != nil {
+				batch.Set(write.ref, write.data)
+			} else {
+				batch.Update(write.ref, write.updates)
+			}
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return 0, 0, err
+		}
+	}
+	return squads, len(notifications), nil
+}
+
+func sameAvailability(a, b *models.SquadAvailability) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Status == b.Status && a.Reason == b.Reason && a.ExpectedReturn.Equal(b.ExpectedReturn)
+}
+
+// Admin: Set a player's availability. The status is copied onto the squads
+// of upcoming matches and users whose unlocked teams include the player are
+// notified when it rules them out of the match.
+func (s *Server) setPlayerAvailability(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+
+	var req AvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	if !models.ValidAvailabilityStatus(req.Status) {
+		writeError(w, r, errorf(ErrInvalidRequest, "status must be one of %s", strings.Join(models.AvailabilityStatuses, ", ")))
+		return
+	}
+
+	ctx := r.Context()
+	player, err := s.loadPlayer(ctx, playerId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !player.ArchivedAt.IsZero() {
+		writeError(w, r, errorf(ErrConflict, "Player %s is archived", playerId))
+		return
+	}
+
+	// Expected returns are read in the time zone of the player's league
+	team, err := s.currentTeam(ctx, playerId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	leagueID := ""
+	if team != nil {
+		leagueID = team.LeagueID
+	}
+	loc, err := s.leagueLocation(ctx, leagueID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	expectedReturn, err := parseOptionalTimestamp("expectedReturn", req.ExpectedReturn, loc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Status == models.Available && !expectedReturn.IsZero() {
+		writeError(w, r, errorf(ErrInvalidRequest, "expectedReturn is only for unavailable players"))
+		return
+	}
+
+	byPlayer, err := s.availabilityOf(ctx, []string{playerId})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	previous := byPlayer[playerId]
+	current := models.Availability{
+		PlayerID:       playerId,
+		Status:         req.Status,
+		Reason:         strings.TrimSpace(req.Reason),
+		ExpectedReturn: expectedReturn.UTC(),
+		Source:         strings.TrimSpace(req.Source),
+		UpdatedBy:      adminID(r),
+		UpdatedAt:      time.Now().UTC(),
+	}
+
+	// The record is saved last, so a failure part way can be retried and still
+	// sees the change
+	result := AvailabilityResult{Availability: current}
+	if result.MatchSquadsUpdated, result.NotificationsSent, err = s.availabilityChanged(ctx, player, previous, current); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if _, err := s.availabilityRef(playerId).Set(ctx, current); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Admin: List players who are not fully available, soonest return first;
+// ?status= narrows to one status
+func (s *Server) getAvailability(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !models.ValidAvailabilityStatus(status) {
+		writeError(w, r, errorf(ErrInvalidRequest, "status must be one of %s", strings.Join(models.AvailabilityStatuses, ", ")))
+		return
+	}
+
+	ctx := r.Context()
+	q := s.firestoreClient.Collection("availability").Query
+	if status != "" {
+		q = q.Where("status", "==", status)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	now := time.Now().UTC()
+	records := []models.Availability{}
+	for _, doc := range docs {
+		var a models.Availability
+		doc.DataTo(&a)
+		if a.StatusOn(now) == models.Available {
+			continue
+		}
+		records = append(records, a)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i].ExpectedReturn, records[j].ExpectedReturn
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return records[i].PlayerID < records[j].PlayerID
+	})
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+// Get the signed-in user's notifications, latest first; ?unread=true leaves
+// out those already read
+func (s *Server) getUserNotifications(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+	if current, _ := r.Context().Value("userID").(string); current != userId {
+		writeError(w, r, errorf(ErrForbidden, "Cannot read another user's notifications"))
+		return
+	}
+
+	ctx := r.Context()
+	docs, err := s.firestoreClient.Collection("notifications").Where("userId", "==", userId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	unread := r.URL.Query().Get("unread") == "true"
+	notifications := []models.Notification{}
+	for _, doc := range docs {
+		var n models.Notification
+		doc.DataTo(&n)
+		if unread && !n.ReadAt.IsZero() {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].CreatedAt.After(notifications[j].CreatedAt) })
+
+	writeJSON(w, http.StatusOK, notifications)
+}
+
+// Mark one of the signed-in user's notifications read
+func (s *Server) readNotification(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId, notificationId := vars["userId"], vars["notificationId"]
+	if current, _ := r.Context().Value("userID").(string); current != userId {
+		writeError(w, r, errorf(ErrForbidden, "Cannot change another user's notifications"))
+		return
+	}
+
+	ctx := r.Context()
+	ref := s.firestoreClient.Collection("notifications").Doc(notificationId)
+	doc, err := getDocument(ctx, ref, "Notification")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var n models.Notification
+	doc.DataTo(&n)
+	if n.UserID != userId {
+		writeError(w, r, errorf(ErrNotFound, "Notification not found"))
+		return
+	}
+	if n.ReadAt.IsZero() {
+		n.ReadAt = time.Now().UTC()
+		if _, err := ref.Update(ctx, []firestore.Update{{Path: "readAt", Value: n.ReadAt}}); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, n)
+}
@@ -0,0 +1,150 @@
+// Command fvimport loads leagues, teams, players, team-player associations and
+// matches from CSV or JSON into Firestore.
+//
+//	fvimport [flags] <kind> <file>
+//
+// Records are matched to existing documents by natural key (league ID, team code
+// within a league, player name plus date of birth, player/team/league/season for
+// associations) and only differing fields are updated. Runs are dry by default:
+// the planned creates, field-level diffs and validation problems are printed and
+// nothing is written until -apply is given.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	firebase "firebase.google.com/go"
+	"google.golang.org/api/option"
+
+	"fantasy-volleyball-backend/importer"
+)
+
+func main() {
+	project := flag.String("project", "fantasy-volleyball-21364", "Firebase project ID")
+	credentials := flag.String("credentials", "serviceAccountKey.json", "service account key file")
+	league := flag.String("league", "", "league ID for records without a leagueId column")
+	season := flag.String("season", "", "season for team-player records without a season column")
+	defaultCredits := flag.Float64("default-credits", 0, "credits for new players whose record has none")
+	apply := flag.Bool("apply", false, "write the changes; without it the run is a dry run")
+	asJSON := flag.Bool("json", false, "print the plan as JSON")
+	verbose := flag.Bool("v", false, "also list records that need no change")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: fvimport [flags] <kind> <file.csv|file.json>\n\nkinds: %s\n\nflags:\n", kindNames())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	kind := importer.Kind(flag.Arg(0))
+	path := flag.Arg(1)
+
+	records, err := importer.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: *project}, option.WithCredentialsFile(*credentials))
+	if err != nil {
+		log.Fatalf("error initializing app: %v", err)
+	}
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("Failed to create Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	im := &importer.Importer{
+		Client:         client,
+		LeagueID:       *league,
+		Season:         *season,
+		DefaultCredits: *defaultCredits,
+	}
+	plan, err := im.Plan(ctx, kind, records)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(plan)
+	} else {
+		printPlan(os.Stdout, plan, len(records), path, *verbose)
+	}
+
+	if plan.HasErrors() {
+		if *apply {
+			fmt.Fprintln(os.Stderr, "Nothing written: fix the errors above first")
+		}
+		os.Exit(1)
+	}
+	if !*apply {
+		if !*asJSON {
+			fmt.Println("Dry run; pass -apply to write these changes")
+		}
+		return
+	}
+	written, err := im.Apply(ctx, plan)
+	if err != nil {
+		log.Fatalf("Applied %d writes before failing: %v", written, err)
+	}
+	fmt.Fprintf(os.Stderr, "Applied %d writes\n", written)
+}
+
+func printPlan(w io.Writer, plan *importer.Plan, records int, path string, verbose bool) {
+	fmt.Fprintf(w, "%s: %d records from %s\n\n", plan.Kind, records, path)
+	for _, change := range plan.Changes {
+		if change.Action == importer.ActionUnchanged && !verbose {
+			continue
+		}
+		fmt.Fprintf(w, "%-9s %s/%s  %s  (%s)\n", change.Action, change.Collection, change.DocID, change.Key, change.Source)
+		for _, diff := range change.Diffs {
+			fmt.Fprintf(w, "          %s: %s -> %s\n", diff.Field, formatValue(diff.Old), formatValue(diff.New))
+		}
+	}
+
+	if len(plan.Problems) > 0 {
+		fmt.Fprintln(w, "\nProblems:")
+		for _, problem := range plan.Problems {
+			fmt.Fprintf(w, "  %s\n", problem)
+		}
+	}
+
+	summary := plan.Summary()
+	fmt.Fprintf(w, "\n%d to create, %d to update, %d unchanged; %d errors, %d warnings\n",
+		summary[importer.ActionCreate], summary[importer.ActionUpdate], summary[importer.ActionUnchanged],
+		plan.Count(importer.SeverityError), plan.Count(importer.SeverityWarning))
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "(unset)"
+	case string:
+		return fmt.Sprintf("%q", value)
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func kindNames() string {
+	names := make([]string, len(importer.Kinds))
+	for i, kind := range importer.Kinds {
+		names[i] = string(kind)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"fantasy-volleyball-backend/importer"
+)
+
+func TestPrintPlan(t *testing.T) {
+	plan := &importer.Plan{
+		Kind: importer.KindPlayers,
+		Changes: []importer.Change{
+			{Action: importer.ActionCreate, Collection: "players", DocID: "player_1", Key: `name "Shon John"`, Source: "players.csv:2"},
+			{Action: importer.ActionUpdate, Collection: "players", DocID: "p2", Key: `name "Ashwal Rai"`, Source: "players.csv:3",
+				Diffs: []importer.FieldDiff{
+					{Field: "defaultCredits", Old: int64(8), New: 9.5},
+					{Field: "nationality", Old: nil, New: "India"},
+				}},
+			{Action: importer.ActionUnchanged, Collection: "players", DocID: "p3", Key: `name "Jerome Vinith"`, Source: "players.csv:4"},
+			{Action: importer.ActionUpdate, Collection: "teamPlayers", DocID: "a1", Key: "player p2 in team t1", Source: "players.csv:3",
+				Diffs: []importer.FieldDiff{{Field: "startDate", Old: nil, New: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)}}},
+		},
+		Problems: []importer.Problem{
+			{Source: "players.csv:2", Field: "dateOfBirth", Severity: importer.SeverityWarning, Message: "missing; matched on name only"},
+		},
+	}
+
+	want := `players: 3 records from players.csv
+
+create    players/player_1  name "Shon John"  (players.csv:2)
+update    players/p2  name "Ashwal Rai"  (players.csv:3)
+          defaultCredits: 8 -> 9.5
+          nationality: (unset) -> "India"
+update    teamPlayers/a1  player p2 in team t1  (players.csv:3)
+          startDate: (unset) -> 2025-02-01T00:00:00Z
+
+Problems:
+  players.csv:2: warning: dateOfBirth: missing; matched on name only
+
+1 to create, 2 to update, 1 unchanged; 0 errors, 1 warnings
+`
+	var out strings.Builder
+	printPlan(&out, plan, 3, "players.csv", false)
+	if out.String() != want {
+		t.Errorf("dry run printed\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// -v lists the records that need no change too
+	out.Reset()
+	printPlan(&out, plan, 3, "players.csv", true)
+	if !strings.Contains(out.String(), `unchanged players/p3  name "Jerome Vinith"  (players.csv:4)`) {
+		t.Errorf("verbose dry run printed\n%s\nwithout the unchanged record", out.String())
+	}
+}
@@ -0,0 +1,311 @@
+// Package dvw reads DataVolley scout files (.dvw), the format official volleyball
+// matches are scouted in, and totals the per-player skill outcomes.
+//
+// A .dvw file is a set of "[3SECTION]" blocks of semicolon-separated lines. The
+// ones used here are [3TEAMS] (home then visiting team), [3SET] (which sets were
+// played), [3PLAYERS-H]/[3PLAYERS-V] (rosters with per-set starting zones) and
+// [3SCOUT] (one line per scouted touch).
+package dvw
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Sets in a volleyball match, at most
+const MaxSets = 5
+
+type Side int
+
+const (
+	Home Side = iota
+	Visiting
+)
+
+func (s Side) String() string {
+	if s == Home {
+		return "home"
+	}
+	return "visiting"
+}
+
+type Team struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	SetsWon int    `json:"setsWon"`
+	Coach   string `json:"coach"`
+}
+
+// Skill outcomes for one player, counted from the scout lines
+type Stats struct {
+	Serves            int `json:"serves"`
+	Aces              int `json:"aces"`
+	ServeErrors       int `json:"serveErrors"`
+	Receptions        int `json:"receptions"`
+	ReceptionsPerfect int `json:"receptionsPerfect"`
+	ReceptionsGood    int `json:"receptionsGood"` // positive, not perfect
+	ReceptionErrors   int `json:"receptionErrors"`
+	Attacks           int `json:"attacks"`
+	Kills             int `json:"kills"`
+	AttackErrors      int `json:"attackErrors"`
+	AttacksBlocked    int `json:"attacksBlocked"`
+	Blocks            int `json:"blocks"`
+	BlockPoints       int `json:"blockPoints"`
+	BlockErrors       int `json:"blockErrors"`
+}
+
+type Player struct {
+	Side         Side   `json:"-"`
+	JerseyNumber int    `json:"jerseyNumber"`
+	ScoutID      string `json:"scoutId"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Libero       bool   `json:"libero"`
+	// Per set: the starting zone "1"-"6", "*" for a substitute who came on, "" if not used
+	StartingZones [MaxSets]string `json:"startingZones"`
+	Stats         Stats           `json:"stats"`
+}
+
+func (p *Player) Name() string {
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+type File struct {
+	Home      Team      `json:"home"`
+	Visiting  Team      `json:"visiting"`
+	SetsCount int       `json:"setsPlayed"`
+	Players   []*Player `json:"players"`
+}
+
+func (f *File) Team(side Side) Team {
+	if side == Home {
+		return f.Home
+	}
+	return f.Visiting
+}
+
+func (f *File) player(side Side, number int) *Player {
+	for _, p := range f.Players {
+		if p.Side == side && p.JerseyNumber == number {
+			return p
+		}
+	}
+	return nil
+}
+
+// Parse a scout file. Touches by jersey numbers missing from the rosters are an error,
+// since they mean the file is truncated or the rosters were edited after scouting.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	section := ""
+	lineNo := 0
+	teamLines := 0
+	currentSet := 1
+	sawScout := false
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, "[3") {
+			section = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+
+		switch section {
+		case "3TEAMS":
+			team := Team{Code: field(fields, 0), Name: field(fields, 1), Coach: field(fields, 3)}
+			team.SetsWon, _ = strconv.Atoi(field(fields, 2))
+			if teamLines == 0 {
+				f.Home = team
+			} else if teamLines == 1 {
+				f.Visiting = team
+			}
+			teamLines++
+		case "3SET":
+			if strings.EqualFold(field(fields, 0), "true") {
+				f.SetsCount++
+			}
+		case "3PLAYERS-H", "3PLAYERS-V":
+			side := Home
+			if section == "3PLAYERS-V" {
+				side = Visiting
+			}
+			number, err := strconv.Atoi(field(fields, 1))
+			if err != nil {
+				return nil, fmt.Errorf("dvw: line %d: jersey number %q is not a number", lineNo, field(fields, 1))
+			}
+			player := &Player{
+				Side:         side,
+				JerseyNumber: number,
+				ScoutID:      field(fields, 8),
+				LastName:     field(fields, 9),
+				FirstName:    field(fields, 10),
+				Libero:       strings.Contains(field(fields, 12), "L"),
+			}
+			for set := 0; set < MaxSets; set++ {
+				player.StartingZones[set] = field(fields, 3+set)
+			}
+			f.Players = append(f.Players, player)
+		case "3SCOUT":
+			sawScout = true
+			if err := f.scoutLine(fields, &currentSet); err != nil {
+				return nil, fmt.Errorf("dvw: line %d: %w", lineNo, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("dvw: %w", err)
+	}
+
+	if teamLines < 2 {
+		return nil, fmt.Errorf("dvw: [3TEAMS] must list the home and visiting teams")
+	}
+	if len(f.Players) == 0 {
+		return nil, fmt.Errorf("dvw: no players in [3PLAYERS-H] or [3PLAYERS-V]")
+	}
+	if !sawScout {
+		return nil, fmt.Errorf("dvw: no [3SCOUT] section")
+	}
+	if f.SetsCount == 0 {
+		// Older files leave [3SET] empty; fall back to the set markers in the scout
+		f.SetsCount = currentSet - 1
+	}
+	return f, nil
+}
+
+// Count one scout line. Player touches look like "*16SH#..." or "a07RM-...": the
+// team ("*" home, "a" visiting), a two-digit jersey, the skill letter, the hit type
+// and the evaluation. "**2set" ends a set; other codes (points, substitutions,
+// rotations, timeouts, "$$" team touches) don't change player stats.
+func (f *File) scoutLine(fields []string, currentSet *int) error {
+	code := field(fields, 0)
+	if len(code) < 2 {
+		return nil
+	}
+	if strings.HasPrefix(code, "**") && strings.HasSuffix(code, "set") {
+		*currentSet++
+		return nil
+	}
+
+	var side Side
+	switch code[0] {
+	case '*':
+		side = Home
+	case 'a':
+		side = Visiting
+	default:
+		return nil
+	}
+	if len(code) < 6 || !isDigit(code[1]) || !isDigit(code[2]) {
+		return nil
+	}
+	number, _ := strconv.Atoi(code[1:3])
+	skill, evaluation := code[3], code[5]
+
+	player := f.player(side, number)
+	if player == nil {
+		return fmt.Errorf("touch %q by %s #%d, who is not on the roster", code, side, number)
+	}
+	stats := &player.Stats
+	switch skill {
+	case 'S':
+		stats.Serves++
+		switch evaluation {
+		case '#':
+			stats.Aces++
+		case '=':
+			stats.ServeErrors++
+		}
+	case 'R':
+		stats.Receptions++
+		switch evaluation {
+		case '#':
+			stats.ReceptionsPerfect++
+		case '+':
+			stats.ReceptionsGood++
+		case '=':
+			stats.ReceptionErrors++
+		}
+	case 'A':
+		stats.Attacks++
+		switch evaluation {
+		case '#':
+			stats.Kills++
+		case '=':
+			stats.AttackErrors++
+		case '/':
+			stats.AttacksBlocked++
+		}
+	case 'B':
+		stats.Blocks++
+		switch evaluation {
+		case '#':
+			stats.BlockPoints++
+		case '=', '/':
+			stats.BlockErrors++
+		}
+	}
+	return nil
+}
+
+// Sets the player was on court in, as a starter or a substitute, limited to the
+// sets actually played
+func (f *File) Participation(p *Player) (played, asStarter, asSubstitute []int) {
+	played, asStarter, asSubstitute = []int{}, []int{}, []int{}
+	sets := f.SetsCount
+	if sets <= 0 || sets > MaxSets {
+		sets = MaxSets
+	}
+	for i := 0; i < sets; i++ {
+		zone := strings.TrimSpace(p.StartingZones[i])
+		switch {
+		case zone == "":
+			continue
+		case zone == "*":
+			asSubstitute = append(asSubstitute, i+1)
+		default:
+			asStarter = append(asStarter, i+1)
+		}
+		played = append(played, i+1)
+	}
+	return played, asStarter, asSubstitute
+}
+
+// The player's totals in the shape the match squad stores. Successful receptions
+// are perfect and positive ones; attacks count kills, blocks count block points.
+// TotalPoints is left for the caller to score.
+func (f *File) LiveStats(p *Player) models.PlayerLiveStats {
+	played, asStarter, asSubstitute := f.Participation(p)
+	return models.PlayerLiveStats{
+		Attacks:           p.Stats.Kills,
+		Aces:              p.Stats.Aces,
+		Blocks:            p.Stats.BlockPoints,
+		ReceptionsSuccess: p.Stats.ReceptionsPerfect + p.Stats.ReceptionsGood,
+		ReceptionErrors:   p.Stats.ReceptionErrors,
+		SetsPlayed:        played,
+		SetsAsStarter:     asStarter,
+		SetsAsSubstitute:  asSubstitute,
+	}
+}
+
+func field(fields []string, i int) string {
+	if i >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[i])
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,163 @@
+package dvw
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A four-set match, cut down to a few touches per set
+const sampleFile = "testdata/match.dvw"
+
+func parseSample(t *testing.T) *File {
+	t.Helper()
+	f, err := os.Open(sampleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	file, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func samplePlayer(t *testing.T, file *File, side Side, number int) *Player {
+	t.Helper()
+	p := file.player(side, number)
+	if p == nil {
+		t.Fatalf("no %s player #%d", side, number)
+	}
+	return p
+}
+
+func TestParseTeams(t *testing.T) {
+	file := parseSample(t)
+	if want := (Team{Code: "AHD", Name: "Ahmedabad Defenders", SetsWon: 3, Coach: "Dragan Bonic"}); file.Home != want {
+		t.Errorf("Home = %+v, want %+v", file.Home, want)
+	}
+	if want := (Team{Code: "CHB", Name: "Chennai Blitz", SetsWon: 1, Coach: "Jon Uriarte"}); file.Visiting != want {
+		t.Errorf("Visiting = %+v, want %+v", file.Visiting, want)
+	}
+	if file.SetsCount != 4 {
+		t.Errorf("SetsCount = %d, want 4", file.SetsCount)
+	}
+	if len(file.Players) != 6 {
+		t.Fatalf("got %d players, want 6", len(file.Players))
+	}
+}
+
+func TestParsePlayers(t *testing.T) {
+	file := parseSample(t)
+	tests := []struct {
+		side    Side
+		number  int
+		name    string
+		scoutID string
+		libero  bool
+		stats   Stats
+	}{
+		{Home, 16, "Muthusamy Appavu", "AHD-16", false, Stats{Serves: 3, Aces: 1, ServeErrors: 1}},
+		{Home, 7, "Shon T John", "AHD-7", false, Stats{Attacks: 4, Kills: 3, AttackErrors: 1, Blocks: 1, BlockPoints: 1}},
+		{Home, 1, "Angamuthu Santhosh", "AHD-1", true, Stats{Receptions: 1, ReceptionsPerfect: 1}},
+		{Home, 12, "Nandha Kumar", "AHD-12", false, Stats{Attacks: 2, Kills: 1, AttacksBlocked: 1}},
+		{Visiting, 10, "Akhin Sharma", "CHB-10", false, Stats{
+			Serves: 1, Aces: 1, Receptions: 2, ReceptionsGood: 1, ReceptionErrors: 1,
+			Attacks: 1, Kills: 1, Blocks: 1, BlockPoints: 1,
+		}},
+		{Visiting, 4, "Naveen Raju", "CHB-4", false, Stats{Attacks: 1, AttacksBlocked: 1, Blocks: 1, BlockErrors: 1}},
+	}
+	for _, tt := range tests {
+		p := samplePlayer(t, file, tt.side, tt.number)
+		if p.Name() != tt.name {
+			t.Errorf("%s #%d: Name() = %q, want %q", tt.side, tt.number, p.Name(), tt.name)
+		}
+		if p.ScoutID != tt.scoutID {
+			t.Errorf("%s #%d: ScoutID = %q, want %q", tt.side, tt.number, p.ScoutID, tt.scoutID)
+		}
+		if p.Libero != tt.libero {
+			t.Errorf("%s #%d: Libero = %v, want %v", tt.side, tt.number, p.Libero, tt.libero)
+		}
+		if p.Stats != tt.stats {
+			t.Errorf("%s #%d: Stats = %+v, want %+v", tt.side, tt.number, p.Stats, tt.stats)
+		}
+	}
+}
+
+func TestParseSetsFromMarkers(t *testing.T) {
+	data := strings.Join([]string{
+		"[3TEAMS]", "AHD;Ahmedabad Defenders;0;;", "CHB;Chennai Blitz;0;;",
+		"[3SET]",
+		"[3PLAYERS-H]", "0;16;1;1;1;;;;AHD-16;Appavu;Muthusamy;;;",
+		"[3SCOUT]", "*16SH#;", "**1set;", "*16SM-;", "**2set;",
+	}, "\n")
+	file, err := Parse(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.SetsCount != 2 {
+		t.Errorf("SetsCount = %d, want 2 from the set markers", file.SetsCount)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	teams := "[3TEAMS]\nAHD;Ahmedabad Defenders;3;;\nCHB;Chennai Blitz;1;;\n"
+	players := "[3PLAYERS-H]\n0;16;1;1;;;;;AHD-16;Appavu;Muthusamy;;;\n"
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"one team", "[3TEAMS]\nAHD;Ahmedabad Defenders;3;;\n" + players + "[3SCOUT]\n*16SH#;\n", "[3TEAMS]"},
+		{"no players", teams + "[3SCOUT]\n**1set;\n", "no players"},
+		{"no scout", teams + players, "no [3SCOUT]"},
+		{"bad jersey", teams + "[3PLAYERS-H]\n0;xx;1;1;;;;;AHD-16;Appavu;Muthusamy;;;\n[3SCOUT]\n", "line 5"},
+		{"touch off roster", teams + players + "[3SCOUT]\n*09SH#;\n", "not on the roster"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q does not mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParticipation(t *testing.T) {
+	file := parseSample(t)
+	tests := []struct {
+		side                            Side
+		number                          int
+		played, asStarter, asSubstitute []int
+	}{
+		// Zone 6 in set 5 is ignored: only four sets were played
+		{Home, 16, []int{1, 2, 3, 4}, []int{1, 2, 3, 4}, []int{}},
+		{Home, 7, []int{1, 2, 3, 4}, []int{1, 2, 4}, []int{3}},
+		{Home, 1, []int{1}, []int{}, []int{1}},
+		{Home, 12, []int{3}, []int{3}, []int{}},
+		{Visiting, 4, []int{1, 3}, []int{}, []int{1, 3}},
+	}
+	for _, tt := range tests {
+		played, asStarter, asSubstitute := file.Participation(samplePlayer(t, file, tt.side, tt.number))
+		if !reflect.DeepEqual(played, tt.played) || !reflect.DeepEqual(asStarter, tt.asStarter) || !reflect.DeepEqual(asSubstitute, tt.asSubstitute) {
+			t.Errorf("%s #%d: Participation() = %v, %v, %v; want %v, %v, %v",
+				tt.side, tt.number, played, asStarter, asSubstitute, tt.played, tt.asStarter, tt.asSubstitute)
+		}
+	}
+}
+
+func TestLiveStats(t *testing.T) {
+	file := parseSample(t)
+	stats := file.LiveStats(samplePlayer(t, file, Visiting, 10))
+	if stats.Attacks != 1 || stats.Aces != 1 || stats.Blocks != 1 || stats.ReceptionsSuccess != 1 || stats.ReceptionErrors != 1 {
+		t.Errorf("LiveStats = %+v", stats)
+	}
+	if !reflect.DeepEqual(stats.SetsAsStarter, []int{1, 2, 3, 4}) {
+		t.Errorf("SetsAsStarter = %v", stats.SetsAsStarter)
+	}
+}
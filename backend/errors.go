@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain errors. Handlers wrap these with errorf to attach a user-facing message;
+// errorKinds maps each one to its HTTP status and wire code.
+var (
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrConflict         = errors.New("conflict")
+	ErrBodyTooLarge     = errors.New("request body too large")
+	ErrMatchLocked      = errors.New("match locked")
+	ErrContestFull      = errors.New("contest full")
+	ErrTeamInvalid      = errors.New("team invalid")
+	ErrNotImplemented   = errors.New("not implemented")
+	ErrUnavailable      = errors.New("service unavailable")
+)
+
+type errorKind struct {
+	status int
+	code   string
+}
+
+// The single place domain errors are mapped to HTTP statuses
+var errorKinds = map[error]errorKind{
+	ErrInvalidRequest:   {http.StatusBadRequest, "invalid_request"},
+	ErrUnauthorized:     {http.StatusUnauthorized, "unauthorized"},
+	ErrForbidden:        {http.StatusForbidden, "forbidden"},
+	ErrNotFound:         {http.StatusNotFound, "not_found"},
+	ErrMethodNotAllowed: {http.StatusMethodNotAllowed, "method_not_allowed"},
+	ErrConflict:         {http.StatusConflict, "conflict"},
+	ErrBodyTooLarge:     {http.StatusRequestEntityTooLarge, "body_too_large"},
+	ErrMatchLocked:      {http.StatusForbidden, "match_locked"},
+	ErrContestFull:      {http.StatusConflict, "contest_full"},
+	ErrTeamInvalid:      {http.StatusUnprocessableEntity, "team_invalid"},
+	ErrNotImplemented:   {http.StatusNotImplemented, "not_implemented"},
+	ErrUnavailable:      {http.StatusServiceUnavailable, "unavailable"},
+}
+
+// A domain error with a message safe to show to API clients
+type apiError struct {
+	kind    error
+	message string
+	details interface{}
+}
+
+func (e *apiError) Error() string { return e.message }
+func (e *apiError) Unwrap() error { return e.kind }
+
+// Wrap a domain error with a client-facing message
+func errorf(kind error, format string, args ...interface{}) error {
+	return &apiError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+// Like errorf but with structured details, e.g. a list of validation problems
+func errorWithDetails(kind error, details interface{}, format string, args ...interface{}) error {
+	return &apiError{kind: kind, message: fmt.Sprintf(format, args...), details: details}
+}
+
+// JSON body of every error response
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId"`
+}
+
+// Resolve any error to its status and response body. Errors that are not domain
+// errors are reported as internal without leaking their text to the client.
+func classifyError(err error) (int, ErrorResponse) {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		if kind, ok := errorKinds[apiErr.kind]; ok {
+			return kind.status, ErrorResponse{Code: kind.code, Message: apiErr.message, Details: apiErr.details}
+		}
+	}
+	for sentinel, kind := range errorKinds {
+		if errors.Is(err, sentinel) {
+			return kind.status, ErrorResponse{Code: kind.code, Message: err.Error()}
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return 499, ErrorResponse{Code: "cancelled", Message: "Request cancelled"}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, ErrorResponse{Code: "timeout", Message: "Request timed out"}
+	}
+
+	switch status.Code(err) {
+	case codes.NotFound:
+		return http.StatusNotFound, ErrorResponse{Code: "not_found", Message: "Resource not found"}
+	case codes.AlreadyExists:
+		return http.StatusConflict, ErrorResponse{Code: "conflict", Message: "Resource already exists"}
+	case codes.Canceled:
+		return 499, ErrorResponse{Code: "cancelled", Message: "Request cancelled"}
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout, ErrorResponse{Code: "timeout", Message: "Request timed out"}
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable, ErrorResponse{Code: "unavailable", Message: "Service temporarily unavailable"}
+	}
+	return http.StatusInternalServerError, ErrorResponse{Code: "internal", Message: "Internal server error"}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Most players a side may list as starters: the six on court plus the libero
+const maxStarters = 7
+
+// Event as submitted by the scorer
+type MatchEventRequest struct {
+	Type          string   `json:"type"`
+	Set           int      `json:"set"` // defaults to the set in progress
+	TeamID        string   `json:"teamId"`
+	PlayerID      string   `json:"playerId"`
+	PlayerInID    string   `json:"playerInId"`
+	PlayerOutID   string   `json:"playerOutId"`
+	Team1Starters []string `json:"team1Starters"`
+	Team2Starters []string `json:"team2Starters"`
+	Timestamp     string   `json:"timestamp"` // RFC 3339; defaults to now
+}
+
+type MatchEventResult struct {
+	Event            *MatchEvent `json:"event,omitempty"`
+	EventCount       int         `json:"eventCount"`
+	CurrentSet       int         `json:"currentSet"`
+	SetInProgress    bool        `json:"setInProgress"`
+	SetScores        [][2]int    `json:"setScores"`
+	Match            *Match      `json:"match,omitempty"` // scoreboard as synced from the log
+	UserTeamsUpdated int         `json:"userTeamsUpdated"`
+}
+
+// Live stats and score derived by folding a match's event log
+type matchState struct {
+	currentSet   int
+	inSet        bool
+	setScores    [][2]int // per set: team1 points, team2 points
+	servingTeam  string   // winner of the latest rally
+	players      map[string]*PlayerLiveStats
+	undone       map[int]bool
+	lastUndoable int // seq of the latest event that is neither an undo nor undone
+}
+
+// Event types that credit a player's live stats
+var playerEventTypes = map[string]func(*PlayerLiveStats){
+	models.EventAttackKill:       func(s *PlayerLiveStats) { s.Attacks++ },
+	models.EventAce:              func(s *PlayerLiveStats) { s.Aces++ },
+	models.EventBlock:            func(s *PlayerLiveStats) { s.Blocks++ },
+	models.EventReceptionSuccess: func(s *PlayerLiveStats) { s.ReceptionsSuccess++ },
+	models.EventReceptionError:   func(s *PlayerLiveStats) { s.ReceptionErrors++ },
+}
+
+// Replay events in sequence order, skipping undone ones. Any player event in a
+// set counts as playing it, so liberos who come on without a substitution
+// event are still credited with the set.
+func foldEvents(events []MatchEvent, squad *MatchSquad) *matchState {
+	state := &matchState{
+		setScores: [][2]int{},
+		players:   map[string]*PlayerLiveStats{},
+		undone:    map[int]bool{},
+	}
+	for _, ev := range events {
+		if ev.Type == models.EventUndo {
+			state.undone[ev.UndoesSeq] = true
+		}
+	}
+
+	for _, ev := range events {
+		if ev.Type == models.EventUndo || state.undone[ev.Seq] {
+			continue
+		}
+		state.lastUndoable = ev.Seq
+
+		switch ev.Type {
+		case models.EventSetStart:
+			state.currentSet = ev.Set
+			state.inSet = true
+			for len(state.setScores) < ev.Set {
+				state.setScores = append(state.setScores, [2]int{})
+			}
+			for _, playerID := range append(append([]string{}, ev.Team1Starters...), ev.Team2Starters...) {
+				stats := state.player(playerID)
+				stats.SetsAsStarter = addSet(stats.SetsAsStarter, ev.Set)
+				stats.SetsPlayed = addSet(stats.SetsPlayed, ev.Set)
+			}
+		case models.EventSetEnd:
+			state.inSet = false
+		case models.EventRallyWon:
+			side := 0
+			if ev.TeamID == squad.Team2ID {
+				side = 1
+			}
+			state.setScores[ev.Set-1][side]++
+			state.servingTeam = ev.TeamID
+		case models.EventSubstitution:
+			state.played(ev.PlayerInID, ev.Set)
+		default:
+			if credit, ok := playerEventTypes[ev.Type]; ok {
+				state.played(ev.PlayerID, ev.Set)
+				credit(state.player(ev.PlayerID))
+			}
+		}
+	}
+	return state
+}
+
+func (state *matchState) player(playerID string) *PlayerLiveStats {
+	stats, ok := state.players[playerID]
+	if !ok {
+		stats = emptyLiveStats()
+		state.players[playerID] = stats
+	}
+	return stats
+}
+
+// Record that a player was on court in a set, as a substitute unless they started it
+func (state *matchState) played(playerID string, set int) {
+	stats := state.player(playerID)
+	if !containsInt(stats.SetsAsStarter, set) {
+		stats.SetsAsSubstitute = addSet(stats.SetsAsSubstitute, set)
+	}
+	stats.SetsPlayed = addSet(stats.SetsPlayed, set)
+}
+
+// Points so far in the given set
+func (state *matchState) setScore(set int) SetScore {
+	if set < 1 || set > len(state.setScores) {
+		return SetScore{}
+	}
+	return SetScore{Team1Points: state.setScores[set-1][0], Team2Points: state.setScores[set-1][1]}
+}
+
+// Whether either side has won enough finished sets to take the match
+func (state *matchState) decided() bool {
+	won := [2]int{}
+	for i, points := range state.setScores {
+		if state.setScore(i + 1).Finished(i + 1) {
+			if points[0] > points[1] {
+				won[0]++
+			} else {
+				won[1]++
+			}
+		}
+	}
+	return won[0] == models.SetsToWin || won[1] == models.SetsToWin
+}
+
+func emptyLiveStats() *PlayerLiveStats {
+	return &PlayerLiveStats{SetsPlayed: []int{}, SetsAsStarter: []int{}, SetsAsSubstitute: []int{}, SetsWon: []int{}, SetsLost: []int{}}
+}
+
+func addSet(sets []int, set int) []int {
+	if containsInt(sets, set) {
+		return sets
+	}
+	sets = append(sets, set)
+	sort.Ints(sets)
+	return sets
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Check an event against the state the log is in, filling in its set and team
+func validateMatchEvent(ev *MatchEvent, state *matchState, squad *MatchSquad) error {
+	switch ev.Type {
+	case models.EventSetStart, models.EventSetEnd, models.EventRallyWon, models.EventSubstitution:
+	default:
+		if _, ok := playerEventTypes[ev.Type]; !ok {
+			return errorf(ErrInvalidRequest, "Unknown event type %q", ev.Type)
+		}
+	}
+	if ev.Type != models.EventSetStart {
+		if !state.inSet {
+			return errorf(ErrConflict, "No set in progress; record a set_start first")
+		}
+		if ev.Set == 0 {
+			ev.Set = state.currentSet
+		}
+		if ev.Set != state.currentSet {
+			return errorf(ErrConflict, "Set %d is in progress, not set %d", state.currentSet, ev.Set)
+		}
+	}
+
+	switch ev.Type {
+	case models.EventSetStart:
+		if state.inSet {
+			return errorf(ErrConflict, "Set %d has not ended", state.currentSet)
+		}
+		next := state.currentSet + 1
+		if ev.Set == 0 {
+			ev.Set = next
+		}
+		if ev.Set != next {
+			return errorf(ErrConflict, "The next set is set %d", next)
+		}
+		if state.decided() {
+			return errorf(ErrConflict, "The match is over")
+		}
+		if ev.Set > models.MaxSets {
+			return errorf(ErrInvalidRequest, "A match has at most %d sets", models.MaxSets)
+		}
+		for _, side := range []struct {
+			teamID   string
+			starters []string
+		}{{squad.Team1ID, ev.Team1Starters}, {squad.Team2ID, ev.Team2Starters}} {
+			if len(side.starters) == 0 || len(side.starters) > maxStarters {
+				return errorf(ErrInvalidRequest, "Each team needs 1 to %d starters", maxStarters)
+			}
+			for _, playerID := range side.starters {
+				if squadTeamOf(squad, playerID) != side.teamID {
+					return errorf(ErrInvalidRequest, "Starter %s is not in team %s's match squad", playerID, side.teamID)
+				}
+			}
+		}
+	case models.EventSetEnd:
+		if score := state.setScore(ev.Set); !score.Finished(ev.Set) {
+			return errorf(ErrConflict, "Set %d is not over at %d-%d", ev.Set, score.Team1Points, score.Team2Points)
+		}
+	case models.EventRallyWon:
+		if ev.TeamID != squad.Team1ID && ev.TeamID != squad.Team2ID {
+			return errorf(ErrInvalidRequest, "teamId must be one of the match's teams")
+		}
+		if score := state.setScore(ev.Set); score.Finished(ev.Set) {
+			return errorf(ErrConflict, "Set %d is over at %d-%d; record set_end", ev.Set, score.Team1Points, score.Team2Points)
+		}
+	case models.EventSubstitution:
+		inTeam := squadTeamOf(squad, ev.PlayerInID)
+		if inTeam == "" || inTeam != squadTeamOf(squad, ev.PlayerOutID) {
+			return errorf(ErrInvalidRequest, "playerInId and playerOutId must be in the same team's match squad")
+		}
+		ev.TeamID = inTeam
+	default:
+		ev.TeamID = squadTeamOf(squad, ev.PlayerID)
+		if ev.TeamID == "" {
+			return errorf(ErrInvalidRequest, "Player %s is not in the match squad", ev.PlayerID)
+		}
+	}
+	return nil
+}
+
+// Team whose squad list holds the player, or "" if neither does
+func squadTeamOf(squad *MatchSquad, playerID string) string {
+	if playerID == "" {
+		return ""
+	}
+	if findSquadPlayer(squad, squad.Team1ID, playerID) != nil {
+		return squad.Team1ID
+	}
+	if findSquadPlayer(squad, squad.Team2ID, playerID) != nil {
+		return squad.Team2ID
+	}
+	return ""
+}
+
+func (s *Server) matchEventLog(matchID string) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("matchEvents").Doc(matchID)
+}
+
+// Any one of a match's events. A match with events is scored through its log,
+// which the next event folds into the scoreboard and live stats again, so they
+// can't be written directly.
+func (s *Server) anyMatchEvent(matchID string) firestore.Query {
+	return s.matchEventLog(matchID).Collection("events").Limit(1)
+}
+
+// A write to a match's event log and the scoreboard saved with it
+type eventLogWrite struct {
+	event        MatchEvent // zero when nothing was appended
+	events       []MatchEvent
+	squad        MatchSquad
+	match        Match
+	wasCompleted bool
+}
+
+// Append the event build returns to the match's log and save the scoreboard
+// folded from the log with it. The log and match are read and the next
+// sequence number assigned inside one transaction, so concurrent scorers can't
+// interleave events out of order or save a scoreboard from a shorter log. With
+// a nil build nothing is appended and the scoreboard is only folded again.
+func (s *Server) appendMatchEvent(ctx context.Context, matchID string, build func(*matchState, *MatchSquad) (MatchEvent, error)) (*eventLogWrite, error) {
+	var written eventLogWrite
+	logRef := s.matchEventLog(matchID)
+	matchRef := s.firestoreClient.Collection("matches").Doc(matchID)
+
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		written = eventLogWrite{}
+		squadDoc, err := tx.Get(s.firestoreClient.Collection("matchSquads").Doc(matchID))
+		if status.Code(err) == codes.NotFound {
+			return errorf(ErrNotFound, "Match squad not found")
+		}
+		if err != nil {
+			return err
+		}
+		squadDoc.DataTo(&written.squad)
+
+		matchDoc, err := tx.Get(matchRef)
+		if status.Code(err) == codes.NotFound {
+			return errorf(ErrNotFound, "Match not found")
+		}
+		if err != nil {
+			return err
+		}
+		matchDoc.DataTo(&written.match)
+		written.wasCompleted = written.match.Status == models.MatchCompleted
+
+		docs, err := tx.Documents(logRef.Collection("events").OrderBy("seq", firestore.Asc)).GetAll()
+		if err != nil {
+			return err
+		}
+		written.events = eventsFrom(docs, 1)
+
+		now := time.Now().UTC()
+		if build == nil && len(written.events) == 0 {
+			return errorf(ErrConflict, "Match has no events; its live stats were not recorded through the event log")
+		}
+		if build != nil {
+			// Folding an empty log would wipe a scoreboard entered through the score endpoints
+			if len(written.events) == 0 && (len(written.match.SetScores) > 0 || written.wasCompleted) {
+				return errorf(ErrConflict, "Match %s was scored directly; keep scoring it through the score endpoints", matchID)
+			}
+			ev, err := build(foldEvents(written.events, &written.squad), &written.squad)
+			if err != nil {
+				return err
+			}
+			ev.MatchID = matchID
+			ev.Seq = 1
+			if len(written.events) > 0 {
+				ev.Seq = written.events[len(written.events)-1].Seq + 1
+			}
+			ev.RecordedAt = now
+			if ev.Timestamp.IsZero() {
+				ev.Timestamp = ev.RecordedAt
+			}
+			written.event = ev
+			written.events = append(written.events, ev)
+		}
+
+		// The log only ends a set once it is won, so the points always settle
+		state := foldEvents(written.events, &written.squad)
+		written.match.SetScores = make([]SetScore, len(state.setScores))
+		for i := range state.setScores {
+			written.match.SetScores[i] = state.setScore(i + 1)
+		}
+		written.match.ServingTeamID = state.servingTeam
+		if err := written.match.Settle(now); err != nil {
+			return errorf(ErrConflict, "Event log score does not settle: %v", err)
+		}
+
+		if build != nil {
+			if err := tx.Create(logRef.Collection("events").Doc(fmt.Sprintf("%06d", written.event.Seq)), written.event); err != nil {
+				return err
+			}
+			if err := tx.Set(logRef, map[string]interface{}{
+				"matchId":   matchID,
+				"lastSeq":   written.event.Seq,
+				"updatedAt": now,
+			}); err != nil {
+				return err
+			}
+		}
+		return tx.Update(matchRef, scoreboardUpdates(&written.match))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// Follow a log write with everything derived from the saved scoreboard: pick
+// counts, the squad lock, standings and brackets, then the squad's live stats,
+// player points and user teams. The live stats are folded again from the log
+// as it stands when they are written, so a scorer whose event lands meanwhile
+// can't be overwritten with stats from the shorter log.
+func (s *Server) rebuildLiveStats(ctx context.Context, matchID string, logged *eventLogWrite) (*MatchEventResult, error) {
+	match := &logged.match
+	s.scoreboardSaved(ctx, match, logged.wasCompleted)
+
+	written, err := s.updateLiveStats(ctx, matchID, func(tx *firestore.Transaction, squad *MatchSquad) error {
+		docs, err := tx.Documents(s.matchEventLog(matchID).Collection("events").OrderBy("seq", firestore.Asc)).GetAll()
+		if err != nil {
+			return err
+		}
+		latest := foldEvents(eventsFrom(docs, 0), squad)
+		for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+			for i := range players {
+				if stats, ok := latest.players[players[i].PlayerID]; ok {
+					players[i].LiveStats = *stats
+				} else {
+					players[i].LiveStats = *emptyLiveStats()
+				}
+			}
+		}
+		scored := *match
+		scored.SetScores = make([]SetScore, len(latest.setScores))
+		for i := range latest.setScores {
+			scored.SetScores[i] = latest.setScore(i + 1)
+		}
+		if err := scored.Settle(time.Now().UTC()); err != nil {
+			return errorf(ErrConflict, "Event log score does not settle: %v", err)
+		}
+		scoreMatchSquad(squad, scored.SetScores)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if written == nil {
+		return nil, errorf(ErrNotFound, "Match squad not found")
+	}
+	updated, err := s.recomputeMatchPoints(ctx, matchID, written)
+	if err != nil {
+		return nil, err
+	}
+	state := foldEvents(logged.events, &logged.squad)
+	result := &MatchEventResult{
+		EventCount:       len(logged.events),
+		CurrentSet:       state.currentSet,
+		SetInProgress:    state.inSet,
+		SetScores:        state.setScores,
+		Match:            match,
+		UserTeamsUpdated: updated,
+	}
+	if logged.event.Seq != 0 {
+		result.Event = &logged.event
+	}
+	return result, nil
+}
+
+func (s *Server) loadMatchEvents(ctx context.Context, matchID string) ([]MatchEvent, error) {
+	docs, err := s.matchEventLog(matchID).Collection("events").OrderBy("seq", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return eventsFrom(docs, 0), nil
+}
+
+// Decode event documents, leaving room to append extra more
+func eventsFrom(docs []*firestore.DocumentSnapshot, extra int) []MatchEvent {
+	events := make([]MatchEvent, 0, len(docs)+extra)
+	for _, doc := range docs {
+		var ev MatchEvent
+		doc.DataTo(&ev)
+		events = append(events, ev)
+	}
+	return events
+}
+
+// Admin: Append an event to a match's log and rederive live stats
+func (s *Server) createMatchEvent(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	var req MatchEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	if req.Type == models.EventUndo {
+		writeError(w, r, errorf(ErrInvalidRequest, "Use the undo endpoint to undo an event"))
+		return
+	}
+	adminID, _ := r.Context().Value("adminID").(string)
+	ev := MatchEvent{
+		Type:          req.Type,
+		Set:           req.Set,
+		TeamID:        req.TeamID,
+		PlayerID:      req.PlayerID,
+		PlayerInID:    req.PlayerInID,
+		PlayerOutID:   req.PlayerOutID,
+		Team1Starters: req.Team1Starters,
+		Team2Starters: req.Team2Starters,
+		RecordedBy:    adminID,
+	}
+	if req.Timestamp != "" {
+		t, err := parseTimestamp(req.Timestamp, time.UTC)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		ev.Timestamp = t
+	}
+
+	ctx := r.Context()
+	logged, err := s.appendMatchEvent(ctx, matchId, func(state *matchState, squad *MatchSquad) (MatchEvent, error) {
+		return ev, validateMatchEvent(&ev, state, squad)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := s.rebuildLiveStats(ctx, matchId, logged)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// Admin: Undo the latest event that hasn't been undone. The undo is itself
+// appended to the log, so the history stays intact.
+func (s *Server) undoMatchEvent(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+	adminID, _ := r.Context().Value("adminID").(string)
+
+	ctx := r.Context()
+	logged, err := s.appendMatchEvent(ctx, matchId, func(state *matchState, _ *MatchSquad) (MatchEvent, error) {
+		if state.lastUndoable == 0 {
+			return MatchEvent{}, errorf(ErrConflict, "Nothing to undo")
+		}
+		return MatchEvent{Type: models.EventUndo, Set: state.currentSet, UndoesSeq: state.lastUndoable, RecordedBy: adminID}, nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := s.rebuildLiveStats(ctx, matchId, logged)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Admin: Get a match's full event log, undos included
+func (s *Server) getMatchEvents(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+	events, err := s.loadMatchEvents(r.Context(), matchId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// Admin: Rebuild a match's scoreboard, squad live stats and user team points
+// from the event log
+func (s *Server) recomputeMatchEvents(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	logged, err := s.appendMatchEvent(ctx, matchId, nil)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := s.rebuildLiveStats(ctx, matchId, logged)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func rallies(seq *int, set int, teamID string, n int) []MatchEvent {
+	events := make([]MatchEvent, n)
+	for i := range events {
+		*seq++
+		events[i] = MatchEvent{Seq: *seq, Type: models.EventRallyWon, Set: set, TeamID: teamID}
+	}
+	return events
+}
+
+func TestFoldEvents(t *testing.T) {
+	squad := &MatchSquad{Team1ID: "t1", Team2ID: "t2"}
+	events := []MatchEvent{
+		{Seq: 1, Type: models.EventSetStart, Set: 1, Team1Starters: []string{"a1", "a2"}, Team2Starters: []string{"b1"}},
+		{Seq: 2, Type: models.EventRallyWon, Set: 1, TeamID: "t1"},
+		{Seq: 3, Type: models.EventAttackKill, Set: 1, TeamID: "t1", PlayerID: "a1"},
+		{Seq: 4, Type: models.EventRallyWon, Set: 1, TeamID: "t2"},
+		{Seq: 5, Type: models.EventAce, Set: 1, TeamID: "t2", PlayerID: "b1"},
+		{Seq: 6, Type: models.EventSubstitution, Set: 1, TeamID: "t1", PlayerInID: "a3", PlayerOutID: "a2"},
+		{Seq: 7, Type: models.EventBlock, Set: 1, TeamID: "t1", PlayerID: "a3"},
+		{Seq: 8, Type: models.EventRallyWon, Set: 1, TeamID: "t1"},
+		{Seq: 9, Type: models.EventReceptionError, Set: 1, TeamID: "t2", PlayerID: "b2"}, // libero on without a substitution
+		{Seq: 10, Type: models.EventSetEnd, Set: 1},
+		{Seq: 11, Type: models.EventSetStart, Set: 2, Team1Starters: []string{"a1", "a3"}, Team2Starters: []string{"b1"}},
+		{Seq: 12, Type: models.EventRallyWon, Set: 2, TeamID: "t2"},
+		{Seq: 13, Type: models.EventSubstitution, Set: 2, TeamID: "t1", PlayerInID: "a2", PlayerOutID: "a3"},
+		{Seq: 14, Type: models.EventAttackKill, Set: 2, TeamID: "t1", PlayerID: "a2"},
+	}
+	state := foldEvents(events, squad)
+
+	if state.currentSet != 2 || !state.inSet {
+		t.Errorf("current set %d in progress %v, want set 2 in progress", state.currentSet, state.inSet)
+	}
+	if want := [][2]int{{2, 1}, {0, 1}}; !reflect.DeepEqual(state.setScores, want) {
+		t.Errorf("set scores %v, want %v", state.setScores, want)
+	}
+	if state.servingTeam != "t2" || state.lastUndoable != 14 {
+		t.Errorf("serving %q, last undoable %d; want t2, 14", state.servingTeam, state.lastUndoable)
+	}
+
+	tests := []struct {
+		playerID                   string
+		attacks, aces, blocks, rec int
+		played, started, subbed    []int
+	}{
+		{"a1", 1, 0, 0, 0, []int{1, 2}, []int{1, 2}, []int{}},
+		{"a2", 1, 0, 0, 0, []int{1, 2}, []int{1}, []int{2}},
+		{"a3", 0, 0, 1, 0, []int{1, 2}, []int{2}, []int{1}},
+		{"b1", 0, 1, 0, 0, []int{1, 2}, []int{1, 2}, []int{}},
+		{"b2", 0, 0, 0, 1, []int{1}, []int{}, []int{1}},
+	}
+	for _, tt := range tests {
+		stats := state.players[tt.playerID]
+		if stats == nil {
+			t.Errorf("%s: no stats", tt.playerID)
+			continue
+		}
+		if stats.Attacks != tt.attacks || stats.Aces != tt.aces || stats.Blocks != tt.blocks || stats.ReceptionErrors != tt.rec {
+			t.Errorf("%s: attacks %d aces %d blocks %d reception errors %d; want %d %d %d %d", tt.playerID,
+				stats.Attacks, stats.Aces, stats.Blocks, stats.ReceptionErrors, tt.attacks, tt.aces, tt.blocks, tt.rec)
+		}
+		if !reflect.DeepEqual(stats.SetsPlayed, tt.played) || !reflect.DeepEqual(stats.SetsAsStarter, tt.started) || !reflect.DeepEqual(stats.SetsAsSubstitute, tt.subbed) {
+			t.Errorf("%s: played %v started %v subbed %v; want %v %v %v", tt.playerID,
+				stats.SetsPlayed, stats.SetsAsStarter, stats.SetsAsSubstitute, tt.played, tt.started, tt.subbed)
+		}
+	}
+}
+
+func TestFoldEventsUndo(t *testing.T) {
+	squad := &MatchSquad{Team1ID: "t1", Team2ID: "t2"}
+	events := []MatchEvent{
+		{Seq: 1, Type: models.EventSetStart, Set: 1, Team1Starters: []string{"a1"}, Team2Starters: []string{"b1"}},
+		{Seq: 2, Type: models.EventRallyWon, Set: 1, TeamID: "t1"},
+		{Seq: 3, Type: models.EventAttackKill, Set: 1, TeamID: "t1", PlayerID: "a1"},
+		{Seq: 4, Type: models.EventRallyWon, Set: 1, TeamID: "t2"},
+		{Seq: 5, Type: models.EventSubstitution, Set: 1, TeamID: "t1", PlayerInID: "a2", PlayerOutID: "a1"},
+		{Seq: 6, Type: models.EventUndo, Set: 1, UndoesSeq: 5},
+		{Seq: 7, Type: models.EventUndo, Set: 1, UndoesSeq: 4},
+		{Seq: 8, Type: models.EventSetEnd, Set: 1},
+		{Seq: 9, Type: models.EventUndo, Set: 1, UndoesSeq: 8},
+	}
+	state := foldEvents(events, squad)
+
+	if want := [][2]int{{1, 0}}; !reflect.DeepEqual(state.setScores, want) {
+		t.Errorf("set scores %v, want %v", state.setScores, want)
+	}
+	if state.servingTeam != "t1" {
+		t.Errorf("serving %q after undoing t2's rally, want t1", state.servingTeam)
+	}
+	if !state.inSet || state.currentSet != 1 {
+		t.Errorf("set 1 in progress %v after undoing its end, want true", state.inSet)
+	}
+	if state.players["a1"].Attacks != 1 {
+		t.Errorf("a1 attacks %d, want 1", state.players["a1"].Attacks)
+	}
+	if _, ok := state.players["a2"]; ok {
+		t.Error("undone substitution still credits a2 with the set")
+	}
+	// Undos themselves can't be undone; the latest live event is the kill
+	if state.lastUndoable != 3 {
+		t.Errorf("last undoable %d, want 3", state.lastUndoable)
+	}
+}
+
+func TestFoldEventsDecided(t *testing.T) {
+	squad := &MatchSquad{Team1ID: "t1", Team2ID: "t2"}
+	seq := 0
+	var events []MatchEvent
+	for set := 1; set <= models.SetsToWin; set++ {
+		seq++
+		events = append(events, MatchEvent{Seq: seq, Type: models.EventSetStart, Set: set})
+		events = append(events, rallies(&seq, set, "t2", 23)...)
+		events = append(events, rallies(&seq, set, "t1", 25)...)
+		if set < models.SetsToWin {
+			if state := foldEvents(events, squad); state.decided() {
+				t.Fatalf("decided after %d sets", set)
+			}
+		}
+		seq++
+		events = append(events, MatchEvent{Seq: seq, Type: models.EventSetEnd, Set: set})
+	}
+	state := foldEvents(events, squad)
+	if !state.decided() {
+		t.Errorf("not decided after t1 won %d sets: %v", models.SetsToWin, state.setScores)
+	}
+	if got := state.setScore(1); got.Team1Points != 25 || got.Team2Points != 23 {
+		t.Errorf("set 1 score %+v, want 25-23", got)
+	}
+	if got := state.setScore(models.SetsToWin + 1); got != (SetScore{}) {
+		t.Errorf("unplayed set score %+v, want zero", got)
+	}
+}
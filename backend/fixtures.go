@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/fixtures"
+	"fantasy-volleyball-backend/models"
+)
+
+// Round-robin schedule to generate for a league. Dates and slots are read in
+// the league's timezone.
+type FixtureRequest struct {
+	TeamIDs      []string `json:"teamIds"` // defaults to every team in the league
+	Double       bool     `json:"double"`  // home and away legs
+	StartDate    string   `json:"startDate"`
+	EndDate      string   `json:"endDate"`
+	DailySlots   []string `json:"dailySlots"` // kick-off times, HH:MM
+	Venues       []string `json:"venues"`
+	RestDays     int      `json:"restDays"`
+	ExcludeDates []string `json:"excludeDates"`
+	DryRun       bool     `json:"dryRun"`
+}
+
+type FixtureResult struct {
+	LeagueID string  `json:"leagueId"`
+	DryRun   bool    `json:"dryRun"`
+	Rounds   int     `json:"rounds"`
+	Matches  []Match `json:"matches"`
+}
+
+// Knockout bracket to create for a league's playoffs
+type BracketRequest struct {
+	Name       string            `json:"name"`
+	Size       int               `json:"size"` // 2 to 8 teams from the top of the standings; top seeds get byes below 4 or 8
+	ThirdPlace bool              `json:"thirdPlace"`
+	Venue      string            `json:"venue"`
+	StartTimes map[string]string `json:"startTimes"` // fixture key (QF1, SF2, F, 3P) -> kick-off
+}
+
+type BracketResult struct {
+	Bracket models.Bracket `json:"bracket"`
+	Matches []Match        `json:"matches"`
+}
+
+// Admin: Generate a league's round-robin fixtures as matches
+func (s *Server) generateFixtures(w http.ResponseWriter, r *http.Request) {
+	leagueId := mux.Vars(r)["leagueId"]
+
+	var req FixtureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+
+	ctx := r.Context()
+	loc, err := s.leagueLocation(ctx, leagueId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	_, teams, err := s.standingsInputs(ctx, leagueId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	teamIDs := req.TeamIDs
+	if len(teamIDs) == 0 {
+		for teamID := range teams {
+			teamIDs = append(teamIDs, teamID)
+		}
+		sort.Slice(teamIDs, func(i, j int) bool {
+			return strings.ToLower(teams[teamIDs[i]].Name) < strings.ToLower(teams[teamIDs[j]].Name)
+		})
+	}
+	for _, teamID := range teamIDs {
+		if _, ok := teams[teamID]; !ok {
+			writeError(w, r, errorf(ErrInvalidRequest, "Team %s is not in league %s", teamID, leagueId))
+			return
+		}
+	}
+
+	cal := fixtures.Calendar{
+		DailySlots:   req.DailySlots,
+		Venues:       req.Venues,
+		RestDays:     req.RestDays,
+		ExcludeDates: req.ExcludeDates,
+	}
+	if cal.StartDate, err = time.ParseInLocation("2006-01-02", req.StartDate, loc); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "startDate must be YYYY-MM-DD"))
+		return
+	}
+	if cal.EndDate, err = time.ParseInLocation("2006-01-02", req.EndDate, loc); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "endDate must be YYYY-MM-DD"))
+		return
+	}
+
+	pairings, err := fixtures.RoundRobin(teamIDs, req.Double)
+	if err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "%v", err))
+		return
+	}
+	scheduled, err := fixtures.Schedule(pairings, cal)
+	if err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "%v", err))
+		return
+	}
+
+	now := time.Now().UTC()
+	result := FixtureResult{LeagueID: leagueId, DryRun: req.DryRun, Matches: make([]Match, len(scheduled))}
+	for i, f := range scheduled {
+		result.Matches[i] = Match{
+			MatchID:   fmt.Sprintf("match_%d", now.UnixNano()+int64(i)),
+			LeagueID:  leagueId,
+			Team1ID:   f.Home,
+			Team2ID:   f.Away,
+			Team1:     teams[f.Home],
+			Team2:     teams[f.Away],
+			StartTime: f.StartTime.UTC(),
+			Status:    models.MatchUpcoming,
+			Venue:     f.Venue,
+			Round:     fmt.Sprintf("Round %d", f.Round),
+			Stage:     models.StageLeague,
+			CreatedAt: now,
+		}
+		result.Rounds = max(result.Rounds, f.Round)
+	}
+	if req.DryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	// Generating twice would double every fixture
+	existing, err := s.firestoreClient.Collection("matches").Where("leagueId", "==", leagueId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	leagueMatches := 0
+	for _, doc := range existing {
+		var match Match
+		doc.DataTo(&match)
+		if match.LeagueStage() {
+			leagueMatches++
+		}
+	}
+	if leagueMatches > 0 {
+		writeError(w, r, errorf(ErrConflict, "League %s already has %d league-stage matches; delete them before generating fixtures", leagueId, leagueMatches))
+		return
+	}
+
+	if err := s.createMatches(ctx, result.Matches, nil); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// Create matches, and optionally a bracket, in batches
+func (s *Server) createMatches(ctx context.Context, matches []Match, bracket *models.Bracket) error {
+	batch := s.firestoreClient.Batch()
+	pending := 0
+	if bracket != nil {
+		batch.Create(s.firestoreClient.Collection("brackets").Doc(bracket.BracketID), bracket)
+		pending++
+	}
+	for _, match := range matches {
+		batch.Create(s.firestoreClient.Collection("matches").Doc(match.MatchID), match)
+		pending++
+		if pending == maxBatchWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch = s.firestoreClient.Batch()
+			pending = 0
+		}
+	}
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Admin: Create a knockout bracket seeded from the standings. Its fixtures are
+// written as matches whose teams are filled in as they are decided.
+func (s *Server) createBracket(w http.ResponseWriter, r *http.Request) {
+	leagueId := mux.Vars(r)["leagueId"]
+
+	var req BracketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	rounds, err := fixtures.KnockoutBracket(req.Size, req.ThirdPlace)
+	if err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "%v", err))
+		return
+	}
+
+	ctx := r.Context()
+	loc, err := s.leagueLocation(ctx, leagueId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	bracket := models.Bracket{
+		BracketID: fmt.Sprintf("bracket_%d", now.UnixNano()),
+		LeagueID:  leagueId,
+		Name:      req.Name,
+		Rounds:    rounds,
+		CreatedAt: now,
+	}
+	if bracket.Name == "" {
+		bracket.Name = "Playoffs"
+	}
+
+	var matches []Match
+	for i := range bracket.Rounds {
+		for j := range bracket.Rounds[i].Fixtures {
+			f := &bracket.Rounds[i].Fixtures[j]
+			startTime, err := parseTimestamp(req.StartTimes[f.Key], loc)
+			if err != nil {
+				writeError(w, r, errorf(ErrInvalidRequest, "startTimes.%s: %v", f.Key, err))
+				return
+			}
+			f.MatchID = fmt.Sprintf("match_%d", now.UnixNano()+int64(len(matches)))
+			matches = append(matches, Match{
+				MatchID:    f.MatchID,
+				LeagueID:   leagueId,
+				Team1:      TeamInfo{Name: f.Team1.Label(), Code: "TBD"},
+				Team2:      TeamInfo{Name: f.Team2.Label(), Code: "TBD"},
+				StartTime:  startTime,
+				Status:     models.MatchUpcoming,
+				Venue:      req.Venue,
+				Round:      f.Name,
+				Stage:      models.StagePlayoff,
+				BracketID:  bracket.BracketID,
+				BracketKey: f.Key,
+				CreatedAt:  now,
+			})
+		}
+	}
+
+	if err := s.createMatches(ctx, matches, &bracket); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	result, err := s.advanceBracket(ctx, &bracket, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// Get a league's playoff brackets (public endpoint)
+func (s *Server) getLeagueBrackets(w http.ResponseWriter, r *http.Request) {
+	leagueId := mux.Vars(r)["leagueId"]
+
+	docs, err := s.firestoreClient.Collection("brackets").Where("leagueId", "==", leagueId).Documents(r.Context()).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	brackets := make([]models.Bracket, 0, len(docs))
+	for _, doc := range docs {
+		var bracket models.Bracket
+		doc.DataTo(&bracket)
+		brackets = append(brackets, bracket)
+	}
+	sort.Slice(brackets, func(i, j int) bool { return brackets[i].CreatedAt.Before(brackets[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, brackets)
+}
+
+// Admin: Seed a bracket from the current standings, even if league matches
+// remain, and fill in every team already decided
+func (s *Server) advanceBracketNow(w http.ResponseWriter, r *http.Request) {
+	bracketId := mux.Vars(r)["bracketId"]
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("brackets").Doc(bracketId), "Bracket")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var bracket models.Bracket
+	doc.DataTo(&bracket)
+
+	result, err := s.advanceBracket(ctx, &bracket, true)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Advance every bracket in a league after one of its matches completed or had
+// its result corrected. Failures are logged; the admin advance endpoint
+// retries them.
+func (s *Server) advanceLeagueBrackets(ctx context.Context, leagueID string) {
+	docs, err := s.firestoreClient.Collection("brackets").Where("leagueId", "==", leagueID).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Brackets for league %s not advanced: %v", leagueID, err)
+		return
+	}
+	for _, doc := range docs {
+		var bracket models.Bracket
+		doc.DataTo(&bracket)
+		if _, err := s.advanceBracket(ctx, &bracket, false); err != nil {
+			log.Printf("Bracket %s not advanced: %v", bracket.BracketID, err)
+		}
+	}
+}
+
+// Whether every league-stage match in the league is completed. Cancelled
+// fixtures keep their status but no longer count.
+func (s *Server) leagueStageComplete(ctx context.Context, leagueID string) (bool, error) {
+	docs, err := s.firestoreClient.Collection("matches").
+		Where("leagueId", "==", leagueID).
+		Where("status", "in", []string{models.MatchUpcoming, models.MatchLive}).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return false, err
+	}
+	unfinished := make([]Match, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&unfinished[i])
+	}
+	return models.LeagueStageComplete(unfinished), nil
+}
+
+// Fill in the bracket's teams that are decided: standings seeds once the league
+// stage is complete (or at once with seedNow), winners and losers once their
+// fixture is completed. Fixtures that have started keep their teams. Seeds
+// taken from the final standings are fixed on the bracket and not resolved
+// again, though seedNow still resolves them from the table.
+func (s *Server) advanceBracket(ctx context.Context, bracket *models.Bracket, seedNow bool) (*BracketResult, error) {
+	refs := []*firestore.DocumentRef{}
+	for _, round := range bracket.Rounds {
+		for _, f := range round.Fixtures {
+			refs = append(refs, s.firestoreClient.Collection("matches").Doc(f.MatchID))
+		}
+	}
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	matches := map[string]*Match{}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var match Match
+		doc.DataTo(&match)
+		matches[doc.Ref.ID] = &match
+	}
+
+	final := false
+	if bracket.SeededAt.IsZero() {
+		if final, err = s.leagueStageComplete(ctx, bracket.LeagueID); err != nil {
+			return nil, err
+		}
+	}
+	seedFromStandings := seedNow || final
+	var rows []models.StandingsRow
+	if seedFromStandings {
+		doc, err := s.standingsRef(bracket.LeagueID).Get(ctx)
+		if err == nil {
+			var standings models.Standings
+			doc.DataTo(&standings)
+			rows = standings.Rows
+		}
+	}
+
+	changed := map[string]bool{}
+	seeded := final && len(rows) > 0
+	for i := range bracket.Rounds {
+		for j := range bracket.Rounds[i].Fixtures {
+			f := &bracket.Rounds[i].Fixtures[j]
+			match := matches[f.MatchID]
+			if match == nil || match.Status != models.MatchUpcoming {
+				continue
+			}
+			for _, side := range []struct {
+				source *models.TeamSource
+				teamID *string
+				info   *TeamInfo
+			}{{&f.Team1, &match.Team1ID, &match.Team1}, {&f.Team2, &match.Team2ID, &match.Team2}} {
+				if side.source.Standing > 0 && !seedFromStandings {
+					continue // seeds stay until the standings are final, then are fixed
+				}
+				teamID, info, decided := resolveTeamSource(*side.source, bracket, matches, rows)
+				if !decided {
+					if side.source.Standing > 0 {
+						seeded = false
+						continue
+					}
+					teamID, info = "", TeamInfo{Name: side.source.Label(), Code: "TBD"}
+				}
+				if teamID == *side.teamID && info == *side.info {
+					continue
+				}
+				side.source.TeamID = teamID
+				*side.teamID, *side.info = teamID, info
+				changed[f.MatchID] = true
+			}
+		}
+	}
+
+	if seeded {
+		bracket.SeededAt = time.Now().UTC()
+	}
+	if len(changed) > 0 || seeded {
+		batch := s.firestoreClient.Batch()
+		for matchID := range changed {
+			match := matches[matchID]
+			batch.Update(s.firestoreClient.Collection("matches").Doc(matchID), []firestore.Update{
+				{Path: "team1Id", Value: match.Team1ID},
+				{Path: "team2Id", Value: match.Team2ID},
+				{Path: "team1", Value: match.Team1},
+				{Path: "team2", Value: match.Team2},
+			})
+		}
+		batch.Set(s.firestoreClient.Collection("brackets").Doc(bracket.BracketID), bracket)
+		if _, err := batch.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BracketResult{Bracket: *bracket, Matches: []Match{}}
+	for _, round := range bracket.Rounds {
+		for _, f := range round.Fixtures {
+			if match := matches[f.MatchID]; match != nil {
+				result.Matches = append(result.Matches, *match)
+			}
+		}
+	}
+	return result, nil
+}
+
+// The team a source names, if it is decided yet
+func resolveTeamSource(source models.TeamSource, bracket *models.Bracket, matches map[string]*Match, rows []models.StandingsRow) (string, TeamInfo, bool) {
+	if source.Standing > 0 {
+		if source.Standing > len(rows) {
+			return "", TeamInfo{}, false
+		}
+		row := rows[source.Standing-1]
+		return row.TeamID, row.Team, true
+	}
+
+	key := source.WinnerOf
+	if key == "" {
+		key = source.LoserOf
+	}
+	from := bracket.Fixture(key)
+	if from == nil {
+		return "", TeamInfo{}, false
+	}
+	match := matches[from.MatchID]
+	if match == nil || match.Status != models.MatchCompleted || match.WinnerTeamID == "" {
+		return "", TeamInfo{}, false
+	}
+	team1Won := match.WinnerTeamID == match.Team1ID
+	if team1Won == (source.WinnerOf != "") {
+		return match.Team1ID, match.Team1, true
+	}
+	return match.Team2ID, match.Team2, true
+}
@@ -0,0 +1,105 @@
+package fixtures
+
+import (
+	"fmt"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Standard knockout bracket for the top size teams in the standings, seeded so
+// the top two can only meet in the final (1 v 8, 4 v 5, 2 v 7, 3 v 6). Below a
+// full field of 2, 4 or 8 the top seeds get byes into the second round, and
+// their first-round fixtures are left out. With thirdPlace the losing
+// semi-finalists play off for third.
+func KnockoutBracket(size int, thirdPlace bool) ([]models.BracketRound, error) {
+	if size < 2 || size > 8 {
+		return nil, fmt.Errorf("bracket size must be 2 to 8, got %d", size)
+	}
+	if thirdPlace && size < 4 {
+		return nil, fmt.Errorf("a third-place match needs at least 4 teams")
+	}
+	field := 2
+	for field < size {
+		field *= 2
+	}
+
+	names := map[int]struct{ round, prefix string }{
+		8: {"Quarter-finals", "QF"},
+		4: {"Semi-finals", "SF"},
+		2: {"Final", "F"},
+	}
+	// Each slot of the round being built: the fixture its team comes out of,
+	// or the seed that got a bye into it
+	type slot struct {
+		key  string
+		seed int
+	}
+	order := seedOrder(field)
+	first := names[field]
+	round := models.BracketRound{Name: first.round}
+	slots := make([]slot, 0, field/2)
+	for i := 0; i < field; i += 2 {
+		high, low := order[i], order[i+1]
+		if low > size {
+			slots = append(slots, slot{seed: high})
+			continue
+		}
+		f := fixture(first.prefix, i/2+1, field/2, first.round,
+			models.TeamSource{Standing: high}, models.TeamSource{Standing: low})
+		round.Fixtures = append(round.Fixtures, f)
+		slots = append(slots, slot{key: f.Key})
+	}
+	rounds := []models.BracketRound{round}
+
+	source := func(s slot) models.TeamSource {
+		if s.key == "" {
+			return models.TeamSource{Standing: s.seed}
+		}
+		return models.TeamSource{WinnerOf: s.key}
+	}
+	for teams := field / 2; teams >= 2; teams /= 2 {
+		prev := rounds[len(rounds)-1].Fixtures
+		next := names[teams]
+		round := models.BracketRound{Name: next.round}
+		nextSlots := make([]slot, 0, len(slots)/2)
+		for i := 0; i < len(slots); i += 2 {
+			f := fixture(next.prefix, i/2+1, len(slots)/2, next.round, source(slots[i]), source(slots[i+1]))
+			round.Fixtures = append(round.Fixtures, f)
+			nextSlots = append(nextSlots, slot{key: f.Key})
+		}
+		if teams == 2 && thirdPlace {
+			round.Fixtures = append(round.Fixtures, models.BracketFixture{
+				Key:   "3P",
+				Name:  "Third-place match",
+				Team1: models.TeamSource{LoserOf: prev[0].Key},
+				Team2: models.TeamSource{LoserOf: prev[1].Key},
+			})
+		}
+		rounds = append(rounds, round)
+		slots = nextSlots
+	}
+	return rounds, nil
+}
+
+// Seeds in bracket order for a field of 2, 4 or 8, each paired with the one
+// after it: every seed s meets field+1-s, and the halves only meet in the final
+func seedOrder(field int) []int {
+	order := []int{1, 2}
+	for n := 4; n <= field; n *= 2 {
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+func fixture(prefix string, n, of int, roundName string, team1, team2 models.TeamSource) models.BracketFixture {
+	f := models.BracketFixture{Key: prefix, Name: roundName, Team1: team1, Team2: team2}
+	if of > 1 {
+		f.Key = fmt.Sprintf("%s%d", prefix, n)
+		f.Name = fmt.Sprintf("%s %d", roundName[:len(roundName)-1], n) // "Semi-finals" -> "Semi-final 2"
+	}
+	return f
+}
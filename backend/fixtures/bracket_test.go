@@ -0,0 +1,199 @@
+package fixtures
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		field int
+		want  []int
+	}{
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+	for _, tt := range tests {
+		if got := seedOrder(tt.field); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("seedOrder(%d) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestKnockoutBracket(t *testing.T) {
+	tests := []struct {
+		size   int
+		rounds map[string]string // fixture key -> team sources
+	}{
+		{2, map[string]string{"F": "Position 1 v Position 2"}},
+		{3, map[string]string{
+			"SF2": "Position 2 v Position 3",
+			"F":   "Position 1 v Winner SF2",
+		}},
+		{4, map[string]string{
+			"SF1": "Position 1 v Position 4",
+			"SF2": "Position 2 v Position 3",
+			"F":   "Winner SF1 v Winner SF2",
+		}},
+		{5, map[string]string{
+			"QF2": "Position 4 v Position 5",
+			"SF1": "Position 1 v Winner QF2",
+			"SF2": "Position 2 v Position 3",
+			"F":   "Winner SF1 v Winner SF2",
+		}},
+		{6, map[string]string{
+			"QF2": "Position 4 v Position 5",
+			"QF4": "Position 3 v Position 6",
+			"SF1": "Position 1 v Winner QF2",
+			"SF2": "Position 2 v Winner QF4",
+			"F":   "Winner SF1 v Winner SF2",
+		}},
+		{8, map[string]string{
+			"QF1": "Position 1 v Position 8",
+			"QF2": "Position 4 v Position 5",
+			"QF3": "Position 2 v Position 7",
+			"QF4": "Position 3 v Position 6",
+			"SF1": "Winner QF1 v Winner QF2",
+			"SF2": "Winner QF3 v Winner QF4",
+			"F":   "Winner SF1 v Winner SF2",
+		}},
+	}
+	for _, tt := range tests {
+		rounds, err := KnockoutBracket(tt.size, false)
+		if err != nil {
+			t.Fatalf("size %d: %v", tt.size, err)
+		}
+		got := map[string]string{}
+		for _, round := range rounds {
+			for _, f := range round.Fixtures {
+				got[f.Key] = f.Team1.Label() + " v " + f.Team2.Label()
+			}
+		}
+		if !reflect.DeepEqual(got, tt.rounds) {
+			t.Errorf("size %d: fixtures %v, want %v", tt.size, got, tt.rounds)
+		}
+		if last := rounds[len(rounds)-1]; last.Name != "Final" || len(last.Fixtures) != 1 {
+			t.Errorf("size %d: last round %+v, want the final alone", tt.size, last)
+		}
+	}
+}
+
+// Every seed plays its way to the final along one path, and the top two seeds
+// only meet there
+func TestKnockoutBracketWinnerAdvancement(t *testing.T) {
+	for size := 2; size <= 8; size++ {
+		rounds, err := KnockoutBracket(size, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bracket := models.Bracket{Rounds: rounds}
+
+		fed := map[string]int{} // fixture key -> fixtures its winner plays in
+		seeds := map[int]string{}
+		for _, round := range rounds {
+			for _, f := range round.Fixtures {
+				for _, source := range []models.TeamSource{f.Team1, f.Team2} {
+					switch {
+					case source.WinnerOf != "":
+						if bracket.Fixture(source.WinnerOf) == nil {
+							t.Fatalf("size %d: %s takes the winner of missing fixture %s", size, f.Key, source.WinnerOf)
+						}
+						fed[source.WinnerOf]++
+					case source.Standing > 0:
+						if seeds[source.Standing] != "" {
+							t.Fatalf("size %d: seed %d placed twice", size, source.Standing)
+						}
+						seeds[source.Standing] = f.Key
+					}
+				}
+			}
+		}
+		for _, round := range rounds {
+			for _, f := range round.Fixtures {
+				want := 1
+				if f.Key == "F" {
+					want = 0
+				}
+				if fed[f.Key] != want {
+					t.Errorf("size %d: winner of %s plays in %d fixtures, want %d", size, f.Key, fed[f.Key], want)
+				}
+			}
+		}
+		placed := make([]int, 0, len(seeds))
+		for seed := range seeds {
+			placed = append(placed, seed)
+		}
+		sort.Ints(placed)
+		if len(placed) != size || placed[0] != 1 || placed[len(placed)-1] != size {
+			t.Errorf("size %d: seeds placed %v, want 1 to %d", size, placed, size)
+		}
+
+		// Follow each of the top two seeds to the final
+		path := func(seed int) map[string]bool {
+			seen := map[string]bool{}
+			for key := seeds[seed]; key != ""; {
+				seen[key] = true
+				next := ""
+				for _, round := range rounds {
+					for _, f := range round.Fixtures {
+						if f.Team1.WinnerOf == key || f.Team2.WinnerOf == key {
+							next = f.Key
+						}
+					}
+				}
+				key = next
+			}
+			return seen
+		}
+		top, second := path(1), path(2)
+		if !top["F"] || !second["F"] {
+			t.Errorf("size %d: seeds 1 and 2 do not both reach the final", size)
+		}
+		for key := range top {
+			if key != "F" && second[key] {
+				t.Errorf("size %d: seeds 1 and 2 can meet in %s", size, key)
+			}
+		}
+	}
+}
+
+func TestKnockoutBracketThirdPlace(t *testing.T) {
+	for _, size := range []int{4, 5, 8} {
+		rounds, err := KnockoutBracket(size, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		final := rounds[len(rounds)-1]
+		semis := rounds[len(rounds)-2]
+		if len(final.Fixtures) != 2 {
+			t.Fatalf("size %d: final round has %d fixtures, want the final and third place", size, len(final.Fixtures))
+		}
+		third := final.Fixtures[1]
+		if third.Key != "3P" || third.Team1.LoserOf != semis.Fixtures[0].Key || third.Team2.LoserOf != semis.Fixtures[1].Key {
+			t.Errorf("size %d: third-place match %+v, want the semi-final losers", size, third)
+		}
+	}
+}
+
+func TestKnockoutBracketInvalid(t *testing.T) {
+	tests := []struct {
+		size       int
+		thirdPlace bool
+	}{
+		{0, false},
+		{1, false},
+		{9, false},
+		{16, false},
+		{2, true},
+		{3, true},
+	}
+	for _, tt := range tests {
+		if _, err := KnockoutBracket(tt.size, tt.thirdPlace); err == nil {
+			t.Errorf("KnockoutBracket(%d, %v) succeeded, want an error", tt.size, tt.thirdPlace)
+		}
+	}
+}
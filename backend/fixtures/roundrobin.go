@@ -0,0 +1,179 @@
+// Package fixtures builds league schedules: round-robin pairings placed into
+// dated slots under rest-day constraints, and standard knockout brackets.
+package fixtures
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// One match of a round: Home is listed as team 1
+type Pairing struct {
+	Round int
+	Home  string
+	Away  string
+}
+
+// Round-robin pairings by the circle method: every team meets every other once
+// per leg, and with an odd number of teams one team sits out each round. A
+// double round robin repeats the rounds with home and away swapped.
+func RoundRobin(teamIDs []string, double bool) ([]Pairing, error) {
+	if len(teamIDs) < 2 {
+		return nil, fmt.Errorf("a round robin needs at least 2 teams, got %d", len(teamIDs))
+	}
+	seen := map[string]bool{}
+	for _, id := range teamIDs {
+		if id == "" || seen[id] {
+			return nil, fmt.Errorf("team IDs must be distinct and non-empty")
+		}
+		seen[id] = true
+	}
+
+	teams := append([]string{}, teamIDs...)
+	if len(teams)%2 == 1 {
+		// The bye takes the fixed place, so every team rotates and sits out once
+		teams = append([]string{""}, teams...)
+	}
+	n := len(teams)
+	rounds := n - 1
+
+	var pairings []Pairing
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < n/2; i++ {
+			home, away := teams[i], teams[n-1-i]
+			if home == "" || away == "" {
+				continue
+			}
+			// Alternate the fixed team's side so home and away even out
+			if (i == 0 && round%2 == 1) || (i > 0 && i%2 == 1) {
+				home, away = away, home
+			}
+			pairings = append(pairings, Pairing{Round: round + 1, Home: home, Away: away})
+		}
+		// Rotate every team but the first one place clockwise
+		last := teams[n-1]
+		copy(teams[2:], teams[1:n-1])
+		teams[1] = last
+	}
+
+	if double {
+		first := len(pairings)
+		for _, p := range pairings[:first] {
+			pairings = append(pairings, Pairing{Round: p.Round + rounds, Home: p.Away, Away: p.Home})
+		}
+	}
+	return pairings, nil
+}
+
+// When and where fixtures may be played
+type Calendar struct {
+	StartDate    time.Time // first day, midnight in the league timezone
+	EndDate      time.Time // last day, inclusive
+	DailySlots   []string  // kick-off times, HH:MM in the league timezone
+	Venues       []string  // played in parallel; each slot can host one match per venue
+	RestDays     int       // full days a team must rest between matches
+	ExcludeDates []string  // YYYY-MM-DD days with no matches
+}
+
+type Fixture struct {
+	Pairing
+	StartTime time.Time
+	Venue     string
+}
+
+// Place pairings into the calendar round by round, each at the earliest free
+// slot where neither team plays that day or within its rest days. Fails if the
+// calendar runs out before every pairing is placed.
+func Schedule(pairings []Pairing, cal Calendar) ([]Fixture, error) {
+	if len(cal.DailySlots) == 0 {
+		return nil, fmt.Errorf("at least one daily slot is required")
+	}
+	venues := cal.Venues
+	if len(venues) == 0 {
+		venues = []string{""}
+	}
+	if cal.EndDate.Before(cal.StartDate) {
+		return nil, fmt.Errorf("endDate is before startDate")
+	}
+	if cal.RestDays < 0 {
+		return nil, fmt.Errorf("restDays cannot be negative")
+	}
+
+	loc := cal.StartDate.Location()
+	slots := make([]time.Time, len(cal.DailySlots))
+	for i, slot := range cal.DailySlots {
+		t, err := time.Parse("15:04", slot)
+		if err != nil {
+			return nil, fmt.Errorf("daily slot %q is not HH:MM", slot)
+		}
+		slots[i] = t
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+
+	excluded := map[string]bool{}
+	for _, day := range cal.ExcludeDates {
+		if _, err := time.ParseInLocation("2006-01-02", day, loc); err != nil {
+			return nil, fmt.Errorf("excluded date %q is not YYYY-MM-DD", day)
+		}
+		excluded[day] = true
+	}
+	var days []time.Time
+	for day := cal.StartDate; !day.After(cal.EndDate); day = day.AddDate(0, 0, 1) {
+		if !excluded[day.Format("2006-01-02")] {
+			days = append(days, day)
+		}
+	}
+
+	taken := map[[3]int]bool{}  // day, slot, venue
+	lastDay := map[string]int{} // team -> index into days of its latest match
+	roundStart, roundEnd := 0, 0
+	fixtures := make([]Fixture, 0, len(pairings))
+	for i, p := range pairings {
+		// A round starts no earlier than the last day of the round before
+		if i > 0 && p.Round != pairings[i-1].Round {
+			roundStart = roundEnd
+		}
+		placed := false
+		for d := roundStart; d < len(days) && !placed; d++ {
+			if !rested(lastDay, p.Home, d, days, cal.RestDays) || !rested(lastDay, p.Away, d, days, cal.RestDays) {
+				continue
+			}
+			for s := range slots {
+				for v := range venues {
+					if taken[[3]int{d, s, v}] {
+						continue
+					}
+					taken[[3]int{d, s, v}] = true
+					lastDay[p.Home], lastDay[p.Away] = d, d
+					roundEnd = max(roundEnd, d)
+					day, slot := days[d], slots[s]
+					fixtures = append(fixtures, Fixture{
+						Pairing:   p,
+						StartTime: time.Date(day.Year(), day.Month(), day.Day(), slot.Hour(), slot.Minute(), 0, 0, loc),
+						Venue:     venues[v],
+					})
+					placed = true
+					break
+				}
+				if placed {
+					break
+				}
+			}
+		}
+		if !placed {
+			return nil, fmt.Errorf("ran out of slots after placing %d of %d fixtures; widen the dates or add slots, venues or fewer rest days", len(fixtures), len(pairings))
+		}
+	}
+	return fixtures, nil
+}
+
+// Whether a team that last played on days[lastDay[team]] may play on days[d]
+func rested(lastDay map[string]int, team string, d int, days []time.Time, restDays int) bool {
+	last, ok := lastDay[team]
+	if !ok {
+		return true
+	}
+	gap := int(days[d].Sub(days[last]).Hours()/24 + 0.5)
+	return gap > restDays
+}
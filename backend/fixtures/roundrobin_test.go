@@ -0,0 +1,179 @@
+package fixtures
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func teamIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("t%d", i+1)
+	}
+	return ids
+}
+
+func TestRoundRobin(t *testing.T) {
+	for n := 2; n <= 9; n++ {
+		for _, double := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%d teams double=%v", n, double), func(t *testing.T) {
+				teams := teamIDs(n)
+				pairings, err := RoundRobin(teams, double)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				legRounds := n - 1
+				if n%2 == 1 {
+					legRounds = n
+				}
+				legs := 1
+				if double {
+					legs = 2
+				}
+				perLeg := n * (n - 1) / 2
+				if len(pairings) != legs*perLeg {
+					t.Fatalf("got %d pairings, want %d", len(pairings), legs*perLeg)
+				}
+
+				met := map[[2]string]int{} // home, away -> times
+				played := map[int]map[string]bool{}
+				for _, p := range pairings {
+					if p.Round < 1 || p.Round > legs*legRounds {
+						t.Fatalf("round %d outside 1..%d", p.Round, legs*legRounds)
+					}
+					if p.Home == p.Away {
+						t.Fatalf("round %d: %s plays itself", p.Round, p.Home)
+					}
+					if played[p.Round] == nil {
+						played[p.Round] = map[string]bool{}
+					}
+					for _, team := range []string{p.Home, p.Away} {
+						if played[p.Round][team] {
+							t.Fatalf("round %d: %s plays twice", p.Round, team)
+						}
+						played[p.Round][team] = true
+					}
+					met[[2]string{p.Home, p.Away}]++
+				}
+
+				// Each pair meets once per leg; a double round robin meets
+				// once each way round
+				for i, a := range teams {
+					for _, b := range teams[i+1:] {
+						ab, ba := met[[2]string{a, b}], met[[2]string{b, a}]
+						if ab+ba != legs {
+							t.Errorf("%s and %s meet %d times, want %d", a, b, ab+ba, legs)
+						}
+						if double && (ab != 1 || ba != 1) {
+							t.Errorf("%s hosts %s %d times and visits %d times, want 1 each", a, b, ab, ba)
+						}
+					}
+				}
+
+				// With an odd number of teams each sits out one round per leg
+				for _, team := range teams {
+					byes := 0
+					for round := 1; round <= legs*legRounds; round++ {
+						if !played[round][team] {
+							byes++
+						}
+					}
+					if want := legs * (legRounds - (n - 1)); byes != want {
+						t.Errorf("%s has %d byes, want %d", team, byes, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRoundRobinHomeAwayBalance(t *testing.T) {
+	for n := 2; n <= 9; n++ {
+		single, err := RoundRobin(teamIDs(n), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		double, err := RoundRobin(teamIDs(n), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		home, away := map[string]int{}, map[string]int{}
+		for _, p := range single {
+			home[p.Home]++
+			away[p.Away]++
+		}
+		for _, team := range teamIDs(n) {
+			if diff := home[team] - away[team]; diff < -1 || diff > 1 {
+				t.Errorf("%d teams: %s is at home %d times and away %d times in one leg", n, team, home[team], away[team])
+			}
+		}
+
+		// The second leg repeats the first with sides swapped
+		for i, p := range single {
+			second := double[len(single)+i]
+			if second.Home != p.Away || second.Away != p.Home || second.Round != p.Round+len(roundsOf(single)) {
+				t.Errorf("%d teams: second leg pairing %+v does not mirror %+v", n, second, p)
+			}
+		}
+	}
+}
+
+func roundsOf(pairings []Pairing) map[int]bool {
+	rounds := map[int]bool{}
+	for _, p := range pairings {
+		rounds[p.Round] = true
+	}
+	return rounds
+}
+
+func TestRoundRobinInvalidTeams(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"t1"},
+		{"t1", "t1"},
+		{"t1", ""},
+	}
+	for _, teams := range tests {
+		if _, err := RoundRobin(teams, false); err == nil {
+			t.Errorf("RoundRobin(%q) succeeded, want an error", teams)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	pairings := []Pairing{
+		{Round: 1, Home: "a", Away: "b"},
+		{Round: 1, Home: "c", Away: "d"},
+		{Round: 2, Home: "a", Away: "c"},
+		{Round: 2, Home: "b", Away: "d"},
+	}
+	fixtures, err := Schedule(pairings, Calendar{
+		StartDate:    start,
+		EndDate:      start.AddDate(0, 0, 9),
+		DailySlots:   []string{"18:00", "10:00"},
+		RestDays:     1,
+		ExcludeDates: []string{"2025-01-03"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC),
+		// A day's rest, then the 3rd is excluded
+		time.Date(2025, 1, 4, 10, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 4, 18, 0, 0, 0, time.UTC),
+	}
+	for i, f := range fixtures {
+		if !f.StartTime.Equal(want[i]) {
+			t.Errorf("fixture %d (%s v %s) at %v, want %v", i, f.Home, f.Away, f.StartTime, want[i])
+		}
+	}
+
+	if _, err := Schedule(pairings, Calendar{StartDate: start, EndDate: start.AddDate(0, 0, 1), DailySlots: []string{"10:00"}}); err == nil {
+		t.Error("Schedule fitted 4 fixtures into 2 single-slot days")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"fantasy-volleyball-backend/fixtures"
+	"fantasy-volleyball-backend/models"
+)
+
+func TestResolveTeamSource(t *testing.T) {
+	rounds, err := fixtures.KnockoutBracket(4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bracket := &models.Bracket{Rounds: rounds}
+	bracket.Fixture("SF1").MatchID = "sf1"
+	bracket.Fixture("SF2").MatchID = "sf2"
+
+	teams := map[string]TeamInfo{}
+	var rows []models.StandingsRow
+	for i, id := range []string{"a", "b", "c", "d"} {
+		teams[id] = TeamInfo{Name: "Team " + id, Code: id}
+		rows = append(rows, models.StandingsRow{Position: i + 1, TeamID: id, Team: teams[id]})
+	}
+	matches := map[string]*Match{
+		"sf1": {Status: models.MatchCompleted, Team1ID: "a", Team1: teams["a"], Team2ID: "d", Team2: teams["d"], WinnerTeamID: "d"},
+		"sf2": {Status: models.MatchLive, Team1ID: "b", Team1: teams["b"], Team2ID: "c", Team2: teams["c"]},
+	}
+
+	tests := []struct {
+		name    string
+		source  models.TeamSource
+		rows    []models.StandingsRow
+		teamID  string
+		decided bool
+	}{
+		{"top seed", models.TeamSource{Standing: 1}, rows, "a", true},
+		{"last seed", models.TeamSource{Standing: 4}, rows, "d", true},
+		{"seed beyond the table", models.TeamSource{Standing: 5}, rows, "", false},
+		{"seed before standings", models.TeamSource{Standing: 1}, nil, "", false},
+		{"winner of a completed fixture", models.TeamSource{WinnerOf: "SF1"}, nil, "d", true},
+		{"loser of a completed fixture", models.TeamSource{LoserOf: "SF1"}, nil, "a", true},
+		{"winner of a live fixture", models.TeamSource{WinnerOf: "SF2"}, nil, "", false},
+		{"winner of an unknown fixture", models.TeamSource{WinnerOf: "QF1"}, nil, "", false},
+	}
+	for _, tt := range tests {
+		teamID, info, decided := resolveTeamSource(tt.source, bracket, matches, tt.rows)
+		if teamID != tt.teamID || decided != tt.decided {
+			t.Errorf("%s: resolved %q, %v; want %q, %v", tt.name, teamID, decided, tt.teamID, tt.decided)
+		}
+		if decided && info != teams[teamID] {
+			t.Errorf("%s: team info %+v, want %+v", tt.name, info, teams[teamID])
+		}
+	}
+}
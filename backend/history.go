@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func playerRecordID(matchID, playerID string) string {
+	return fmt.Sprintf("%s_%s", matchID, playerID)
+}
+
+// Bring a match's player history in line with its squad after scoring. A
+// completed match gets a record for every player who took the court; records
+// of a match that is no longer completed, or of players who no longer played,
+// are removed. Pick rates come from the frozen counts once the match locked,
+// as the squad's own can lag the freeze. Scores are already saved, so failures
+// are logged and the next rescore writes them.
+func (s *Server) syncPlayerHistory(ctx context.Context, matchID string, squad *MatchSquad) {
+	if err := s.writePlayerHistory(ctx, matchID, squad); err != nil {
+		log.Printf("Player history for match %s not updated: %v", matchID, err)
+	}
+}
+
+func (s *Server) writePlayerHistory(ctx context.Context, matchID string, squad *MatchSquad) error {
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchID), "Match")
+	if err != nil {
+		return err
+	}
+	var match Match
+	doc.DataTo(&match)
+	counts, err := s.loadPicks(ctx, matchID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	records := map[string]models.PlayerMatchRecord{}
+	if match.Status == models.MatchCompleted && match.ArchivedAt.IsZero() {
+		for _, side := range []struct {
+			teamID, opponentID string
+			opponent           TeamInfo
+			players            []MatchSquadPlayer
+		}{
+			{match.Team1ID, match.Team2ID, match.Team2, squad.Team1Players},
+			{match.Team2ID, match.Team1ID, match.Team1, squad.Team2Players},
+		} {
+			for _, player := range side.players {
+				if !models.Played(player.LiveStats) {
+					continue
+				}
+				if !counts.FrozenAt.IsZero() {
+					counts.Apply(&player)
+				}
+				id := playerRecordID(matchID, player.PlayerID)
+				records[id] = models.PlayerMatchRecord{
+					RecordID:            id,
+					PlayerID:            player.PlayerID,
+					MatchID:             matchID,
+					LeagueID:            match.LeagueID,
+					TeamID:              side.teamID,
+					OpponentTeamID:      side.opponentID,
+					Opponent:            side.opponent,
+					Won:                 match.WinnerTeamID == side.teamID,
+					StartTime:           match.StartTime,
+					Stats:               player.LiveStats,
+					FantasyPoints:       player.LiveStats.TotalPoints,
+					Credits:             player.Credits,
+					SelectionPercentage: player.SelectionPercentage,
+					CaptainPercentage:   player.CaptainPercentage,
+					RecordedAt:          now,
+				}
+			}
+		}
+	}
+
+	history := s.firestoreClient.Collection("playerHistory")
+	stale, err := history.Where("matchId", "==", matchID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	var refs []*firestore.DocumentRef
+	for _, doc := range stale {
+		if _, ok := records[doc.Ref.ID]; !ok {
+			refs = append(refs, doc.Ref)
+		}
+	}
+	for id := range records {
+		refs = append(refs, history.Doc(id))
+	}
+
+	for start := 0; start < len(refs); start += maxBatchWrites {
+		batch := s.firestoreClient.Batch()
+		for _, ref := range refs[start:min(start+maxBatchWrites, len(refs))] {
+			if record, ok := records[ref.ID]; ok {
+				batch.Set(ref, record)
+			} else {
+				batch.Delete(ref)
+			}
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History records of the given players, by player ID
+func (s *Server) playerRecords(ctx context.Context, playerIDs []string) (map[string][]models.PlayerMatchRecord, error) {
+	records := map[string][]models.PlayerMatchRecord{}
+	for start := 0; start < len(playerIDs); start += maxInFilterValues {
+		chunk := playerIDs[start:min(start+maxInFilterValues, len(playerIDs))]
+		docs, err := s.firestoreClient.Collection("playerHistory").Where("playerId", "in", chunk).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			var record models.PlayerMatchRecord
+			doc.DataTo(&record)
+			records[record.PlayerID] = append(records[record.PlayerID], record)
+		}
+	}
+	return records, nil
+}
+
+// Fill the last match points, last-5 average and season points of squad
+// players from their history before the match
+func (s *Server) applyForm(ctx context.Context, match Match, sides ...[]MatchSquadPlayer) error {
+	var ids []string
+	for _, players := range sides {
+		for _, player := range players {
+			ids = append(ids, player.PlayerID)
+		}
+	}
+	records, err := s.playerRecords(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, players := range sides {
+		for i := range players {
+			form := models.FormBefore(records[players[i].PlayerID], match.LeagueID, match.StartTime)
+			players[i].LastMatchPoints = form.LastMatchPoints
+			players[i].Last5Average = form.Last5Average
+			players[i].SeasonPoints = form.SeasonPoints
+		}
+	}
+	return nil
+}
+
+// Get a player's match history, latest first, with their current form
+// (public endpoint). ?leagueId= narrows to one league's matches.
+func (s *Server) getPlayerHistory(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+
+	ctx := r.Context()
+	if _, err := getDocument(ctx, s.firestoreClient.Collection("players").Doc(playerId), "Player"); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	q := s.firestoreClient.Collection("playerHistory").Where("playerId", "==", playerId)
+	leagueID := r.URL.Query().Get("leagueId")
+	if leagueID != "" {
+		q = q.Where("leagueId", "==", leagueID)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	records := make([]models.PlayerMatchRecord, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&records[i])
+	}
+	models.SortRecentFirst(records)
+
+	// Form going into the next match: everything played so far, with the
+	// season being the latest match's league unless one was asked for
+	if leagueID == "" && len(records) > 0 {
+		leagueID = records[0].LeagueID
+	}
+	form := models.FormBefore(records, leagueID, time.Now().UTC())
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"playerId": playerId,
+		"form":     form,
+		"matches":  records,
+	})
+}
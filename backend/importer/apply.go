@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Firestore rejects batches larger than this
+const maxBatchWrites = 500
+
+// Write a plan's creates and updates. Plans with errors are refused so a bad
+// file never half-applies; updates only touch the fields that differ.
+func (im *Importer) Apply(ctx context.Context, plan *Plan) (int, error) {
+	if plan.HasErrors() {
+		return 0, fmt.Errorf("plan has %d errors; fix the input and try again", plan.Count(SeverityError))
+	}
+
+	written := 0
+	batch := im.Client.Batch()
+	pending := 0
+	for _, change := range plan.Changes {
+		ref := im.Client.Collection(change.Collection).Doc(change.DocID)
+		switch change.Action {
+		case ActionCreate:
+			batch.Create(ref, change.doc)
+		case ActionUpdate:
+			updates := make([]firestore.Update, 0, len(change.Diffs))
+			for _, diff := range change.Diffs {
+				updates = append(updates, firestore.Update{Path: diff.Field, Value: diff.New})
+			}
+			batch.Update(ref, updates)
+		default:
+			continue
+		}
+		pending++
+		if pending == maxBatchWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return written, err
+			}
+			written += pending
+			batch = im.Client.Batch()
+			pending = 0
+		}
+	}
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return written, err
+		}
+		written += pending
+	}
+	return written, nil
+}
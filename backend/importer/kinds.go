@@ -0,0 +1,290 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Team-player roles accepted on import
+var teamPlayerRoles = map[string]bool{"captain": true, "vice-captain": true, "player": true}
+
+func (p *planner) planLeague(rec Record) {
+	loc, err := models.LoadLeagueLocation(rec.get("timezone"))
+	if err != nil {
+		p.problem(rec, SeverityError, "timezone", "%v", err)
+		return
+	}
+	values := p.parseFields(rec, KindLeagues, loc)
+	id, _ := values["leagueId"].(string)
+	if id == "" {
+		p.problem(rec, SeverityError, "leagueId", "is required")
+		return
+	}
+	start, hasStart := values["startDate"].(time.Time)
+	end, hasEnd := values["endDate"].(time.Time)
+	if hasStart && hasEnd && end.Before(start) {
+		p.problem(rec, SeverityError, "endDate", "is before startDate")
+	}
+
+	p.upsert(rec, "leagues", "leagueId", "leagueId "+id, p.ids["leagues"][id], id, values, []string{"name"},
+		func(string) interface{} {
+			return &models.League{Timezone: models.DefaultLeagueTimezone, Status: "upcoming", CreatedAt: p.now}
+		})
+}
+
+func (p *planner) planTeam(rec Record) {
+	values := p.parseFields(rec, KindTeams, nil)
+	leagueID := p.leagueFor(rec)
+	code := strings.ToUpper(rec.get("code"))
+	if code == "" {
+		p.problem(rec, SeverityError, "code", "is required")
+	}
+	if leagueID == "" || code == "" {
+		return
+	}
+	values["leagueId"] = leagueID
+	values["code"] = code
+
+	var match *existingDoc
+	for _, doc := range p.docs["teams"] {
+		if doc.str("leagueId") == leagueID && strings.EqualFold(doc.str("code"), code) {
+			match = doc
+			break
+		}
+	}
+	key := fmt.Sprintf("code %s in league %s", code, leagueID)
+	p.upsert(rec, "teams", "teamId", key, match, p.newID("team"), values, []string{"name"},
+		func(string) interface{} {
+			return &models.Team{CreatedAt: p.now}
+		})
+}
+
+func (p *planner) planPlayer(rec Record) {
+	values := p.parseFields(rec, KindPlayers, nil)
+	name := rec.get("name")
+	if name == "" {
+		name = strings.TrimSpace(rec.get("firstName") + " " + rec.get("lastName"))
+	}
+	if name == "" {
+		p.problem(rec, SeverityError, "name", "is required")
+		return
+	}
+	values["name"] = name
+	dateOfBirth, _ := values["dateOfBirth"].(string)
+
+	found := p.findPlayers(name, dateOfBirth)
+	if len(found) > 1 {
+		p.problem(rec, SeverityError, "dateOfBirth", "%d players are named %q; give a dateOfBirth that tells them apart", len(found), name)
+		return
+	}
+	var match *existingDoc
+	if len(found) == 1 {
+		match = found[0]
+	}
+	if dateOfBirth == "" {
+		p.problem(rec, SeverityWarning, "dateOfBirth", "missing; matched on name only")
+	}
+	if _, ok := values["defaultCredits"]; !ok && match == nil && p.im.DefaultCredits > 0 {
+		values["defaultCredits"] = p.im.DefaultCredits
+	}
+
+	key := fmt.Sprintf("name %q", name)
+	if dateOfBirth != "" {
+		key += " born " + dateOfBirth
+	}
+	player := p.upsert(rec, "players", "playerId", key, match, p.newID("player"), values,
+		[]string{"defaultCategory", "defaultCredits"},
+		func(string) interface{} {
+			return &models.Player{Nationality: "India", CreatedAt: p.now}
+		})
+
+	// Squad exports list the team alongside each player
+	if player != nil && rec.has("team") {
+		p.planAssociation(rec, player.id)
+	}
+}
+
+func (p *planner) planTeamPlayer(rec Record) {
+	playerID := rec.get("playerId")
+	if playerID != "" {
+		if p.ids["players"][playerID] == nil {
+			p.problem(rec, SeverityError, "playerId", "no player %s", playerID)
+			return
+		}
+		p.planAssociation(rec, playerID)
+		return
+	}
+
+	name := rec.get("playerName")
+	if name == "" {
+		p.problem(rec, SeverityError, "playerId", "playerId or playerName is required")
+		return
+	}
+	found := p.findPlayers(name, rec.get("dateOfBirth"))
+	switch len(found) {
+	case 0:
+		p.problem(rec, SeverityError, "playerName", "no player named %q; import players first", name)
+	case 1:
+		p.planAssociation(rec, found[0].id)
+	default:
+		p.problem(rec, SeverityError, "dateOfBirth", "%d players are named %q; give a dateOfBirth or playerId", len(found), name)
+	}
+}
+
+// Plan the team-player association described by rec for an already resolved player
+func (p *planner) planAssociation(rec Record, playerID string) {
+	leagueID := p.leagueFor(rec)
+	season := rec.get("season")
+	if season == "" {
+		season = p.im.Season
+	}
+	if season == "" {
+		p.problem(rec, SeverityError, "season", "is required; add a season column or pass -season")
+	}
+	if leagueID == "" || season == "" {
+		return
+	}
+
+	values := p.parseFields(rec, KindTeamPlayers, p.leagueLocation(leagueID))
+	teamID, _ := values["teamId"].(string)
+	if teamID == "" {
+		team := p.findTeam(leagueID, rec.get("team"))
+		if team == nil {
+			p.problem(rec, SeverityError, "team", "no team %q in league %s", rec.get("team"), leagueID)
+			return
+		}
+		teamID = team.id
+	} else if p.ids["teams"][teamID] == nil {
+		p.problem(rec, SeverityError, "teamId", "no team %s", teamID)
+		return
+	}
+	if role, ok := values["role"].(string); ok && !teamPlayerRoles[role] {
+		p.problem(rec, SeverityError, "role", "must be captain, vice-captain or player, got %q", role)
+		return
+	}
+	values["playerId"] = playerID
+	values["teamId"] = teamID
+	values["leagueId"] = leagueID
+	values["season"] = season
+
+	var match *existingDoc
+	for _, doc := range p.docs["teamPlayers"] {
+		if doc.str("playerId") == playerID && doc.str("teamId") == teamID &&
+			doc.str("leagueId") == leagueID && doc.str("season") == season {
+			match = doc
+			break
+		}
+	}
+	key := fmt.Sprintf("player %s in team %s for %s season %s", playerID, teamID, leagueID, season)
+	newID := fmt.Sprintf("assoc_%s_%s_%s", playerID, teamID, season)
+	p.upsert(rec, "teamPlayers", "associationId", key, match, newID, values, nil,
+		func(string) interface{} {
+			return &models.TeamPlayer{Role: "player", IsActive: true, CreatedAt: p.now}
+		})
+}
+
+func (p *planner) planMatch(rec Record) {
+	leagueID := p.leagueFor(rec)
+	if leagueID == "" {
+		return
+	}
+	values := p.parseFields(rec, KindMatches, p.leagueLocation(leagueID))
+	values["leagueId"] = leagueID
+
+	team1 := p.matchTeam(rec, values, leagueID, "team1")
+	team2 := p.matchTeam(rec, values, leagueID, "team2")
+	if team1 == nil || team2 == nil {
+		return
+	}
+	if team1.id == team2.id {
+		p.problem(rec, SeverityError, "team2Id", "a team cannot play itself")
+		return
+	}
+	values["team1Id"] = team1.id
+	values["team2Id"] = team2.id
+	values["team1"] = teamInfo(team1)
+	values["team2"] = teamInfo(team2)
+
+	var match *existingDoc
+	var key string
+	if id, ok := values["matchId"].(string); ok {
+		match = p.ids["matches"][id]
+		key = "matchId " + id
+	} else {
+		startTime, ok := values["startTime"].(time.Time)
+		if !ok {
+			p.problem(rec, SeverityError, "startTime", "is required when matchId is not given")
+			return
+		}
+		for _, doc := range p.docs["matches"] {
+			stored, _ := doc.data["startTime"].(time.Time)
+			if doc.str("leagueId") == leagueID && doc.str("team1Id") == team1.id &&
+				doc.str("team2Id") == team2.id && stored.Equal(startTime) {
+				match = doc
+				break
+			}
+		}
+		key = fmt.Sprintf("%s v %s at %s", team1.str("code"), team2.str("code"), startTime.Format(time.RFC3339))
+	}
+
+	p.upsert(rec, "matches", "matchId", key, match, p.newID("match"), values, []string{"startTime"},
+		func(string) interface{} {
+			return &models.Match{Status: "upcoming", CreatedAt: p.now}
+		})
+}
+
+// Resolve one side of a match from its ID column or its team code/name column
+func (p *planner) matchTeam(rec Record, values map[string]interface{}, leagueID, side string) *existingDoc {
+	idField := side + "Id"
+	if id, ok := values[idField].(string); ok {
+		team := p.ids["teams"][id]
+		if team == nil {
+			p.problem(rec, SeverityError, idField, "no team %s", id)
+			return nil
+		}
+		if team.str("leagueId") != leagueID {
+			p.problem(rec, SeverityError, idField, "team %s is not in league %s", id, leagueID)
+			return nil
+		}
+		return team
+	}
+	if !rec.has(side) {
+		p.problem(rec, SeverityError, idField, "%s or %s is required", idField, side)
+		return nil
+	}
+	team := p.findTeam(leagueID, rec.get(side))
+	if team == nil {
+		p.problem(rec, SeverityError, side, "no team %q in league %s", rec.get(side), leagueID)
+	}
+	return team
+}
+
+func teamInfo(team *existingDoc) models.TeamInfo {
+	return models.TeamInfo{Name: team.str("name"), Code: team.str("code"), Logo: team.str("logo")}
+}
+
+// League named by the record or the importer default; must exist
+func (p *planner) leagueFor(rec Record) string {
+	leagueID := rec.get("leagueId")
+	if leagueID == "" {
+		leagueID = p.im.LeagueID
+	}
+	if leagueID == "" {
+		p.problem(rec, SeverityError, "leagueId", "is required; add a leagueId column or pass -league")
+		return ""
+	}
+	if p.ids["leagues"][leagueID] == nil {
+		p.problem(rec, SeverityError, "leagueId", "no league %s; import leagues first", leagueID)
+		return ""
+	}
+	return leagueID
+}
+
+// Document ID in the style the API handlers generate
+func (p *planner) newID(prefix string) string {
+	p.seq++
+	return fmt.Sprintf("%s_%d", prefix, p.now.UnixNano()+int64(p.seq))
+}
@@ -0,0 +1,535 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// What a file holds
+type Kind string
+
+const (
+	KindLeagues     Kind = "leagues"
+	KindTeams       Kind = "teams"
+	KindPlayers     Kind = "players"
+	KindTeamPlayers Kind = "team-players"
+	KindMatches     Kind = "matches"
+)
+
+var Kinds = []Kind{KindLeagues, KindTeams, KindPlayers, KindTeamPlayers, KindMatches}
+
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// A validation finding tied to an input record
+type Problem struct {
+	Source   string `json:"source"`
+	Field    string `json:"field,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("%s: %s: %s", p.Source, p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", p.Source, p.Severity, p.Field, p.Message)
+}
+
+type FieldDiff struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// One document write the import would make
+type Change struct {
+	Action     string      `json:"action"`
+	Collection string      `json:"collection"`
+	DocID      string      `json:"docId"`
+	Key        string      `json:"key"` // natural key the record was matched on
+	Source     string      `json:"source"`
+	Diffs      []FieldDiff `json:"diffs,omitempty"`
+	doc        interface{} // full document for creates
+}
+
+// Result of a dry run: the writes Apply would make and everything wrong with the input
+type Plan struct {
+	Kind     Kind      `json:"kind"`
+	Changes  []Change  `json:"changes"`
+	Problems []Problem `json:"problems"`
+}
+
+func (p *Plan) HasErrors() bool {
+	return p.Count(SeverityError) > 0
+}
+
+func (p *Plan) Count(severity string) int {
+	n := 0
+	for _, problem := range p.Problems {
+		if problem.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// Number of changes per action
+func (p *Plan) Summary() map[string]int {
+	summary := map[string]int{ActionCreate: 0, ActionUpdate: 0, ActionUnchanged: 0}
+	for _, change := range p.Changes {
+		summary[change.Action]++
+	}
+	return summary
+}
+
+type Importer struct {
+	Client *firestore.Client
+
+	// Defaults for records that don't name their league or season
+	LeagueID string
+	Season   string
+	// Credits given to new players whose record has none; zero makes credits required
+	DefaultCredits float64
+
+	Now func() time.Time
+}
+
+// A document already in Firestore, or one planned earlier in the same run
+type existingDoc struct {
+	id        string
+	data      map[string]interface{}
+	claimedBy string // source of the record in this run that creates or updates it
+}
+
+func (d *existingDoc) str(field string) string {
+	s, _ := d.data[field].(string)
+	return s
+}
+
+type planner struct {
+	im   *Importer
+	ctx  context.Context
+	plan *Plan
+	now  time.Time
+	seq  int64
+
+	docs map[string][]*existingDoc          // collection -> documents
+	ids  map[string]map[string]*existingDoc // collection -> document ID -> document
+}
+
+// Collections each kind's records are matched against
+var kindCollections = map[Kind][]string{
+	KindLeagues:     {"leagues"},
+	KindTeams:       {"leagues", "teams"},
+	KindPlayers:     {"leagues", "teams", "players", "teamPlayers"},
+	KindTeamPlayers: {"leagues", "teams", "players", "teamPlayers"},
+	KindMatches:     {"leagues", "teams", "matches"},
+}
+
+// Match records against Firestore by natural key and work out the writes needed.
+// Nothing is written; pass the result to Apply.
+func (im *Importer) Plan(ctx context.Context, kind Kind, records []Record) (*Plan, error) {
+	collections, ok := kindCollections[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind %q", kind)
+	}
+	p := im.newPlanner(ctx, kind)
+	for _, collection := range collections {
+		if err := p.load(collection); err != nil {
+			return nil, fmt.Errorf("load %s: %w", collection, err)
+		}
+	}
+	p.planRecords(records)
+	return p.plan, nil
+}
+
+func (im *Importer) newPlanner(ctx context.Context, kind Kind) *planner {
+	now := time.Now()
+	if im.Now != nil {
+		now = im.Now()
+	}
+	return &planner{
+		im:   im,
+		ctx:  ctx,
+		plan: &Plan{Kind: kind, Changes: []Change{}, Problems: []Problem{}},
+		now:  now.UTC(),
+		docs: map[string][]*existingDoc{},
+		ids:  map[string]map[string]*existingDoc{},
+	}
+}
+
+// Plan each record against the loaded documents, in order, so later records
+// see the documents earlier ones create
+func (p *planner) planRecords(records []Record) {
+	planRecord := map[Kind]func(Record){
+		KindLeagues:     p.planLeague,
+		KindTeams:       p.planTeam,
+		KindPlayers:     p.planPlayer,
+		KindTeamPlayers: p.planTeamPlayer,
+		KindMatches:     p.planMatch,
+	}[p.plan.Kind]
+	for _, rec := range records {
+		p.checkColumns(p.plan.Kind, rec)
+		planRecord(rec)
+	}
+}
+
+func (p *planner) load(collection string) error {
+	p.ids[collection] = map[string]*existingDoc{}
+	iter := p.im.Client.Collection(collection).Documents(p.ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p.add(collection, &existingDoc{id: doc.Ref.ID, data: doc.Data()})
+	}
+}
+
+func (p *planner) add(collection string, doc *existingDoc) {
+	p.docs[collection] = append(p.docs[collection], doc)
+	p.ids[collection][doc.id] = doc
+}
+
+func (p *planner) problem(rec Record, severity, field, format string, args ...interface{}) {
+	p.plan.Problems = append(p.plan.Problems, Problem{
+		Source: rec.Source, Field: field, Severity: severity, Message: fmt.Sprintf(format, args...),
+	})
+}
+
+type fieldType int
+
+const (
+	textField fieldType = iota
+	intField
+	floatField
+	boolField
+	timeField // instant; values without an offset are read in the league timezone
+	dateField // calendar date kept as YYYY-MM-DD
+	categoryField
+)
+
+type field struct {
+	name string
+	typ  fieldType
+}
+
+// Document fields each kind can set
+var kindFields = map[Kind][]field{
+	KindLeagues: {
+		{"leagueId", textField}, {"name", textField}, {"description", textField},
+		{"startDate", timeField}, {"endDate", timeField}, {"timezone", textField}, {"status", textField},
+	},
+	KindTeams: {
+		{"teamId", textField}, {"name", textField}, {"code", textField}, {"logo", textField},
+		{"leagueId", textField}, {"homeCity", textField}, {"captain", textField}, {"coach", textField},
+	},
+	KindPlayers: {
+		{"playerId", textField}, {"name", textField}, {"imageUrl", textField},
+		{"defaultCategory", categoryField}, {"defaultCredits", floatField},
+		{"dateOfBirth", dateField}, {"nationality", textField},
+	},
+	KindTeamPlayers: {
+		{"associationId", textField}, {"playerId", textField}, {"teamId", textField},
+		{"leagueId", textField}, {"season", textField}, {"jerseyNumber", intField}, {"role", textField},
+		{"startDate", timeField}, {"endDate", timeField}, {"isActive", boolField},
+	},
+	KindMatches: {
+		{"matchId", textField}, {"leagueId", textField}, {"team1Id", textField}, {"team2Id", textField},
+		{"startTime", timeField}, {"status", textField}, {"venue", textField}, {"round", textField},
+	},
+}
+
+// Columns that identify related documents rather than being stored
+var lookupColumns = map[Kind][]string{
+	KindPlayers:     {"firstName", "lastName", "team", "leagueId", "season", "jerseyNumber", "role"},
+	KindTeamPlayers: {"playerName", "dateOfBirth", "team"},
+	KindMatches:     {"team1", "team2"},
+}
+
+// Values the data/*.json templates use for facts still to be filled in
+var placeholderValues = map[string]bool{"EXTRACT_FROM_WEBSITE": true, "TBD": true}
+
+// Warn once per record about columns the kind doesn't use, which are usually typos
+func (p *planner) checkColumns(kind Kind, rec Record) {
+	known := map[string]bool{}
+	for _, f := range kindFields[kind] {
+		known[columnKey(f.name)] = true
+	}
+	for _, column := range lookupColumns[kind] {
+		known[columnKey(column)] = true
+	}
+	columns := make([]string, 0, len(rec.Values))
+	for column := range rec.Values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	var unknown []string
+	for _, column := range columns {
+		value := strings.TrimSpace(rec.Values[column])
+		if !known[column] && value != "" {
+			unknown = append(unknown, column)
+		}
+		if placeholderValues[value] {
+			p.problem(rec, SeverityWarning, column, "placeholder value %q", value)
+		}
+	}
+	if len(unknown) > 0 {
+		p.problem(rec, SeverityWarning, "", "ignored columns: %s", strings.Join(unknown, ", "))
+	}
+}
+
+// Typed values for the kind's fields present in the record
+func (p *planner) parseFields(rec Record, kind Kind, loc *time.Location) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, f := range kindFields[kind] {
+		raw := rec.get(f.name)
+		if raw == "" {
+			continue
+		}
+		switch f.typ {
+		case textField:
+			values[f.name] = raw
+		case intField:
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				p.problem(rec, SeverityError, f.name, "expected a whole number, got %q", raw)
+				continue
+			}
+			values[f.name] = int64(n)
+		case floatField:
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				p.problem(rec, SeverityError, f.name, "expected a number, got %q", raw)
+				continue
+			}
+			values[f.name] = n
+		case boolField:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				p.problem(rec, SeverityError, f.name, "expected true or false, got %q", raw)
+				continue
+			}
+			values[f.name] = b
+		case timeField:
+			t, err := models.ParseTimestamp(raw, loc)
+			if err != nil {
+				p.problem(rec, SeverityError, f.name, "%v", err)
+				continue
+			}
+			values[f.name] = t
+		case dateField:
+			if _, err := time.Parse("2006-01-02", raw); err != nil {
+				p.problem(rec, SeverityError, f.name, "expected a date as YYYY-MM-DD, got %q", raw)
+				continue
+			}
+			values[f.name] = raw
+		case categoryField:
+			category, ok := models.NormalizeCategory(raw)
+			if !ok {
+				p.problem(rec, SeverityError, f.name, "unknown category or position %q; expected one of %s", raw, strings.Join(models.Categories, ", "))
+				continue
+			}
+			values[f.name] = category
+		}
+	}
+	return values
+}
+
+// Timezone for times in a league's records; unknown leagues fall back to the default
+func (p *planner) leagueLocation(leagueID string) *time.Location {
+	name := ""
+	if league := p.ids["leagues"][leagueID]; league != nil {
+		name = league.str("timezone")
+	}
+	loc, err := models.LoadLeagueLocation(name)
+	if err != nil {
+		loc, _ = models.LoadLeagueLocation("")
+	}
+	return loc
+}
+
+// Plan writing values to collection. match is the document found by natural key,
+// or nil to create one with values[idField] (or newID when absent). required lists
+// the fields a new document must have; build returns the full typed document.
+func (p *planner) upsert(rec Record, collection, idField, key string, match *existingDoc, newID string,
+	values map[string]interface{}, required []string, build func(id string) interface{}) *existingDoc {
+
+	if match != nil && match.claimedBy != "" {
+		p.problem(rec, SeverityError, "", "duplicate of %s (same %s)", match.claimedBy, key)
+		return nil
+	}
+
+	if match != nil {
+		if id, ok := values[idField].(string); ok && id != match.id {
+			p.problem(rec, SeverityError, idField, "%s/%s already has %s, but the record gives %q", collection, match.id, key, id)
+			return nil
+		}
+		match.claimedBy = rec.Source
+		change := Change{Action: ActionUnchanged, Collection: collection, DocID: match.id, Key: key, Source: rec.Source}
+		fields := make([]string, 0, len(values))
+		for name := range values {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for _, name := range fields {
+			if name == idField || sameValue(match.data[name], values[name]) {
+				continue
+			}
+			change.Diffs = append(change.Diffs, FieldDiff{Field: name, Old: match.data[name], New: values[name]})
+		}
+		if len(change.Diffs) > 0 {
+			change.Action = ActionUpdate
+			for _, diff := range change.Diffs {
+				match.data[diff.Field] = diff.New
+			}
+		}
+		p.plan.Changes = append(p.plan.Changes, change)
+		return match
+	}
+
+	missing := false
+	for _, name := range required {
+		if _, ok := values[name]; !ok {
+			p.problem(rec, SeverityError, name, "is required for a new %s document", collection)
+			missing = true
+		}
+	}
+	id, _ := values[idField].(string)
+	if id == "" {
+		id = newID
+	}
+	if existing := p.ids[collection][id]; existing != nil {
+		p.problem(rec, SeverityError, idField, "%s/%s already exists but does not have %s", collection, id, key)
+		return nil
+	}
+	if missing {
+		return nil
+	}
+	values[idField] = id
+
+	doc := build(id)
+	assign(doc, values)
+	planned := &existingDoc{id: id, data: values, claimedBy: rec.Source}
+	p.add(collection, planned)
+	p.plan.Changes = append(p.plan.Changes, Change{
+		Action: ActionCreate, Collection: collection, DocID: id, Key: key, Source: rec.Source, doc: doc,
+	})
+	return planned
+}
+
+// Copy values onto the struct pointed to by dst, matching firestore tags
+func assign(dst interface{}, values map[string]interface{}) {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("firestore"), ",")[0]
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		rv := reflect.ValueOf(value)
+		if rv.Type().ConvertibleTo(t.Field(i).Type) {
+			v.Field(i).Set(rv.Convert(t.Field(i).Type))
+		}
+	}
+}
+
+// Compare a stored Firestore value with a planned one. Firestore hands back
+// int64 or float64 for numbers depending on how they were written.
+func sameValue(stored, planned interface{}) bool {
+	switch pv := planned.(type) {
+	case time.Time:
+		st, ok := stored.(time.Time)
+		return ok && st.Equal(pv)
+	case int64, float64:
+		sf, ok := toFloat(stored)
+		pf, _ := toFloat(planned)
+		return ok && math.Abs(sf-pf) < 1e-9
+	case models.TeamInfo:
+		m, ok := stored.(map[string]interface{})
+		if !ok {
+			if ti, ok := stored.(models.TeamInfo); ok {
+				return ti == pv
+			}
+			return false
+		}
+		return m["name"] == pv.Name && m["code"] == pv.Code && m["logo"] == pv.Logo
+	}
+	return stored == planned
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Natural-key helpers
+
+// Player names compare case-insensitively with runs of whitespace collapsed
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Team in a league by code, then by name; team may also be a document ID
+func (p *planner) findTeam(leagueID, team string) *existingDoc {
+	if doc := p.ids["teams"][team]; doc != nil {
+		return doc
+	}
+	for _, doc := range p.docs["teams"] {
+		if doc.str("leagueId") == leagueID && strings.EqualFold(doc.str("code"), team) {
+			return doc
+		}
+	}
+	for _, doc := range p.docs["teams"] {
+		if doc.str("leagueId") == leagueID && normalizeName(doc.str("name")) == normalizeName(team) {
+			return doc
+		}
+	}
+	return nil
+}
+
+// Players with the given name and date of birth. A date of birth missing on
+// either side matches any, so partial records still find the player.
+func (p *planner) findPlayers(name, dateOfBirth string) []*existingDoc {
+	var found []*existingDoc
+	for _, doc := range p.docs["players"] {
+		if normalizeName(doc.str("name")) != normalizeName(name) {
+			continue
+		}
+		if stored := doc.str("dateOfBirth"); dateOfBirth != "" && stored != "" && stored != dateOfBirth {
+			continue
+		}
+		found = append(found, doc)
+	}
+	return found
+}
@@ -0,0 +1,292 @@
+package importer
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Documents as Firestore hands them back, by collection and ID
+type memoryStore map[string]map[string]map[string]interface{}
+
+var testNow = time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+
+func newTestStore() memoryStore {
+	return memoryStore{
+		"leagues": {
+			"pvl-2025": {"leagueId": "pvl-2025", "name": "PVL 2025", "timezone": "Asia/Kolkata"},
+		},
+	}
+}
+
+// Plan records against the store's documents instead of Firestore's
+func (st memoryStore) plan(t *testing.T, im *Importer, kind Kind, records []Record) *Plan {
+	t.Helper()
+	im.Now = func() time.Time { return testNow }
+	p := im.newPlanner(context.Background(), kind)
+	for _, collection := range kindCollections[kind] {
+		p.ids[collection] = map[string]*existingDoc{}
+		ids := make([]string, 0, len(st[collection]))
+		for id := range st[collection] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			data := map[string]interface{}{}
+			for field, value := range st[collection][id] {
+				data[field] = value
+			}
+			p.add(collection, &existingDoc{id: id, data: data})
+		}
+	}
+	p.planRecords(records)
+	return p.plan
+}
+
+// Make the plan's writes as Apply would
+func (st memoryStore) apply(t *testing.T, plan *Plan) {
+	t.Helper()
+	if plan.HasErrors() {
+		t.Fatalf("plan has errors: %v", plan.Problems)
+	}
+	for _, change := range plan.Changes {
+		if st[change.Collection] == nil {
+			st[change.Collection] = map[string]map[string]interface{}{}
+		}
+		switch change.Action {
+		case ActionCreate:
+			st[change.Collection][change.DocID] = stored(reflect.ValueOf(change.doc).Elem()).(map[string]interface{})
+		case ActionUpdate:
+			for _, diff := range change.Diffs {
+				st[change.Collection][change.DocID][diff.Field] = stored(reflect.ValueOf(diff.New))
+			}
+		}
+	}
+}
+
+// A value as Firestore stores and returns it: whole numbers as int64 and
+// structs other than times as maps keyed by their firestore tags
+func stored(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t
+		}
+		fields := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			name := strings.Split(v.Type().Field(i).Tag.Get("firestore"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = stored(v.Field(i))
+			}
+		}
+		return fields
+	}
+	return v.Interface()
+}
+
+func readCSV(t *testing.T, name, data string) []Record {
+	t.Helper()
+	records, err := ReadCSV(strings.NewReader(data), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func actions(plan *Plan) []string {
+	var got []string
+	for _, change := range plan.Changes {
+		got = append(got, change.Action+" "+change.Collection+"/"+change.DocID)
+	}
+	return got
+}
+
+func problems(plan *Plan) []string {
+	var got []string
+	for _, problem := range plan.Problems {
+		got = append(got, problem.String())
+	}
+	return got
+}
+
+func TestPlanCreatesAndReimport(t *testing.T) {
+	st := newTestStore()
+	im := &Importer{LeagueID: "pvl-2025", Season: "2025"}
+	steps := []struct {
+		kind    Kind
+		file    string
+		data    string
+		creates []string
+	}{
+		{KindTeams, "teams.csv", "code,name\nahm,Ahmedabad Defenders\nCAL,Calicut Heroes\n",
+			[]string{"teams/team_1", "teams/team_2"}},
+		{KindPlayers, "players.csv", "name,dob,position,credits,team,jersey\n" +
+			"Shon John,2001-05-01,Attacker,8.5,AHM,7\n" +
+			"Ashwal Rai,1995-07-20,Blocker,9,CAL,11\n",
+			[]string{"players/player_1", "teamPlayers/assoc_player_1_team_1_2025", "players/player_2", "teamPlayers/assoc_player_2_team_2_2025"}},
+		{KindMatches, "matches.csv", "team1,team2,startTime,venue\nAHM,CAL,2025-02-01T19:00,Hyderabad\n",
+			[]string{"matches/match_1"}},
+	}
+	for _, step := range steps {
+		records := readCSV(t, step.file, step.data)
+		plan := st.plan(t, im, step.kind, records)
+		var created []string
+		for _, change := range plan.Changes {
+			if change.Action != ActionCreate {
+				t.Errorf("%s: %s %s/%s, want only creates", step.kind, change.Action, change.Collection, change.DocID)
+			}
+			created = append(created, change.Collection+"/"+renumber(change.DocID))
+		}
+		if !reflect.DeepEqual(created, step.creates) {
+			t.Errorf("%s: created %v, want %v", step.kind, created, step.creates)
+		}
+		if plan.HasErrors() {
+			t.Fatalf("%s: problems %v", step.kind, problems(plan))
+		}
+		st.apply(t, plan)
+
+		// Importing the same file again changes nothing
+		again := st.plan(t, im, step.kind, records)
+		if summary := again.Summary(); summary[ActionCreate] != 0 || summary[ActionUpdate] != 0 {
+			t.Errorf("%s re-import: %v, want everything unchanged", step.kind, actions(again))
+		}
+		if len(again.Problems) != 0 {
+			t.Errorf("%s re-import: problems %v", step.kind, problems(again))
+		}
+	}
+
+	team := findDoc(st, "teams", "code", "AHM")
+	if team["name"] != "Ahmedabad Defenders" || team["leagueId"] != "pvl-2025" {
+		t.Errorf("team stored as %v", team)
+	}
+	player := findDoc(st, "players", "name", "Shon John")
+	if player["defaultCategory"] != "attacker" || player["defaultCredits"] != 8.5 || player["dateOfBirth"] != "2001-05-01" {
+		t.Errorf("player stored as %v", player)
+	}
+	match := findDoc(st, "matches", "venue", "Hyderabad")
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	if start, _ := match["startTime"].(time.Time); !start.Equal(time.Date(2025, 2, 1, 19, 0, 0, 0, kolkata)) {
+		t.Errorf("match starts at %v, want 19:00 in the league timezone", match["startTime"])
+	}
+	if team1, _ := match["team1"].(map[string]interface{}); match["status"] != "upcoming" || team1["code"] != "AHM" {
+		t.Errorf("match stored as %v", match)
+	}
+}
+
+func TestPlanUpdates(t *testing.T) {
+	st := newTestStore()
+	st["teams"] = map[string]map[string]interface{}{
+		"ahm": {"teamId": "ahm", "leagueId": "pvl-2025", "code": "AHM", "name": "Ahmedabad", "homeCity": "Ahmedabad"},
+	}
+	st["players"] = map[string]map[string]interface{}{
+		"p1": {"playerId": "p1", "name": "Shon John", "dateOfBirth": "2001-05-01", "defaultCategory": "attacker", "defaultCredits": int64(8)},
+	}
+	im := &Importer{LeagueID: "pvl-2025"}
+
+	plan := st.plan(t, im, KindTeams, readCSV(t, "teams.csv", "code,name,homeCity\nAHM,Ahmedabad Defenders,Ahmedabad\n"))
+	want := []Change{{
+		Action: ActionUpdate, Collection: "teams", DocID: "ahm", Key: "code AHM in league pvl-2025", Source: "teams.csv:2",
+		Diffs: []FieldDiff{{Field: "name", Old: "Ahmedabad", New: "Ahmedabad Defenders"}},
+	}}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Errorf("changes %+v, want %+v", plan.Changes, want)
+	}
+
+	// Players match on name and date of birth, whatever the spacing and case;
+	// credits stored as a whole number equal the same float
+	plan = st.plan(t, im, KindPlayers, readCSV(t, "players.csv", "name,dob,position,credits\nshon  JOHN,2001-05-01,setter,8\n"))
+	want = []Change{{
+		Action: ActionUpdate, Collection: "players", DocID: "p1", Key: `name "shon  JOHN" born 2001-05-01`, Source: "players.csv:2",
+		Diffs: []FieldDiff{
+			{Field: "defaultCategory", Old: "attacker", New: "setter"},
+			{Field: "name", Old: "Shon John", New: "shon  JOHN"},
+		},
+	}}
+	if !reflect.DeepEqual(plan.Changes, want) {
+		t.Errorf("changes %+v, want %+v", plan.Changes, want)
+	}
+}
+
+func TestPlanProblems(t *testing.T) {
+	st := newTestStore()
+	st["teams"] = map[string]map[string]interface{}{
+		"ahm": {"teamId": "ahm", "leagueId": "pvl-2025", "code": "AHM", "name": "Ahmedabad Defenders"},
+	}
+	tests := []struct {
+		kind Kind
+		data string
+		want []string
+	}{
+		{KindTeams, "code,name\nAHM,One\nahm,Two\n", []string{
+			"f.csv:3: error: duplicate of f.csv:2 (same code AHM in league pvl-2025)",
+		}},
+		{KindTeams, "code,name,leagueId\nKOL,Kolkata,isl\n", []string{
+			"f.csv:2: error: leagueId: no league isl; import leagues first",
+		}},
+		{KindTeams, "name,colour\nKolkata,red\n", []string{
+			"f.csv:2: warning: ignored columns: colour",
+			"f.csv:2: error: code: is required",
+		}},
+		{KindPlayers, "name,position,credits\nNew Player,TBD,8\n", []string{
+			`f.csv:2: warning: defaultcategory: placeholder value "TBD"`,
+			`f.csv:2: error: defaultCategory: unknown category or position "TBD"; expected one of libero, setter, attacker, blocker, universal`,
+			"f.csv:2: warning: dateOfBirth: missing; matched on name only",
+			"f.csv:2: error: defaultCategory: is required for a new players document",
+		}},
+		{KindTeamPlayers, "playerName,team,season,jersey\nNobody,AHM,2025,x\n", []string{
+			`f.csv:2: error: playerName: no player named "Nobody"; import players first`,
+		}},
+		{KindMatches, "team1,team2,startTime\nAHM,AHM,2025-02-01T19:00\n", []string{
+			"f.csv:2: error: team2Id: a team cannot play itself",
+		}},
+		{KindMatches, "team1,team2\nAHM,KOL\n", []string{
+			`f.csv:2: error: team2: no team "KOL" in league pvl-2025`,
+		}},
+	}
+	for _, tt := range tests {
+		plan := st.plan(t, &Importer{LeagueID: "pvl-2025"}, tt.kind, readCSV(t, "f.csv", tt.data))
+		if got := problems(plan); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %q: problems\n%s\nwant\n%s", tt.kind, tt.data, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestApplyRefusesPlanWithErrors(t *testing.T) {
+	plan := &Plan{Problems: []Problem{{Source: "f.csv:2", Severity: SeverityError, Message: "bad"}}}
+	// No client: a refused plan never reaches Firestore
+	written, err := (&Importer{}).Apply(context.Background(), plan)
+	if err == nil || written != 0 {
+		t.Errorf("Apply = %d, %v; want the plan refused", written, err)
+	}
+}
+
+// Generated IDs end in the clock's nanoseconds plus a sequence number; keep
+// just the sequence
+func renumber(docID string) string {
+	base := testNow.UnixNano()
+	for seq := int64(9); seq >= 1; seq-- {
+		docID = strings.ReplaceAll(docID, strconv.FormatInt(base+seq, 10), strconv.FormatInt(seq, 10))
+	}
+	return docID
+}
+
+func findDoc(st memoryStore, collection, field string, value interface{}) map[string]interface{} {
+	for _, doc := range st[collection] {
+		if doc[field] == value {
+			return doc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fantasy-volleyball-backend/pvl"
+)
+
+// One input row. Values are keyed by normalised column name (see columnKey), so
+// "dateOfBirth", "Date of Birth" and "date_of_birth" all land on the same key.
+type Record struct {
+	Source string            `json:"source"` // file:line for CSV, file[index] for JSON
+	Values map[string]string `json:"values"`
+}
+
+// Value of a column, trimmed; empty when absent
+func (rec Record) get(column string) string {
+	return strings.TrimSpace(rec.Values[columnKey(column)])
+}
+
+func (rec Record) has(column string) bool {
+	return rec.get(column) != ""
+}
+
+// Read records from a .csv file with a header row, a .json file holding one
+// object or an array of objects in the data/*.json shapes, or a saved PVL squad page
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ReadCSV(f, name)
+	case ".json":
+		return ReadJSON(f, name)
+	case ".html", ".htm":
+		return ReadSquadPage(f, name)
+	}
+	return nil, fmt.Errorf("%s: unsupported file type; use .csv, .json or a saved squad page", path)
+}
+
+func ReadCSV(r io.Reader, name string) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: read header: %w", name, err)
+	}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		columns[i] = columnKey(column)
+	}
+
+	var records []Record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+		rec := Record{Source: fmt.Sprintf("%s:%d", name, line), Values: map[string]string{}}
+		blank := true
+		for i, value := range row {
+			if i >= len(columns) || columns[i] == "" {
+				continue
+			}
+			if strings.TrimSpace(value) != "" {
+				blank = false
+			}
+			rec.Values[columns[i]] = value
+		}
+		if !blank {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+func ReadJSON(r io.Reader, name string) ([]Record, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var objects []map[string]interface{}
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "{") {
+		var object map[string]interface{}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		objects = append(objects, object)
+	} else if err := json.Unmarshal(raw, &objects); err != nil {
+		return nil, fmt.Errorf("%s: expected an object or an array of objects: %w", name, err)
+	}
+
+	records := make([]Record, 0, len(objects))
+	for i, object := range objects {
+		rec := Record{Source: fmt.Sprintf("%s[%d]", name, i), Values: map[string]string{}}
+		for key, value := range object {
+			switch v := value.(type) {
+			case nil:
+				continue
+			case string:
+				rec.Values[columnKey(key)] = v
+			case float64:
+				rec.Values[columnKey(key)] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				rec.Values[columnKey(key)] = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("%s: field %s: nested values are not supported", rec.Source, key)
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// One players record per squad member, with the team column set so the
+// association is planned too. Player IDs are left to the importer because
+// players are matched by name and date of birth, not by the website's IDs.
+func ReadSquadPage(r io.Reader, name string) ([]Record, error) {
+	squad, err := pvl.ParseSquadPage(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	records := make([]Record, 0, len(squad.Players))
+	for i, player := range squad.Players {
+		records = append(records, Record{
+			Source: fmt.Sprintf("%s[%d]", name, i),
+			Values: map[string]string{
+				columnKey("name"):            player.Name(),
+				columnKey("imageUrl"):        player.ImageURL,
+				columnKey("defaultCategory"): player.Category,
+				columnKey("nationality"):     player.Nationality,
+				columnKey("team"):            squad.TeamName,
+				columnKey("jerseyNumber"):    strconv.Itoa(player.JerseyNumber),
+			},
+		})
+	}
+	return records, nil
+}
+
+// Spellings of the same column used by the PVL exports
+var columnAliases = map[string]string{
+	"country":   "nationality",
+	"position":  "defaultcategory",
+	"category":  "defaultcategory",
+	"credits":   "defaultcredits",
+	"dob":       "dateofbirth",
+	"jersey":    "jerseynumber",
+	"jerseyno":  "jerseynumber",
+	"teamcode":  "team",
+	"player":    "playername",
+	"team1code": "team1",
+	"team2code": "team2",
+}
+
+// Lower-case a column name and drop everything but letters and digits, then
+// resolve aliases
+func columnKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	key := b.String()
+	if alias, ok := columnAliases[key]; ok {
+		return alias
+	}
+	return key
+}
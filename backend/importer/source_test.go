@@ -0,0 +1,44 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	data := "Name,Date of Birth,Jersey No,Position\n" +
+		"Shon John, 2001-05-01,7,Attacker\n" +
+		",,,\n" +
+		"Ashwal Rai,,11,Blocker\n"
+	records, err := ReadCSV(strings.NewReader(data), "players.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Source: "players.csv:2", Values: map[string]string{"name": "Shon John", "dateofbirth": "2001-05-01", "jerseynumber": "7", "defaultcategory": "Attacker"}},
+		{Source: "players.csv:4", Values: map[string]string{"name": "Ashwal Rai", "dateofbirth": "", "jerseynumber": "11", "defaultcategory": "Blocker"}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records %+v, want %+v", records, want)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	records, err := ReadJSON(strings.NewReader(`[{"name": "Shon John", "credits": 8.5, "isActive": true, "imageUrl": null}]`), "players.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{{Source: "players.json[0]", Values: map[string]string{"name": "Shon John", "defaultcredits": "8.5", "isactive": "true"}}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records %+v, want %+v", records, want)
+	}
+
+	records, err = ReadJSON(strings.NewReader(`{"leagueId": "pvl-2025"}`), "league.json")
+	if err != nil || len(records) != 1 || records[0].get("leagueId") != "pvl-2025" {
+		t.Errorf("single object read as %+v, %v", records, err)
+	}
+	if _, err := ReadJSON(strings.NewReader(`[{"team": {"code": "AHM"}}]`), "nested.json"); err == nil {
+		t.Error("nested values were accepted")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Largest page a client may ask for. Requests without limit or pageToken get
+// every document, as before lists were paged.
+const maxPageSize = 500
+
+// Response header carrying the token for the next page; absent on the last page.
+// List bodies stay plain JSON arrays so existing clients keep working.
+const nextPageTokenHeader = "X-Next-Page-Token"
+
+// Describes which query parameters a list endpoint accepts and how they map onto
+// document fields. Every filter/sort pairing needs a composite index in
+// firestore.indexes.json. Without a sort, lists are in document ID order: a
+// query ordered by a field leaves out documents that lack it.
+type listSpec struct {
+	filters       map[string]string // query parameter -> field path, equality match
+	customFilters map[string]func(ctx context.Context, s *Server, q firestore.Query, value string) (firestore.Query, error)
+	sorts         map[string]string // sort key -> field path
+}
+
+// A parsed list request ready to run
+type listQuery struct {
+	query     firestore.Query
+	limit     int    // 0 for every document
+	sortKey   string // empty for document ID order
+	sortField string
+
+	includeArchived bool
+}
+
+// Encoded into the opaque pageToken
+type pageCursor struct {
+	Sort   string      `json:"s"`
+	Value  interface{} `json:"v"`
+	IsTime bool        `json:"t,omitempty"`
+	DocID  string      `json:"id"`
+}
+
+// Translate limit, pageToken, sort and filter parameters into a Firestore query on base
+func (s *Server) buildListQuery(r *http.Request, base firestore.Query, spec listSpec) (*listQuery, error) {
+	params := r.URL.Query()
+	q := base
+
+	// Apply filters in a stable order so identical requests build identical queries
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		if field, ok := spec.filters[name]; ok {
+			q = q.Where(field, "==", value)
+			continue
+		}
+		if custom, ok := spec.customFilters[name]; ok {
+			var err error
+			if q, err = custom(r.Context(), s, q, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sortKey := params.Get("sort")
+	field := ""
+	if sortKey == "" {
+		q = q.OrderBy(firestore.DocumentID, firestore.Asc)
+	} else {
+		var ok bool
+		if field, ok = spec.sorts[strings.TrimPrefix(sortKey, "-")]; !ok {
+			return nil, errorWithDetails(ErrInvalidRequest, sortKeys(spec), "Unsupported sort %q", sortKey)
+		}
+		dir := firestore.Asc
+		if strings.HasPrefix(sortKey, "-") {
+			dir = firestore.Desc
+		}
+		q = q.OrderBy(field, dir).OrderBy(firestore.DocumentID, dir)
+	}
+
+	limit := 0
+	if params.Get("pageToken") != "" {
+		limit = maxPageSize
+	}
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageSize {
+			return nil, errorf(ErrInvalidRequest, "limit must be between 1 and %d", maxPageSize)
+		}
+		limit = n
+	}
+
+	if token := params.Get("pageToken"); token != "" {
+		cursor, err := decodePageToken(token)
+		if err != nil || cursor.Sort != sortKey {
+			return nil, errorf(ErrInvalidRequest, "Invalid pageToken")
+		}
+		if field == "" {
+			q = q.StartAfter(cursor.DocID)
+		} else {
+			value := cursor.Value
+			if cursor.IsTime {
+				str, _ := value.(string)
+				t, err := time.Parse(time.RFC3339Nano, str)
+				if err != nil {
+					return nil, errorf(ErrInvalidRequest, "Invalid pageToken")
+				}
+				value = t
+			}
+			q = q.StartAfter(value, cursor.DocID)
+		}
+	}
+
+	includeArchived := false
+	if raw := params.Get("includeArchived"); raw != "" {
+		var err error
+		if includeArchived, err = strconv.ParseBool(raw); err != nil {
+			return nil, errorf(ErrInvalidRequest, "includeArchived must be true or false")
+		}
+		// Soft-deleted documents are for admins; public lists never show them
+		if includeArchived && adminID(r) == "" {
+			return nil, errorf(ErrForbidden, "includeArchived requires admin access")
+		}
+	}
+
+	if limit > 0 {
+		// Fetch one extra document to learn whether another page exists
+		q = q.Limit(limit + 1)
+	}
+	return &listQuery{query: q, limit: limit, sortKey: sortKey, sortField: field, includeArchived: includeArchived}, nil
+}
+
+// Run a list query, returning one page of decoded documents and the next page token
+func fetchPage[T any](ctx context.Context, lq *listQuery) ([]T, string, error) {
+	iter := lq.query.Documents(ctx)
+	defer iter.Stop()
+
+	items := []T{}
+	var last *firestore.DocumentSnapshot
+	scanned := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		scanned++
+		if lq.limit > 0 && len(items) == lq.limit {
+			// The extra document only proves there is more; the page ends at last
+			return items, encodePageToken(lq, last), nil
+		}
+		if !lq.includeArchived && isArchived(doc) {
+			last = doc
+			continue
+		}
+		var item T
+		if err := doc.DataTo(&item); err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+		last = doc
+	}
+	if lq.limit > 0 && scanned > lq.limit {
+		// Archived documents were skipped, so the page is short but the query
+		// hit its limit; more may follow
+		return items, encodePageToken(lq, last), nil
+	}
+	return items, "", nil
+}
+
+// Soft-deleted documents are hidden from lists unless includeArchived is set.
+// Documents written before soft delete have no archivedAt at all.
+func isArchived(doc *firestore.DocumentSnapshot) bool {
+	archivedAt, ok := doc.Data()["archivedAt"].(time.Time)
+	return ok && !archivedAt.IsZero()
+}
+
+// Write a page of results as a JSON array with the next page token header
+func writeList(w http.ResponseWriter, items interface{}, nextPageToken string) {
+	if nextPageToken != "" {
+		w.Header().Set(nextPageTokenHeader, nextPageToken)
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func encodePageToken(lq *listQuery, last *firestore.DocumentSnapshot) string {
+	cursor := pageCursor{Sort: lq.sortKey, DocID: last.Ref.ID}
+	if lq.sortField != "" {
+		cursor.Value, _ = last.DataAt(lq.sortField)
+	}
+	if t, ok := cursor.Value.(time.Time); ok {
+		cursor.Value = t.Format(time.RFC3339Nano)
+		cursor.IsTime = true
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodePageToken(token string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func sortKeys(spec listSpec) []string {
+	keys := make([]string, 0, len(spec.sorts))
+	for key := range spec.sorts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Firestore "in" queries accept at most this many values
+const maxInFilterValues = 30
+
+// List specs for the paginated endpoints
+
+var playerListSpec = listSpec{
+	filters: map[string]string{
+		"category":    "defaultCategory",
+		"nationality": "nationality",
+	},
+	customFilters: map[string]func(context.Context, *Server, firestore.Query, string) (firestore.Query, error){
+		"teamId": filterPlayersByTeam,
+	},
+	sorts: map[string]string{
+		"name":      "name",
+		"credits":   "defaultCredits",
+		"createdAt": "createdAt",
+	},
+}
+
+var teamListSpec = listSpec{
+	filters: map[string]string{"leagueId": "leagueId"},
+	sorts: map[string]string{
+		"name":      "name",
+		"code":      "code",
+		"createdAt": "createdAt",
+	},
+}
+
+var leagueListSpec = listSpec{
+	filters: map[string]string{"status": "status"},
+	sorts: map[string]string{
+		"name":      "name",
+		"startDate": "startDate",
+		"createdAt": "createdAt",
+	},
+}
+
+var contestListSpec = listSpec{
+	filters: map[string]string{
+		"matchId":    "matchId",
+		"status":     "status",
+		"templateId": "templateId",
+	},
+	sorts: map[string]string{
+		"createdAt":      "createdAt",
+		"entryFee":       "entryFee",
+		"totalPrizePool": "totalPrizePool",
+	},
+}
+
+var matchListSpec = listSpec{
+	filters: map[string]string{
+		"leagueId": "leagueId",
+		"status":   "status",
+	},
+	customFilters: map[string]func(context.Context, *Server, firestore.Query, string) (firestore.Query, error){
+		"teamId": filterMatchesByTeam,
+	},
+	sorts: map[string]string{
+		"startTime": "startTime",
+		"createdAt": "createdAt",
+	},
+}
+
+// Matches where the team plays on either side
+func filterMatchesByTeam(_ context.Context, _ *Server, q firestore.Query, teamID string) (firestore.Query, error) {
+	return q.WhereEntity(firestore.OrFilter{Filters: []firestore.EntityFilter{
+		firestore.PropertyFilter{Path: "team1Id", Operator: "==", Value: teamID},
+		firestore.PropertyFilter{Path: "team2Id", Operator: "==", Value: teamID},
+	}}), nil
+}
+
+// Players with an association to the team in force now. Players carry no team
+// field, so the IDs are resolved through teamPlayers first.
+func filterPlayersByTeam(ctx context.Context, s *Server, q firestore.Query, teamID string) (firestore.Query, error) {
+	associations, err := s.associationsOn(ctx, "teamId", teamID, time.Now().UTC())
+	if err != nil {
+		return q, err
+	}
+	playerIDs := []string{}
+	for _, association := range associations {
+		playerIDs = append(playerIDs, association.PlayerID)
+	}
+	if len(playerIDs) == 0 {
+		// An "in" filter needs at least one value; match nothing instead
+		playerIDs = append(playerIDs, "")
+	}
+	if len(playerIDs) > maxInFilterValues {
+		return q, errorf(ErrInvalidRequest, "Team has %d active players; teamId filter supports at most %d", len(playerIDs), maxInFilterValues)
+	}
+	return q.Where("playerId", "in", playerIDs), nil
+}
@@ -7,9 +7,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"crypto/rand"
 	"math/big"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -18,7 +21,10 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+
+	"fantasy-volleyball-backend/models"
 )
 
 type Server struct {
@@ -26,6 +32,14 @@ type Server struct {
 	authClient      *auth.Client
 	jwtSecret       []byte
 	otpStore        map[string]OTPData // In production, use Redis or database
+	apiSpec         *apiSpec
+	players         *playerIndex // search index, see search.go
+
+	// Background workers (schedulers, streaming hubs) run on bgCtx and are
+	// tracked by workers so shutdown can wait for them to finish.
+	bgCtx          context.Context
+	stopBackground context.CancelFunc
+	workers        sync.WaitGroup
 }
 
 type OTPData struct {
@@ -34,188 +48,60 @@ type OTPData struct {
 	Phone     string
 }
 
-type League struct {
-	LeagueID    string `json:"leagueId" firestore:"leagueId"`
-	Name        string `json:"name" firestore:"name"`
-	Description string `json:"description" firestore:"description"`
-	StartDate   string `json:"startDate" firestore:"startDate"`
-	EndDate     string `json:"endDate" firestore:"endDate"`
-	Status      string `json:"status" firestore:"status"`
-	CreatedAt   string `json:"createdAt" firestore:"createdAt"`
-}
-
-type Team struct {
-	TeamID      string `json:"teamId" firestore:"teamId"`
-	Name        string `json:"name" firestore:"name"`
-	Code        string `json:"code" firestore:"code"`
-	Logo        string `json:"logo" firestore:"logo"`
-	LeagueID    string `json:"leagueId" firestore:"leagueId"`
-	HomeCity    string `json:"homeCity" firestore:"homeCity"`
-	Captain     string `json:"captain" firestore:"captain"`
-	Coach       string `json:"coach" firestore:"coach"`
-	CreatedAt   string `json:"createdAt" firestore:"createdAt"`
-}
-
-type Squad struct {
-	SquadID     string   `json:"squadId" firestore:"squadId"`
-	TeamID      string   `json:"teamId" firestore:"teamId"`
-	PlayerIDs   []string `json:"playerIds" firestore:"playerIds"`
-	MatchID     string   `json:"matchId" firestore:"matchId"`
-	Starting6   []string `json:"starting6" firestore:"starting6"`
-	Substitutes []string `json:"substitutes" firestore:"substitutes"`
-	CreatedAt   string   `json:"createdAt" firestore:"createdAt"`
-}
-
-type Match struct {
-	MatchID     string   `json:"matchId" firestore:"matchId"`
-	LeagueID    string   `json:"leagueId" firestore:"leagueId"`
-	Team1ID     string   `json:"team1Id" firestore:"team1Id"`
-	Team2ID     string   `json:"team2Id" firestore:"team2Id"`
-	Team1       TeamInfo `json:"team1" firestore:"team1"`
-	Team2       TeamInfo `json:"team2" firestore:"team2"`
-	StartTime   string   `json:"startTime" firestore:"startTime"`
-	Status      string   `json:"status" firestore:"status"`
-	Venue       string   `json:"venue" firestore:"venue"`
-	Round       string   `json:"round" firestore:"round"`
-	CreatedAt   string   `json:"createdAt" firestore:"createdAt"`
-}
-
-type TeamInfo struct {
-	Name string `json:"name" firestore:"name"`
-	Code string `json:"code" firestore:"code"`
-	Logo string `json:"logo" firestore:"logo"`
-}
-
-type ContestTemplate struct {
-	TemplateID       string           `json:"templateId" firestore:"templateId"`
-	Name             string           `json:"name" firestore:"name"`
-	Description      string           `json:"description" firestore:"description"`
-	EntryFee         int              `json:"entryFee" firestore:"entryFee"`
-	TotalPrizePool   int              `json:"totalPrizePool" firestore:"totalPrizePool"`
-	MaxSpots         int              `json:"maxSpots" firestore:"maxSpots"`
-	MaxTeamsPerUser  int              `json:"maxTeamsPerUser" firestore:"maxTeamsPerUser"`
-	IsGuaranteed     bool             `json:"isGuaranteed" firestore:"isGuaranteed"`
-	PrizeDistribution []PrizeRank     `json:"prizeDistribution" firestore:"prizeDistribution"`
-	CreatedAt        string           `json:"createdAt" firestore:"createdAt"`
-}
-
-type PrizeRank struct {
-	RankStart    int    `json:"rankStart" firestore:"rankStart"`       // Starting rank (e.g., 1 for rank 1, 2 for rank 2-3)
-	RankEnd      int    `json:"rankEnd" firestore:"rankEnd"`           // Ending rank (e.g., 1 for rank 1, 3 for rank 2-3)
-	PrizeAmount  int    `json:"prizeAmount" firestore:"prizeAmount"`   // Cash prize amount (0 if kind)
-	PrizeType    string `json:"prizeType" firestore:"prizeType"`       // "cash" or "kind"
-	PrizeDesc    string `json:"prizeDesc" firestore:"prizeDesc"`       // Description for kind prizes
-}
-
-
-// Base player information - unique and permanent
-type Player struct {
-	PlayerID         string  `json:"playerId" firestore:"playerId"`
-	Name             string  `json:"name" firestore:"name"`
-	ImageURL         string  `json:"imageUrl" firestore:"imageUrl"`
-	DefaultCategory  string  `json:"defaultCategory" firestore:"defaultCategory"`
-	DefaultCredits   float64 `json:"defaultCredits" firestore:"defaultCredits"`
-	DateOfBirth      string  `json:"dateOfBirth" firestore:"dateOfBirth"`
-	Nationality      string  `json:"nationality" firestore:"nationality"`
-	CreatedAt        string  `json:"createdAt" firestore:"createdAt"`
-}
-
-// Team-Player association for a season/league
-type TeamPlayer struct {
-	AssociationID string  `json:"associationId" firestore:"associationId"`
-	PlayerID      string  `json:"playerId" firestore:"playerId"`
-	TeamID        string  `json:"teamId" firestore:"teamId"`
-	LeagueID      string  `json:"leagueId" firestore:"leagueId"`
-	Season        string  `json:"season" firestore:"season"`
-	JerseyNumber  int     `json:"jerseyNumber" firestore:"jerseyNumber"`
-	Role          string  `json:"role" firestore:"role"` // captain, vice-captain, player
-	StartDate     string  `json:"startDate" firestore:"startDate"`
-	EndDate       string  `json:"endDate" firestore:"endDate"`
-	IsActive      bool    `json:"isActive" firestore:"isActive"`
-	CreatedAt     string  `json:"createdAt" firestore:"createdAt"`
-}
-
-// Single match squad document containing all players for that match
-type MatchSquad struct {
-	MatchSquadID string             `json:"matchSquadId" firestore:"matchSquadId"`
-	MatchID      string             `json:"matchId" firestore:"matchId"`
-	Team1ID      string             `json:"team1Id" firestore:"team1Id"`
-	Team2ID      string             `json:"team2Id" firestore:"team2Id"`
-	Team1Players []MatchSquadPlayer `json:"team1Players" firestore:"team1Players"`
-	Team2Players []MatchSquadPlayer `json:"team2Players" firestore:"team2Players"`
-	CreatedAt    string             `json:"createdAt" firestore:"createdAt"`
-	UpdatedAt    string             `json:"updatedAt" firestore:"updatedAt"`
-}
-
-// Player information within a match squad
-type MatchSquadPlayer struct {
-	PlayerID            string            `json:"playerId" firestore:"playerId"`
-	PlayerName          string            `json:"playerName" firestore:"playerName"`
-	PlayerImageURL      string            `json:"playerImageUrl" firestore:"playerImageUrl"`
-	Category            string            `json:"category" firestore:"category"`
-	Credits             float64           `json:"credits" firestore:"credits"`
-	IsStarting6         bool              `json:"isStarting6" firestore:"isStarting6"`
-	JerseyNumber        int               `json:"jerseyNumber" firestore:"jerseyNumber"`
-	LastMatchPoints     int               `json:"lastMatchPoints" firestore:"lastMatchPoints"`
-	SelectionPercentage float64           `json:"selectionPercentage" firestore:"selectionPercentage"`
-	LiveStats           PlayerLiveStats   `json:"liveStats" firestore:"liveStats"`
-}
-
-type PlayerLiveStats struct {
-	Attacks            int     `json:"attacks" firestore:"attacks"`
-	Aces               int     `json:"aces" firestore:"aces"`
-	Blocks             int     `json:"blocks" firestore:"blocks"`
-	ReceptionsSuccess  int     `json:"receptionsSuccess" firestore:"receptionsSuccess"`
-	ReceptionErrors    int     `json:"receptionErrors" firestore:"receptionErrors"`
-	SetsPlayed         []int   `json:"setsPlayed" firestore:"setsPlayed"`
-	SetsAsStarter      []int   `json:"setsAsStarter" firestore:"setsAsStarter"`
-	SetsAsSubstitute   []int   `json:"setsAsSubstitute" firestore:"setsAsSubstitute"`
-	TotalPoints        int     `json:"totalPoints" firestore:"totalPoints"`
-}
+// Domain documents live in package models so cmd/fvimport can share them
+type (
+	League           = models.League
+	Team             = models.Team
+	Squad            = models.Squad
+	Match            = models.Match
+	TeamInfo         = models.TeamInfo
+	ContestTemplate  = models.ContestTemplate
+	PrizeRank        = models.PrizeRank
+	Player           = models.Player
+	TeamPlayer       = models.TeamPlayer
+	MatchSquad       = models.MatchSquad
+	MatchSquadPlayer = models.MatchSquadPlayer
+	PlayerLiveStats  = models.PlayerLiveStats
+	Contest          = models.Contest
+	UserTeam         = models.UserTeam
+	ContestTeam      = models.ContestTeam
+	User             = models.User
+	MatchEvent       = models.MatchEvent
+	SetScore         = models.SetScore
+	Refund           = models.Refund
+)
 
-type Contest struct {
-	ContestID         string       `json:"contestId" firestore:"contestId"`
-	MatchID           string       `json:"matchId" firestore:"matchId"`
-	TemplateID        string       `json:"templateId" firestore:"templateId"`
-	Name              string       `json:"name" firestore:"name"`
-	Description       string       `json:"description" firestore:"description"`
-	EntryFee          int          `json:"entryFee" firestore:"entryFee"`
-	TotalPrizePool    int          `json:"totalPrizePool" firestore:"totalPrizePool"`
-	MaxSpots          int          `json:"maxSpots" firestore:"maxSpots"`
-	SpotsLeft         int          `json:"spotsLeft" firestore:"spotsLeft"`
-	JoinedUsers       int          `json:"joinedUsers" firestore:"joinedUsers"`
-	MaxTeamsPerUser   int          `json:"maxTeamsPerUser" firestore:"maxTeamsPerUser"`
-	IsGuaranteed      bool         `json:"isGuaranteed" firestore:"isGuaranteed"`
-	PrizeDistribution []PrizeRank  `json:"prizeDistribution" firestore:"prizeDistribution"`
-	Status            string       `json:"status" firestore:"status"`
-	CreatedAt         string       `json:"createdAt" firestore:"createdAt"`
+// League as submitted by the admin portal; dates may be plain YYYY-MM-DD
+type LeagueRequest struct {
+	League
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
 }
 
-type UserTeam struct {
-	TeamID        string   `json:"teamId" firestore:"teamId"`
-	UserID        string   `json:"userId" firestore:"userId"`
-	MatchID       string   `json:"matchId" firestore:"matchId"`
-	ContestID     string   `json:"contestId" firestore:"contestId"`
-	TeamName      string   `json:"teamName" firestore:"teamName"`
-	Players       []string `json:"players" firestore:"players"`
-	CaptainID     string   `json:"captainId" firestore:"captainId"`
-	ViceCaptainID string   `json:"viceCaptainId" firestore:"viceCaptainId"`
-	TotalPoints   int      `json:"totalPoints" firestore:"totalPoints"`
-	Rank          int      `json:"rank" firestore:"rank"`
-	CreatedAt     string   `json:"createdAt" firestore:"createdAt"`
+// Normalise a league request, validating its timezone and reading dates in it
+func (req LeagueRequest) toLeague() (League, error) {
+	league := req.League
+	if league.Timezone == "" {
+		league.Timezone = defaultLeagueTimezone
+	}
+	loc, err := loadLeagueLocation(league.Timezone)
+	if err != nil {
+		return league, err
+	}
+	if league.StartDate, err = parseOptionalTimestamp("startDate", req.StartDate, loc); err != nil {
+		return league, err
+	}
+	if league.EndDate, err = parseOptionalTimestamp("endDate", req.EndDate, loc); err != nil {
+		return league, err
+	}
+	return league, nil
 }
 
-// ContestTeam represents a team participating in a specific contest
-type ContestTeam struct {
-	ContestTeamID string `json:"contestTeamId" firestore:"contestTeamId"`
-	ContestID     string `json:"contestId" firestore:"contestId"`
-	TeamID        string `json:"teamId" firestore:"teamId"`
-	UserID        string `json:"userId" firestore:"userId"`
-	MatchID       string `json:"matchId" firestore:"matchId"`
-	EntryFee      int    `json:"entryFee" firestore:"entryFee"`
-	TotalPoints   int    `json:"totalPoints" firestore:"totalPoints"`
-	Rank          int    `json:"rank" firestore:"rank"`
-	JoinedAt      string `json:"joinedAt" firestore:"joinedAt"`
+// Match as submitted by the admin portal; startTime may be a datetime-local
+// value without an offset, read in the league's timezone
+type MatchRequest struct {
+	Match
+	StartTime string `json:"startTime"`
 }
 
 // LeaderboardEntry represents an entry in contest leaderboard
@@ -257,16 +143,6 @@ type UserTeamInfo struct {
 	Rank     int    `json:"rank"`
 }
 
-type User struct {
-	UID                  string    `json:"uid" firestore:"uid"`
-	Phone                string    `json:"phone" firestore:"phone"`
-	Name                 string    `json:"name" firestore:"name"`
-	Email                string    `json:"email" firestore:"email"`
-	CreatedAt            time.Time `json:"createdAt" firestore:"createdAt"`
-	TotalContestsJoined  int       `json:"totalContestsJoined" firestore:"totalContestsJoined"`
-	TotalWins            int       `json:"totalWins" firestore:"totalWins"`
-}
-
 func main() {
 	ctx := context.Background()
 
@@ -283,7 +159,6 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create Firestore client: %v", err)
 	}
-	defer client.Close()
 
 	// Initialize Auth client
 	authClient, err := app.Auth(ctx)
@@ -297,14 +172,30 @@ func main() {
 		jwtSecret = []byte(secret)
 	}
 
+	spec, err := loadAPISpec()
+	if err != nil {
+		log.Fatalf("Failed to load API spec: %v", err)
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
 	server := &Server{
 		firestoreClient: client,
 		authClient:      authClient,
 		jwtSecret:       jwtSecret,
 		otpStore:        make(map[string]OTPData),
+		apiSpec:         spec,
+		players:         newPlayerIndex(),
+		bgCtx:           bgCtx,
+		stopBackground:  stopBackground,
 	}
 
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errorf(ErrNotFound, "No route for %s", r.URL.Path))
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errorf(ErrMethodNotAllowed, "%s is not allowed on %s", r.Method, r.URL.Path))
+	})
 
 	// CORS middleware
 	corsHandler := handlers.CORS(
@@ -322,25 +213,40 @@ func main() {
 			"X-Requested-With",
 			"Accept",
 			"Origin",
+			"X-Request-ID",
 		}),
+		handlers.ExposedHeaders([]string{"X-Request-ID", nextPageTokenHeader}),
 		handlers.AllowCredentials(),
 	)
 
+	// API documentation
+	router.HandleFunc("/api/openapi.json", server.getOpenAPI).Methods("GET")
+
 	// User Authentication routes
-	router.HandleFunc("/api/auth/send-otp", server.sendOTP).Methods("POST")
-	router.HandleFunc("/api/auth/verify-otp", server.verifyOTP).Methods("POST")
+	router.HandleFunc("/api/auth/send-otp", server.validateRequestBody(server.sendOTP)).Methods("POST")
+	router.HandleFunc("/api/auth/verify-otp", server.validateRequestBody(server.verifyOTP)).Methods("POST")
 	router.HandleFunc("/api/auth/logout", server.logout).Methods("POST")
 	
 	// Admin Authentication routes
-	router.HandleFunc("/api/admin/auth/login", server.adminLogin).Methods("POST")
+	router.HandleFunc("/api/admin/auth/login", server.validateRequestBody(server.adminLogin)).Methods("POST")
 	router.HandleFunc("/api/admin/auth/logout", server.adminLogout).Methods("POST")
 
 	// Public routes (no authentication required)
 	router.HandleFunc("/api/matches", server.getMatches).Methods("GET")
 	router.HandleFunc("/api/contests", server.getPublicContests).Methods("GET")
 	router.HandleFunc("/api/match-squads/match/{matchId}", server.getPublicMatchSquad).Methods("GET")
+	router.HandleFunc("/api/match-squads/match/{matchId}/versions/{version}", server.getSquadVersion).Methods("GET")
 	router.HandleFunc("/api/matches/{matchId}/players", server.getPlayersByMatch).Methods("GET")
 	router.HandleFunc("/api/matches/{matchId}/contests", server.getContestsByMatch).Methods("GET")
+	router.HandleFunc("/api/matches/{matchId}/center", server.getMatchCenter).Methods("GET")
+	router.HandleFunc("/api/matches/{matchId}/announcements", server.getMatchAnnouncements).Methods("GET")
+	router.HandleFunc("/api/leagues/{leagueId}/standings", server.getLeagueStandings).Methods("GET")
+	router.HandleFunc("/api/leagues/{leagueId}/brackets", server.getLeagueBrackets).Methods("GET")
+	router.HandleFunc("/api/players/search", server.searchPlayers).Methods("GET")
+	router.HandleFunc("/api/players/compare", server.comparePlayers).Methods("GET")
+	router.HandleFunc("/api/players/{playerId}", server.getPlayerProfile).Methods("GET")
+	router.HandleFunc("/api/players/{playerId}/history", server.getPlayerHistory).Methods("GET")
+	router.HandleFunc("/api/players/{playerId}/teams", server.getPlayerTeams).Methods("GET")
 	
 	// Protected routes (require user authentication)
 	router.HandleFunc("/api/contests/{contestId}/join", server.authMiddleware(server.joinContest)).Methods("POST")
@@ -349,6 +255,8 @@ func main() {
 	router.HandleFunc("/api/teams", server.authMiddleware(server.createUserTeam)).Methods("POST")
 	router.HandleFunc("/api/users/{userId}/teams", server.authMiddleware(server.getUserTeams)).Methods("GET")
 	router.HandleFunc("/api/users/{userId}/contests", server.authMiddleware(server.getUserContests)).Methods("GET")
+	router.HandleFunc("/api/users/{userId}/notifications", server.authMiddleware(server.getUserNotifications)).Methods("GET")
+	router.HandleFunc("/api/users/{userId}/notifications/{notificationId}/read", server.authMiddleware(server.readNotification)).Methods("POST")
 	router.HandleFunc("/api/users/{userId}", server.authMiddleware(server.getUserProfile)).Methods("GET")
 	
 	// Admin routes (require admin authentication) - Hierarchical structure
@@ -356,14 +264,26 @@ func main() {
 	router.HandleFunc("/api/admin/leagues", server.adminAuthMiddleware(server.getLeagues)).Methods("GET")
 	router.HandleFunc("/api/admin/leagues/{leagueId}", server.adminAuthMiddleware(server.updateLeague)).Methods("PUT")
 	router.HandleFunc("/api/admin/leagues/{leagueId}", server.adminAuthMiddleware(server.deleteLeague)).Methods("DELETE")
+	router.HandleFunc("/api/admin/leagues/{leagueId}/standings/rebuild", server.adminAuthMiddleware(server.rebuildLeagueStandings)).Methods("POST")
+	router.HandleFunc("/api/admin/leagues/{leagueId}/fixtures", server.adminAuthMiddleware(server.generateFixtures)).Methods("POST")
+	router.HandleFunc("/api/admin/leagues/{leagueId}/brackets", server.adminAuthMiddleware(server.createBracket)).Methods("POST")
+	router.HandleFunc("/api/admin/brackets/{bracketId}/advance", server.adminAuthMiddleware(server.advanceBracketNow)).Methods("POST")
 	router.HandleFunc("/api/admin/teams", server.adminAuthMiddleware(server.createAdminTeam)).Methods("POST")  
 	router.HandleFunc("/api/admin/teams", server.adminAuthMiddleware(server.getTeams)).Methods("GET")
 	router.HandleFunc("/api/admin/teams/{teamId}", server.adminAuthMiddleware(server.updateTeam)).Methods("PUT")
 	router.HandleFunc("/api/admin/teams/{teamId}", server.adminAuthMiddleware(server.deleteTeam)).Methods("DELETE")
+	router.HandleFunc("/api/admin/teams/{teamId}/sync-matches", server.adminAuthMiddleware(server.syncTeamMatches)).Methods("POST")
 	router.HandleFunc("/api/admin/squads", server.adminAuthMiddleware(server.createSquad)).Methods("POST")
 	router.HandleFunc("/api/admin/squads/{teamId}", server.adminAuthMiddleware(server.getTeamSquads)).Methods("GET")
 	router.HandleFunc("/api/admin/matches", server.adminAuthMiddleware(server.createMatch)).Methods("POST")
 	router.HandleFunc("/api/admin/matches", server.adminAuthMiddleware(server.getAdminMatches)).Methods("GET")
+	router.HandleFunc("/api/admin/matches/{matchId}/score", server.adminAuthMiddleware(server.updateMatchScore)).Methods("PUT")
+	router.HandleFunc("/api/admin/matches/{matchId}/score/rally", server.adminAuthMiddleware(server.scoreRally)).Methods("POST")
+	router.HandleFunc("/api/admin/matches/{matchId}/picks/recount", server.adminAuthMiddleware(server.recountMatchPicks)).Methods("POST")
+	router.HandleFunc("/api/admin/matches/{matchId}/events", server.adminAuthMiddleware(server.createMatchEvent)).Methods("POST")
+	router.HandleFunc("/api/admin/matches/{matchId}/events", server.adminAuthMiddleware(server.getMatchEvents)).Methods("GET")
+	router.HandleFunc("/api/admin/matches/{matchId}/events/undo", server.adminAuthMiddleware(server.undoMatchEvent)).Methods("POST")
+	router.HandleFunc("/api/admin/matches/{matchId}/events/recompute", server.adminAuthMiddleware(server.recomputeMatchEvents)).Methods("POST")
 	router.HandleFunc("/api/admin/contest-templates", server.adminAuthMiddleware(server.createContestTemplate)).Methods("POST")
 	router.HandleFunc("/api/admin/contest-templates", server.adminAuthMiddleware(server.getContestTemplates)).Methods("GET")
 	router.HandleFunc("/api/admin/contest-templates/{templateId}", server.adminAuthMiddleware(server.updateContestTemplate)).Methods("PUT")
@@ -376,94 +296,127 @@ func main() {
 	// Player management - new normalized schema
 	router.HandleFunc("/api/admin/players", server.adminAuthMiddleware(server.createPlayer)).Methods("POST")
 	router.HandleFunc("/api/admin/players", server.adminAuthMiddleware(server.getAllPlayers)).Methods("GET")
+	router.HandleFunc("/api/admin/players/duplicates", server.adminAuthMiddleware(server.getDuplicatePlayers)).Methods("GET")
+	router.HandleFunc("/api/admin/players/search", server.adminAuthMiddleware(server.searchPlayers)).Methods("GET")
+	router.HandleFunc("/api/admin/players/merge", server.adminAuthMiddleware(server.mergePlayers)).Methods("POST")
+	router.HandleFunc("/api/admin/players/merges", server.adminAuthMiddleware(server.getPlayerMerges)).Methods("GET")
+	router.HandleFunc("/api/admin/players/merges/{mergeId}/revert", server.adminAuthMiddleware(server.revertPlayerMerge)).Methods("POST")
 	router.HandleFunc("/api/admin/players/{playerId}", server.adminAuthMiddleware(server.getPlayerById)).Methods("GET")
 	router.HandleFunc("/api/admin/players/{playerId}", server.adminAuthMiddleware(server.updatePlayer)).Methods("PUT")
 	router.HandleFunc("/api/admin/players/{playerId}", server.adminAuthMiddleware(server.deletePlayer)).Methods("DELETE")
+	router.HandleFunc("/api/admin/players/{playerId}/price-changes", server.adminAuthMiddleware(server.getPlayerPriceChanges)).Methods("GET")
+	router.HandleFunc("/api/admin/players/{playerId}/availability", server.adminAuthMiddleware(server.setPlayerAvailability)).Methods("PUT")
+	router.HandleFunc("/api/admin/availability", server.adminAuthMiddleware(server.getAvailability)).Methods("GET")
 	
 	// Team-Player associations
 	router.HandleFunc("/api/admin/team-players", server.adminAuthMiddleware(server.createTeamPlayer)).Methods("POST")
 	router.HandleFunc("/api/admin/team-players/team/{teamId}", server.adminAuthMiddleware(server.getTeamAssociations)).Methods("GET")
 	router.HandleFunc("/api/admin/team-players/{associationId}", server.adminAuthMiddleware(server.deleteTeamPlayer)).Methods("DELETE")
+	router.HandleFunc("/api/admin/transfers", server.adminAuthMiddleware(server.transferPlayer)).Methods("POST")
+	router.HandleFunc("/api/admin/transfers", server.adminAuthMiddleware(server.getTransfers)).Methods("GET")
 	
 	// Match squads (single document per match)
 	router.HandleFunc("/api/admin/match-squads", server.adminAuthMiddleware(server.createMatchSquad)).Methods("POST")
 	router.HandleFunc("/api/admin/match-squads/match/{matchId}", server.adminAuthMiddleware(server.getMatchSquad)).Methods("GET")
 	router.HandleFunc("/api/admin/match-squads/match/{matchId}", server.adminAuthMiddleware(server.updateMatchSquad)).Methods("PUT")
+	router.HandleFunc("/api/admin/match-squads/match/{matchId}/versions", server.adminAuthMiddleware(server.getSquadVersions)).Methods("GET")
 	router.HandleFunc("/api/admin/match-squads/match/{matchId}/auto-assign", server.adminAuthMiddleware(server.autoAssignMatchSquad)).Methods("POST")
+	router.HandleFunc("/api/admin/match-squads/match/{matchId}/pricing", server.adminAuthMiddleware(server.getSquadPricing)).Methods("GET")
+	router.HandleFunc("/api/admin/match-squads/match/{matchId}/pricing", server.adminAuthMiddleware(server.applySquadPricing)).Methods("POST")
 	router.HandleFunc("/api/admin/match-squads/match/{matchId}/cleanup", server.adminAuthMiddleware(server.cleanupOldMatchPlayers)).Methods("DELETE")
+	router.HandleFunc("/api/admin/match-squads/match/{matchId}/scout", server.adminAuthMiddleware(server.uploadMatchScout)).Methods("POST")
+
+	// Data migrations
+	router.HandleFunc("/api/admin/migrations/timestamps", server.adminAuthMiddleware(server.migrateTimestamps)).Methods("POST")
+
+	spec.reportUndocumentedRoutes(router)
+
+	server.startPlayerIndex()
+	server.startLockSweep()
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	fmt.Printf("Server starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, corsHandler(router)))
+	httpServer := &http.Server{
+		Addr:              ":" + port,
+		Handler:           corsHandler(requestIDMiddleware(router)),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	// Cloud Run sends SIGTERM on scale-down and allows 10 seconds before SIGKILL
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server starting on port %s\n", port)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+		}
+	case sig := <-stop:
+		log.Printf("Received %v, shutting down", sig)
+	}
+
+	server.shutdown(httpServer, 8*time.Second)
 }
 
 // Get upcoming matches only (public endpoint)
 func (s *Server) getMatches(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	
-	// Get all matches and filter for upcoming ones
-	iter := s.firestoreClient.Collection("matches").Documents(ctx)
-	var matches []Match
+	// Upcoming matches in kick-off order
+	iter := s.firestoreClient.Collection("matches").
+		Where("startTime", ">", time.Now()).
+		OrderBy("startTime", firestore.Asc).
+		Documents(ctx)
+	matches := []Match{}
 	
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var match Match
 		doc.DataTo(&match)
-		
-		// Check if match is upcoming (try multiple date formats)
-		if match.StartTime != "" {
-			var startTime time.Time
-			var parseErr error
-			
-			// Try RFC3339 format first
-			if startTime, parseErr = time.Parse(time.RFC3339, match.StartTime); parseErr != nil {
-				// Try datetime-local format (YYYY-MM-DDTHH:MM)
-				if startTime, parseErr = time.Parse("2006-01-02T15:04", match.StartTime); parseErr != nil {
-					// Try with seconds
-					startTime, parseErr = time.Parse("2006-01-02T15:04:05", match.StartTime)
-				}
-			}
-			
-			if parseErr == nil && time.Now().Before(startTime) {
-				matches = append(matches, match)
-			}
-		} else {
-			// If no start time, include it (for testing)
-			matches = append(matches, match)
+		if !match.ArchivedAt.IsZero() {
+			continue
 		}
+		matches = append(matches, match)
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(matches)
+	writeJSON(w, http.StatusOK, matches)
 }
 
-// Get contests (public endpoint)
+// Get contests (public endpoint, paginated)
 func (s *Server) getPublicContests(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("contests").Documents(ctx)
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("contests").Query, contestListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	var contests []Contest
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var contest Contest
-		doc.DataTo(&contest)
-		contests = append(contests, contest)
+	contests, nextPageToken, err := fetchPage[Contest](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contests)
+	writeList(w, contests, nextPageToken)
 }
 
 // Get match squad (public endpoint)
@@ -471,50 +424,17 @@ func (s *Server) getPublicMatchSquad(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	matchId := vars["matchId"]
 	
-	ctx := context.Background()
-	doc, err := s.firestoreClient.Collection("matchSquads").Doc(matchId).Get(ctx)
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matchSquads").Doc(matchId), "Match squad")
 	if err != nil {
-		// No squad exists yet, return empty
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{})
-		return
-	}
-	
-	if !doc.Exists() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{})
+		writeError(w, r, err)
 		return
 	}
 	
 	var matchSquad MatchSquad
 	doc.DataTo(&matchSquad)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(matchSquad)
-}
-
-// Get players for a specific match
-func (s *Server) getPlayersByMatch(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	matchID := vars["matchId"]
-	
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("players").Where("matchId", "==", matchID).Documents(ctx)
-	
-	var players []Player
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var player Player
-		doc.DataTo(&player)
-		players = append(players, player)
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(players)
+	writeJSON(w, http.StatusOK, matchSquad)
 }
 
 // Get contests for a specific match
@@ -522,23 +442,29 @@ func (s *Server) getContestsByMatch(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	matchID := vars["matchId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	iter := s.firestoreClient.Collection("contests").Where("matchId", "==", matchID).Documents(ctx)
 	
 	var contests []Contest
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var contest Contest
 		doc.DataTo(&contest)
+		if !contest.ArchivedAt.IsZero() {
+			continue
+		}
 		contests = append(contests, contest)
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contests)
+	writeJSON(w, http.StatusOK, contests)
 }
 
 // Create a user team (for fantasy team creation)
@@ -552,55 +478,38 @@ func (s *Server) createUserTeam(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&teamRequest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
 	// Get user ID from context
 	userID, ok := r.Context().Value("userID").(string)
 	if !ok {
-		http.Error(w, "User ID not found", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrUnauthorized, "User ID not found"))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if match is still upcoming (not live or completed)
-	matchDoc, err := s.firestoreClient.Collection("matches").Doc(teamRequest.MatchID).Get(ctx)
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(teamRequest.MatchID), "Match")
 	if err != nil {
-		http.Error(w, "Match not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var match Match
 	matchDoc.DataTo(&match)
 	
-	// Parse match start time
-	matchTime, err := time.Parse(time.RFC3339, match.StartTime)
-	if err != nil {
-		// Try parsing as Unix timestamp or other formats
-		if match.StartTime != "" {
-			if timestamp, err2 := time.Parse("2006-01-02 15:04:05", match.StartTime); err2 == nil {
-				matchTime = timestamp
-			} else {
-				http.Error(w, "Invalid match start time format", http.StatusBadRequest)
-				return
-			}
-		} else {
-			http.Error(w, "Match start time not set", http.StatusBadRequest)
-			return
-		}
-	}
-	
 	// Check if match has already started
-	if time.Now().After(matchTime) {
-		http.Error(w, "Cannot create or edit teams for matches that have already started", http.StatusForbidden)
+	if err := checkMatchOpen(match, "create or edit teams"); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	
 	// Validate team composition
 	if len(teamRequest.Players) != 6 {
-		http.Error(w, "Team must have exactly 6 players", http.StatusBadRequest)
+		writeError(w, r, errorf(ErrTeamInvalid, "Team must have exactly 6 players"))
 		return
 	}
 	
@@ -616,18 +525,17 @@ func (s *Server) createUserTeam(w http.ResponseWriter, r *http.Request) {
 		ViceCaptainID: teamRequest.ViceCaptainID,
 		TotalPoints:   0,
 		Rank:          0,
-		CreatedAt:     time.Now().Format(time.RFC3339),
+		CreatedAt:     time.Now().UTC(),
 	}
 	
-	// Add team to Firestore
-	_, err = s.firestoreClient.Collection("userTeams").Doc(userTeam.TeamID).Set(ctx, userTeam)
+	// Add team to Firestore, counting its picks
+	err = s.saveUserTeam(ctx, userTeam, nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status": "success",
 		"teamId": userTeam.TeamID,
 		"teamName": userTeam.TeamName,
@@ -642,55 +550,47 @@ func (s *Server) joinContest(w http.ResponseWriter, r *http.Request) {
 	var joinRequest JoinContestRequest
 	
 	if err := json.NewDecoder(r.Body).Decode(&joinRequest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if match is still upcoming (not live or completed)
-	matchDoc, err := s.firestoreClient.Collection("matches").Doc(joinRequest.MatchID).Get(ctx)
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(joinRequest.MatchID), "Match")
 	if err != nil {
-		http.Error(w, "Match not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var match Match
 	matchDoc.DataTo(&match)
 	
-	// Parse match start time
-	matchTime, err := time.Parse(time.RFC3339, match.StartTime)
-	if err != nil {
-		// Try parsing as Unix timestamp
-		if match.StartTime != "" {
-			if timestamp, err2 := time.Parse("2006-01-02 15:04:05", match.StartTime); err2 == nil {
-				matchTime = timestamp
-			} else {
-				http.Error(w, "Invalid match start time format", http.StatusBadRequest)
-				return
-			}
-		} else {
-			http.Error(w, "Match start time not set", http.StatusBadRequest)
-			return
-		}
-	}
-	
 	// Check if match has already started
-	if time.Now().After(matchTime) {
-		http.Error(w, "Cannot join contests for matches that have already started", http.StatusForbidden)
+	if err := checkMatchOpen(match, "join contests"); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	
 	// Get contest details to get entry fee
-	contestDoc, err := s.firestoreClient.Collection("contests").Doc(contestID).Get(ctx)
+	contestDoc, err := getDocument(ctx, s.firestoreClient.Collection("contests").Doc(contestID), "Contest")
 	if err != nil {
-		http.Error(w, "Contest not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var contest Contest
 	contestDoc.DataTo(&contest)
 	
+	if !contest.ArchivedAt.IsZero() {
+		writeError(w, r, errorf(ErrConflict, "Contest has been cancelled"))
+		return
+	}
+	if contest.SpotsLeft < len(joinRequest.TeamIds) {
+		writeError(w, r, errorf(ErrContestFull, "Contest has %d spots left", contest.SpotsLeft))
+		return
+	}
+	
 	// Create contest team entries for each team
 	batch := s.firestoreClient.Batch()
 	teamsJoined := 0
@@ -707,7 +607,7 @@ func (s *Server) joinContest(w http.ResponseWriter, r *http.Request) {
 			EntryFee:      contest.EntryFee,
 			TotalPoints:   0,
 			Rank:          0,
-			JoinedAt:      time.Now().Format(time.RFC3339),
+			JoinedAt:      time.Now().UTC(),
 		}
 		
 		contestTeamRef := s.firestoreClient.Collection("contestTeams").Doc(contestTeamID)
@@ -725,12 +625,11 @@ func (s *Server) joinContest(w http.ResponseWriter, r *http.Request) {
 	// Commit all changes
 	_, err = batch.Commit(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status":      "joined",
 		"teamsJoined": teamsJoined,
 		"contestId":   contestID,
@@ -742,58 +641,91 @@ func (s *Server) getUserTeams(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	iter := s.firestoreClient.Collection("userTeams").Where("userId", "==", userID).Documents(ctx)
 	
 	var teams []UserTeam
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var team UserTeam
 		doc.DataTo(&team)
 		teams = append(teams, team)
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(teams)
+	writeJSON(w, http.StatusOK, teams)
 }
 
 // Admin: Create match
 func (s *Server) createMatch(w http.ResponseWriter, r *http.Request) {
-	var match Match
-	if err := json.NewDecoder(r.Body).Decode(&match); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req MatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	// Ensure required fields are set
+	ctx := r.Context()
+	
+	loc, err := s.leagueLocation(ctx, req.LeagueID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	team1, team2, err := s.loadMatchTeams(ctx, req.LeagueID, req.Team1ID, req.Team2ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Status != "" && req.Status != models.MatchUpcoming {
+		writeError(w, r, errorf(ErrInvalidRequest, "New matches are %s; results are entered through the score endpoints", models.MatchUpcoming))
+		return
+	}
+	
+	// Only the fixture comes from the client; team info is copied from the
+	// teams and the scoreboard starts empty
+	match := Match{
+		MatchID:   req.MatchID,
+		LeagueID:  req.LeagueID,
+		Team1ID:   team1.TeamID,
+		Team2ID:   team2.TeamID,
+		Team1:     team1.Info(),
+		Team2:     team2.Info(),
+		Status:    models.MatchUpcoming,
+		Venue:     req.Venue,
+		Round:     req.Round,
+		Stage:     models.StageLeague,
+		CreatedAt: time.Now().UTC(),
+	}
+	if match.StartTime, err = parseTimestamp(req.StartTime, loc); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "startTime: %v", err))
+		return
+	}
 	if match.MatchID == "" {
 		match.MatchID = fmt.Sprintf("match_%d", time.Now().UnixNano())
 	}
-	if match.CreatedAt == "" {
-		match.CreatedAt = time.Now().Format(time.RFC3339)
-	}
 	
-	ctx := context.Background()
-	// Use the matchId as the document ID
-	_, err := s.firestoreClient.Collection("matches").Doc(match.MatchID).Set(ctx, match)
+	// Use the matchId as the document ID; an existing match is not overwritten
+	_, err = s.firestoreClient.Collection("matches").Doc(match.MatchID).Create(ctx, match)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
 // Admin: Create player (new normalized schema)
 func (s *Server) createPlayer(w http.ResponseWriter, r *http.Request) {
 	var player Player
 	if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
@@ -801,30 +733,29 @@ func (s *Server) createPlayer(w http.ResponseWriter, r *http.Request) {
 	if player.PlayerID == "" {
 		player.PlayerID = fmt.Sprintf("player_%d", time.Now().UnixNano())
 	}
-	if player.CreatedAt == "" {
-		player.CreatedAt = time.Now().Format(time.RFC3339)
+	if player.CreatedAt.IsZero() {
+		player.CreatedAt = time.Now().UTC()
 	}
 	if player.Nationality == "" {
 		player.Nationality = "India"
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	// Use the playerId as the document ID so we can reference it later
 	_, err := s.firestoreClient.Collection("players").Doc(player.PlayerID).Set(ctx, player)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
 // Admin: Create contest
 func (s *Server) createContest(w http.ResponseWriter, r *http.Request) {
 	var contest Contest
 	if err := json.NewDecoder(r.Body).Decode(&contest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
@@ -832,41 +763,36 @@ func (s *Server) createContest(w http.ResponseWriter, r *http.Request) {
 	if contest.ContestID == "" {
 		contest.ContestID = fmt.Sprintf("contest_%d", time.Now().UnixNano())
 	}
-	if contest.CreatedAt == "" {
-		contest.CreatedAt = time.Now().Format(time.RFC3339)
+	if contest.CreatedAt.IsZero() {
+		contest.CreatedAt = time.Now().UTC()
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	// Use the contestId as the document ID
 	_, err := s.firestoreClient.Collection("contests").Doc(contest.ContestID).Set(ctx, contest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
-// Admin: Get contests
+// Admin: Get contests (paginated)
 func (s *Server) getContests(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("contests").Documents(ctx)
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("contests").Query, contestListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	var contests []Contest
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var contest Contest
-		doc.DataTo(&contest)
-		contests = append(contests, contest)
+	contests, nextPageToken, err := fetchPage[Contest](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contests)
+	writeList(w, contests, nextPageToken)
 }
 
 // Admin: Update contest
@@ -876,32 +802,26 @@ func (s *Server) updateContest(w http.ResponseWriter, r *http.Request) {
 	
 	var contest Contest
 	if err := json.NewDecoder(r.Body).Decode(&contest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if document exists first
-	doc, err := s.firestoreClient.Collection("contests").Doc(contestId).Get(ctx)
+	_, err := getDocument(ctx, s.firestoreClient.Collection("contests").Doc(contestId), "Contest")
 	if err != nil {
-		http.Error(w, "Contest not found", http.StatusNotFound)
-		return
-	}
-	
-	if !doc.Exists() {
-		http.Error(w, "Contest not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	_, err = s.firestoreClient.Collection("contests").Doc(contestId).Set(ctx, contest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
 // Admin: Delete contest
@@ -909,15 +829,11 @@ func (s *Server) deleteContest(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	contestId := vars["contestId"]
 	
-	ctx := context.Background()
-	_, err := s.firestoreClient.Collection("contests").Doc(contestId).Delete(ctx)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	s.softDelete(w, r, "contests", "Contest", contestId, func(ctx context.Context, p *archivePlan, doc *firestore.DocumentSnapshot) error {
+		var contest Contest
+		doc.DataTo(&contest)
+		return p.planContestEntries(ctx, contestId, contest)
+	}, firestore.Update{Path: "status", Value: "cancelled"})
 }
 
 // Admin: Update player scores
@@ -928,7 +844,7 @@ func (s *Server) updatePlayerScores(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&updateRequest); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
@@ -936,19 +852,18 @@ func (s *Server) updatePlayerScores(w http.ResponseWriter, r *http.Request) {
 	points := calculateVolleyballPoints(updateRequest.Stats)
 	updateRequest.Stats.TotalPoints = points
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	playerRef := s.firestoreClient.Collection("players").Doc(updateRequest.PlayerID)
 	_, err := playerRef.Update(ctx, []firestore.Update{
 		{Path: "liveStats", Value: updateRequest.Stats},
 	})
 	
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status": "updated",
 		"totalPoints": points,
 	})
@@ -975,6 +890,10 @@ func calculateVolleyballPoints(stats PlayerLiveStats) int {
 		points += 3  // Substitute points per set
 	}
 	
+	// Set results (Starting 6 only)
+	points += len(stats.SetsWon) * 6
+	points -= len(stats.SetsLost) * 3
+	
 	return points
 }
 
@@ -983,13 +902,13 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Authorization header required"))
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			http.Error(w, "Bearer token required", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Bearer token required"))
 			return
 		}
 
@@ -1001,19 +920,19 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		})
 
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Invalid token"))
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Invalid token claims"))
 			return
 		}
 
 		// Add user ID to request context
 		ctx := context.WithValue(r.Context(), "userID", claims["uid"])
-		next.ServeHTTP(w, r.WithContext(ctx))
+		s.validateRequestBody(next).ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
@@ -1024,7 +943,7 @@ func (s *Server) sendOTP(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 
@@ -1037,7 +956,7 @@ func (s *Server) sendOTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		generatedOTP, err := generateOTP()
 		if err != nil {
-			http.Error(w, "Failed to generate OTP", http.StatusInternalServerError)
+			writeError(w, r, fmt.Errorf("generate OTP: %w", err))
 			return
 		}
 		otp = generatedOTP
@@ -1053,8 +972,7 @@ func (s *Server) sendOTP(w http.ResponseWriter, r *http.Request) {
 	// Print OTP for development (in production, send SMS)
 	fmt.Printf("OTP for %s: %s\n", request.PhoneNumber, otp)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "success",
 		"message": "OTP sent successfully",
 	})
@@ -1068,32 +986,32 @@ func (s *Server) verifyOTP(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 
 	// Check OTP
 	storedOTP, exists := s.otpStore[request.PhoneNumber]
 	if !exists {
-		http.Error(w, "OTP not found or expired", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrUnauthorized, "OTP not found or expired"))
 		return
 	}
 
 	if time.Now().After(storedOTP.ExpiresAt) {
 		delete(s.otpStore, request.PhoneNumber)
-		http.Error(w, "OTP expired", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrUnauthorized, "OTP expired"))
 		return
 	}
 
 	if storedOTP.OTP != request.OTP {
-		http.Error(w, "Invalid OTP", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrUnauthorized, "Invalid OTP"))
 		return
 	}
 
 	// Clear OTP
 	delete(s.otpStore, request.PhoneNumber)
 
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Create or get user
 	userID := fmt.Sprintf("user_%d", time.Now().UnixNano())
@@ -1118,7 +1036,7 @@ func (s *Server) verifyOTP(w http.ResponseWriter, r *http.Request) {
 		// Create new user
 		_, err = userRef.Set(ctx, user)
 		if err != nil {
-			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			writeError(w, r, fmt.Errorf("create user: %w", err))
 			return
 		}
 	}
@@ -1133,7 +1051,7 @@ func (s *Server) verifyOTP(w http.ResponseWriter, r *http.Request) {
 
 	tokenString, err := token.SignedString(s.jwtSecret)
 	if err != nil {
-		http.Error(w, "Failed to create token", http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("sign user token: %w", err))
 		return
 	}
 
@@ -1146,8 +1064,7 @@ func (s *Server) verifyOTP(w http.ResponseWriter, r *http.Request) {
 		"profile": user,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 // Get user profile
@@ -1158,30 +1075,28 @@ func (s *Server) getUserProfile(w http.ResponseWriter, r *http.Request) {
 	// Verify user can access this profile (from JWT)
 	contextUserID := r.Context().Value("userID")
 	if contextUserID != userID {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrForbidden, "Cannot access another user's profile"))
 		return
 	}
 	
-	ctx := context.Background()
-	doc, err := s.firestoreClient.Collection("users").Doc(userID).Get(ctx)
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("users").Doc(userID), "User")
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var user User
 	doc.DataTo(&user)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, user)
 }
 
 // Logout
 func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
 	// In a stateless JWT setup, logout is handled client-side
 	// In production, you might want to maintain a blacklist of revoked tokens
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "success",
 		"message": "Logged out successfully",
 	})
@@ -1192,13 +1107,13 @@ func (s *Server) adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Authorization header required"))
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			http.Error(w, "Bearer token required", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Bearer token required"))
 			return
 		}
 
@@ -1210,26 +1125,26 @@ func (s *Server) adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		})
 
 		if err != nil || !token.Valid {
-			http.Error(w, "Invalid admin token", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Invalid admin token"))
 			return
 		}
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			writeError(w, r, errorf(ErrUnauthorized, "Invalid token claims"))
 			return
 		}
 
 		// Check if user is admin
 		role, ok := claims["role"].(string)
 		if !ok || role != "admin" {
-			http.Error(w, "Admin access required", http.StatusForbidden)
+			writeError(w, r, errorf(ErrForbidden, "Admin access required"))
 			return
 		}
 
 		// Add admin ID to request context
 		ctx := context.WithValue(r.Context(), "adminID", claims["uid"])
-		next.ServeHTTP(w, r.WithContext(ctx))
+		s.validateRequestBody(next).ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
@@ -1241,13 +1156,13 @@ func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 
 	// Simple hardcoded admin credentials (in production, use proper admin table)
 	if request.Username != "primevadmin" || request.Password != "PrimeV2024Admin" {
-		http.Error(w, "Invalid admin credentials", http.StatusUnauthorized)
+		writeError(w, r, errorf(ErrUnauthorized, "Invalid admin credentials"))
 		return
 	}
 
@@ -1263,7 +1178,7 @@ func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
 
 	tokenString, err := token.SignedString(s.jwtSecret)
 	if err != nil {
-		http.Error(w, "Failed to create admin token", http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("sign admin token: %w", err))
 		return
 	}
 
@@ -1276,14 +1191,12 @@ func (s *Server) adminLogin(w http.ResponseWriter, r *http.Request) {
 		"token": tokenString,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 // Admin logout
 func (s *Server) adminLogout(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"status": "success",
 		"message": "Admin logged out successfully",
 	})
@@ -1291,158 +1204,143 @@ func (s *Server) adminLogout(w http.ResponseWriter, r *http.Request) {
 
 // Admin: Create league
 func (s *Server) createLeague(w http.ResponseWriter, r *http.Request) {
-	var league League
-	if err := json.NewDecoder(r.Body).Decode(&league); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req LeagueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	league, err := req.toLeague()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if league.CreatedAt.IsZero() {
+		league.CreatedAt = time.Now().UTC()
+	}
+	
+	ctx := r.Context()
 	// Use the leagueId as the document ID so we can reference it later
-	_, err := s.firestoreClient.Collection("leagues").Doc(league.LeagueID).Set(ctx, league)
+	_, err = s.firestoreClient.Collection("leagues").Doc(league.LeagueID).Set(ctx, league)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
-// Admin: Get leagues
+// Admin: Get leagues (paginated)
 func (s *Server) getLeagues(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("leagues").Documents(ctx)
-	var leagues []League
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("leagues").Query, leagueListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var league League
-		doc.DataTo(&league)
-		leagues = append(leagues, league)
+	leagues, nextPageToken, err := fetchPage[League](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leagues)
+	writeList(w, leagues, nextPageToken)
 }
 
 // Admin: Create team
 func (s *Server) createAdminTeam(w http.ResponseWriter, r *http.Request) {
 	var team Team
 	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	// Use the teamId as the document ID so we can reference it later
 	_, err := s.firestoreClient.Collection("teams").Doc(team.TeamID).Set(ctx, team)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
-// Admin: Get teams
+// Admin: Get teams (paginated)
 func (s *Server) getTeams(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("teams").Documents(ctx)
-	var teams []Team
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("teams").Query, teamListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var team Team
-		doc.DataTo(&team)
-		teams = append(teams, team)
+	teams, nextPageToken, err := fetchPage[Team](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(teams)
+	writeList(w, teams, nextPageToken)
 }
 
 // Admin: Create contest template
 func (s *Server) createContestTemplate(w http.ResponseWriter, r *http.Request) {
 	var template ContestTemplate
 	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	// Use the templateId as the document ID so we can reference it later
 	_, err := s.firestoreClient.Collection("contestTemplates").Doc(template.TemplateID).Set(ctx, template)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "created"})
 }
 
 // Admin: Get contest templates
 func (s *Server) getContestTemplates(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	iter := s.firestoreClient.Collection("contestTemplates").Documents(ctx)
 	var templates []ContestTemplate
 	
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var template ContestTemplate
 		doc.DataTo(&template)
 		templates = append(templates, template)
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(templates)
+	writeJSON(w, http.StatusOK, templates)
 }
 
-// Admin: Create squad (placeholder)
-func (s *Server) createSquad(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created", "message": "Squad creation coming soon"})
-}
-
-// Admin: Get team squads (placeholder)
-func (s *Server) getTeamSquads(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode([]interface{}{})
-}
-
-// Admin: Get admin matches
+// Admin: Get admin matches (paginated)
 func (s *Server) getAdminMatches(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("matches").Documents(ctx)
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("matches").Query, matchListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	var matches []Match
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var match Match
-		doc.DataTo(&match)
-		matches = append(matches, match)
+	matches, nextPageToken, err := fetchPage[Match](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(matches)
+	writeList(w, matches, nextPageToken)
 }
 
 // Admin: Update league
@@ -1450,35 +1348,45 @@ func (s *Server) updateLeague(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	leagueId := vars["leagueId"]
 	
-	var league League
-	if err := json.NewDecoder(r.Body).Decode(&league); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	var req LeagueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
-	
-	// Check if document exists first
-	doc, err := s.firestoreClient.Collection("leagues").Doc(leagueId).Get(ctx)
+	league, err := req.toLeague()
 	if err != nil {
-		http.Error(w, "League not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
-	if !doc.Exists() {
-		http.Error(w, "League not found", http.StatusNotFound)
+	ctx := r.Context()
+	
+	// Check if document exists first
+	existingDoc, err := getDocument(ctx, s.firestoreClient.Collection("leagues").Doc(leagueId), "League")
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	var existing League
+	existingDoc.DataTo(&existing)
 	
 	// Use complete document replacement - this ensures all fields are consistent
 	_, err = s.firestoreClient.Collection("leagues").Doc(leagueId).Set(ctx, league)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	// Re-rank the standings under a new points scheme
+	if league.Scheme() != existing.Scheme() {
+		if _, err := s.writeStandings(ctx, leagueId, func(map[string]models.MatchResult) {}); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
 // Admin: Delete league
@@ -1486,15 +1394,9 @@ func (s *Server) deleteLeague(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	leagueId := vars["leagueId"]
 	
-	ctx := context.Background()
-	_, err := s.firestoreClient.Collection("leagues").Doc(leagueId).Delete(ctx)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	s.softDelete(w, r, "leagues", "League", leagueId, func(ctx context.Context, p *archivePlan, _ *firestore.DocumentSnapshot) error {
+		return p.planLeague(ctx, leagueId)
+	})
 }
 
 // Admin: Update team
@@ -1504,21 +1406,16 @@ func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request) {
 	
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if document exists first
-	doc, err := s.firestoreClient.Collection("teams").Doc(teamId).Get(ctx)
+	_, err := getDocument(ctx, s.firestoreClient.Collection("teams").Doc(teamId), "Team")
 	if err != nil {
-		http.Error(w, "Team not found", http.StatusNotFound)
-		return
-	}
-	
-	if !doc.Exists() {
-		http.Error(w, "Team not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
@@ -1545,12 +1442,20 @@ func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request) {
 	
 	_, err = s.firestoreClient.Collection("teams").Doc(teamId).Update(ctx, updateData)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	// Upcoming matches show the team's name, code and logo
+	matchesUpdated := 0
+	for _, field := range []string{"name", "code", "logo"} {
+		if _, ok := updates[field].(string); ok {
+			matchesUpdated = s.teamInfoChanged(ctx, teamId)
+			break
+		}
+	}
+	
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "updated", "matchesUpdated": matchesUpdated})
 }
 
 // Admin: Delete team
@@ -1558,15 +1463,9 @@ func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	teamId := vars["teamId"]
 	
-	ctx := context.Background()
-	_, err := s.firestoreClient.Collection("teams").Doc(teamId).Delete(ctx)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	s.softDelete(w, r, "teams", "Team", teamId, func(ctx context.Context, p *archivePlan, _ *firestore.DocumentSnapshot) error {
+		return p.planTeam(ctx, teamId)
+	})
 }
 
 // Admin: Update contest template
@@ -1576,21 +1475,16 @@ func (s *Server) updateContestTemplate(w http.ResponseWriter, r *http.Request) {
 	
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if document exists first
-	doc, err := s.firestoreClient.Collection("contestTemplates").Doc(templateId).Get(ctx)
+	_, err := getDocument(ctx, s.firestoreClient.Collection("contestTemplates").Doc(templateId), "Template")
 	if err != nil {
-		http.Error(w, "Template not found", http.StatusNotFound)
-		return
-	}
-	
-	if !doc.Exists() {
-		http.Error(w, "Template not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
@@ -1623,12 +1517,11 @@ func (s *Server) updateContestTemplate(w http.ResponseWriter, r *http.Request) {
 	
 	_, err = s.firestoreClient.Collection("contestTemplates").Doc(templateId).Update(ctx, updateData)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
 // Admin: Delete contest template
@@ -1636,36 +1529,31 @@ func (s *Server) deleteContestTemplate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	templateId := vars["templateId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	_, err := s.firestoreClient.Collection("contestTemplates").Doc(templateId).Delete(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
-// Admin: Get all players (master database)
+// Admin: Get all players (master database, paginated)
 func (s *Server) getAllPlayers(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("players").Documents(ctx)
+	lq, err := s.buildListQuery(r, s.firestoreClient.Collection("players").Query, playerListSpec)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	var players []Player
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var player Player
-		doc.DataTo(&player)
-		players = append(players, player)
+	players, nextPageToken, err := fetchPage[Player](r.Context(), lq)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(players)
+	writeList(w, players, nextPageToken)
 }
 
 // Admin: Get player by ID
@@ -1673,23 +1561,17 @@ func (s *Server) getPlayerById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	playerId := vars["playerId"]
 	
-	ctx := context.Background()
-	doc, err := s.firestoreClient.Collection("players").Doc(playerId).Get(ctx)
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("players").Doc(playerId), "Player")
 	if err != nil {
-		http.Error(w, "Player not found", http.StatusNotFound)
-		return
-	}
-	
-	if !doc.Exists() {
-		http.Error(w, "Player not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var player Player
 	doc.DataTo(&player)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(player)
+	writeJSON(w, http.StatusOK, player)
 }
 
 // Admin: Update player
@@ -1699,32 +1581,44 @@ func (s *Server) updatePlayer(w http.ResponseWriter, r *http.Request) {
 	
 	var player Player
 	if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Check if document exists first
-	doc, err := s.firestoreClient.Collection("players").Doc(playerId).Get(ctx)
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("players").Doc(playerId), "Player")
 	if err != nil {
-		http.Error(w, "Player not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
+	var previous Player
+	doc.DataTo(&previous)
 	
-	if !doc.Exists() {
-		http.Error(w, "Player not found", http.StatusNotFound)
-		return
+	// Default credit edits are audited alongside match prices
+	batch := s.firestoreClient.Batch()
+	batch.Set(s.firestoreClient.Collection("players").Doc(playerId), player)
+	if player.DefaultCredits != previous.DefaultCredits {
+		now := time.Now().UTC()
+		ref := s.priceChangeRef(playerId, now)
+		batch.Create(ref, models.PriceChange{
+			ChangeID:   ref.ID,
+			PlayerID:   playerId,
+			Source:     models.PriceSourceDefault,
+			OldCredits: previous.DefaultCredits,
+			NewCredits: player.DefaultCredits,
+			ChangedBy:  adminID(r),
+			ChangedAt:  now,
+		})
 	}
-	
-	_, err = s.firestoreClient.Collection("players").Doc(playerId).Set(ctx, player)
+	_, err = batch.Commit(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
 }
 
 // Admin: Delete player
@@ -1732,34 +1626,9 @@ func (s *Server) deletePlayer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	playerId := vars["playerId"]
 	
-	ctx := context.Background()
-	_, err := s.firestoreClient.Collection("players").Doc(playerId).Delete(ctx)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
-}
-
-// Admin: Create team-player association
-func (s *Server) createTeamPlayer(w http.ResponseWriter, r *http.Request) {
-	var association TeamPlayer
-	if err := json.NewDecoder(r.Body).Decode(&association); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	
-	ctx := context.Background()
-	_, err := s.firestoreClient.Collection("teamPlayers").Doc(association.AssociationID).Set(ctx, association)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	s.softDelete(w, r, "players", "Player", playerId, func(ctx context.Context, p *archivePlan, _ *firestore.DocumentSnapshot) error {
+		return p.planPlayer(ctx, playerId)
+	})
 }
 
 // Admin: Get team associations
@@ -1767,23 +1636,14 @@ func (s *Server) getTeamAssociations(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	teamId := vars["teamId"]
 	
-	ctx := context.Background()
-	iter := s.firestoreClient.Collection("teamPlayers").Where("teamId", "==", teamId).Where("isActive", "==", true).Documents(ctx)
-	
-	var associations []TeamPlayer
-	for {
-		doc, err := iter.Next()
-		if err != nil {
-			break
-		}
-		
-		var association TeamPlayer
-		doc.DataTo(&association)
-		associations = append(associations, association)
+	ctx := r.Context()
+	associations, err := s.associationsOn(ctx, "teamId", teamId, time.Now().UTC())
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(associations)
+	writeJSON(w, http.StatusOK, associations)
 }
 
 // Admin: Delete team-player association
@@ -1791,22 +1651,26 @@ func (s *Server) deleteTeamPlayer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	associationId := vars["associationId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	_, err := s.firestoreClient.Collection("teamPlayers").Doc(associationId).Delete(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
 // Admin: Create match squad (single document)
 func (s *Server) createMatchSquad(w http.ResponseWriter, r *http.Request) {
 	var matchSquad MatchSquad
 	if err := json.NewDecoder(r.Body).Decode(&matchSquad); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	
+	if matchSquad.MatchID == "" {
+		writeError(w, r, errorf(ErrInvalidRequest, "matchId is required"))
 		return
 	}
 	
@@ -1814,21 +1678,60 @@ func (s *Server) createMatchSquad(w http.ResponseWriter, r *http.Request) {
 	if matchSquad.MatchSquadID == "" {
 		matchSquad.MatchSquadID = fmt.Sprintf("squad_%s", matchSquad.MatchID)
 	}
-	if matchSquad.CreatedAt == "" {
-		matchSquad.CreatedAt = time.Now().Format(time.RFC3339)
+	if matchSquad.CreatedAt.IsZero() {
+		matchSquad.CreatedAt = time.Now().UTC()
+	}
+	edit, err := squadEditFrom(r, models.SquadSourceCreate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	
+	ctx := r.Context()
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchSquad.MatchID), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	matchDoc.DataTo(&match)
+	// Form comes from the player history, not the client
+	if err := s.applyForm(ctx, match, matchSquad.Team1Players, matchSquad.Team2Players); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.applyAvailability(ctx, match, matchSquad.Team1Players, matchSquad.Team2Players); err != nil {
+		writeError(w, r, err)
+		return
 	}
-	matchSquad.UpdatedAt = time.Now().Format(time.RFC3339)
 	
-	ctx := context.Background()
 	// Use the matchId as the document ID for easy retrieval
-	_, err := s.firestoreClient.Collection("matchSquads").Doc(matchSquad.MatchID).Set(ctx, matchSquad)
+	var version *models.SquadVersion
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		prev, err := s.loadSquadTx(tx, matchSquad.MatchID)
+		if err != nil {
+			return err
+		}
+		// Pick rates come from the stored counts, not the client
+		counts, err := s.loadPicksTx(tx, matchSquad.MatchID)
+		if err != nil {
+			return err
+		}
+		applyPicks(counts, matchSquad.Team1Players, matchSquad.Team2Players)
+		keepLiveStats(prev, matchSquad.Team1Players, matchSquad.Team2Players)
+		edit.Source = models.SquadSourceCreate
+		if prev != nil {
+			edit.Source = models.SquadSourceEdit
+		}
+		version, err = s.saveSquad(tx, match, prev, &matchSquad, edit)
+		return err
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "created", "version": matchSquad.Version, "changes": versionChanges(version)})
 }
 
 // Admin: Get match squad (single document)
@@ -1836,26 +1739,17 @@ func (s *Server) getMatchSquad(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	matchId := vars["matchId"]
 	
-	ctx := context.Background()
-	doc, err := s.firestoreClient.Collection("matchSquads").Doc(matchId).Get(ctx)
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matchSquads").Doc(matchId), "Match squad")
 	if err != nil {
-		// No squad exists yet, return empty
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{})
-		return
-	}
-	
-	if !doc.Exists() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{})
+		writeError(w, r, err)
 		return
 	}
 	
 	var matchSquad MatchSquad
 	doc.DataTo(&matchSquad)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(matchSquad)
+	writeJSON(w, http.StatusOK, matchSquad)
 }
 
 // Admin: Update match squad (single document update)
@@ -1865,126 +1759,142 @@ func (s *Server) updateMatchSquad(w http.ResponseWriter, r *http.Request) {
 	
 	var matchSquad MatchSquad
 	if err := json.NewDecoder(r.Body).Decode(&matchSquad); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
 		return
 	}
 	
-	// Set update timestamp
-	matchSquad.UpdatedAt = time.Now().Format(time.RFC3339)
+	edit, err := squadEditFrom(r, models.SquadSourceEdit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	ctx := context.Background()
-	// Update the entire squad document
-	_, err := s.firestoreClient.Collection("matchSquads").Doc(matchId).Set(ctx, matchSquad)
+	ctx := r.Context()
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchId), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	matchDoc.DataTo(&match)
+	// Form comes from the player history and availability from the player's
+	// status, not the client
+	if err := s.applyForm(ctx, match, matchSquad.Team1Players, matchSquad.Team2Players); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.applyAvailability(ctx, match, matchSquad.Team1Players, matchSquad.Team2Players); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	
+	// Replace the squad as a new version; after lock only with an override,
+	// which records the fantasy teams it touches
+	var version *models.SquadVersion
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		prev, err := s.loadSquadTx(tx, matchId)
+		if err != nil {
+			return err
+		}
+		// Pick rates come from the stored counts, not the client
+		counts, err := s.loadPicksTx(tx, matchId)
+		if err != nil {
+			return err
+		}
+		applyPicks(counts, matchSquad.Team1Players, matchSquad.Team2Players)
+		keepLiveStats(prev, matchSquad.Team1Players, matchSquad.Team2Players)
+		if prev != nil && matchSquad.CreatedAt.IsZero() {
+			matchSquad.CreatedAt = prev.CreatedAt
+		}
+		version, err = s.saveSquad(tx, match, prev, &matchSquad, edit)
+		return err
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "updated", "version": matchSquad.Version, "changes": versionChanges(version), "override": versionOverride(version)})
 }
 
 // Admin: Auto-assign squad from team players (backend logic)
 func (s *Server) autoAssignMatchSquad(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	matchId := vars["matchId"]
+	edit, err := squadEditFrom(r, models.SquadSourceAutoAssign)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Get match details by searching for matchId field
 	matchIter := s.firestoreClient.Collection("matches").Where("matchId", "==", matchId).Documents(ctx)
 	matchDoc, err := matchIter.Next()
+	if err == iterator.Done {
+		writeError(w, r, errorf(ErrNotFound, "Match not found"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Match not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var match Match
 	matchDoc.DataTo(&match)
 	
-	// Get team players for both teams
-	team1Iter := s.firestoreClient.Collection("teamPlayers").Where("teamId", "==", match.Team1ID).Where("isActive", "==", true).Documents(ctx)
-	team2Iter := s.firestoreClient.Collection("teamPlayers").Where("teamId", "==", match.Team2ID).Where("isActive", "==", true).Documents(ctx)
-	
-	var team1Players []MatchSquadPlayer
-	var team2Players []MatchSquadPlayer
-	
-	// Process team 1 players
-	for {
-		doc, err := team1Iter.Next()
+	// Starters come from announced lineups; until a team announces, none of
+	// its players is marked as starting
+	var sides [2][]MatchSquadPlayer
+	var lineupAt [2]time.Time
+	for i, teamID := range []string{match.Team1ID, match.Team2ID} {
+		roster, err := s.teamRoster(ctx, teamID, match.StartTime)
 		if err != nil {
-			break
+			writeError(w, r, err)
+			return
 		}
-		
-		var teamPlayer TeamPlayer
-		doc.DataTo(&teamPlayer)
-		
-		// Get player details
-		playerDoc, playerErr := s.firestoreClient.Collection("players").Doc(teamPlayer.PlayerID).Get(ctx)
-		if playerErr != nil || !playerDoc.Exists() {
-			continue
+		if sides[i], err = s.squadPlayers(ctx, roster, rosterPlayerIDs(roster)); err != nil {
+			writeError(w, r, err)
+			return
 		}
 		
-		var player Player
-		playerDoc.DataTo(&player)
-		
-		squadPlayer := MatchSquadPlayer{
-			PlayerID:            player.PlayerID,
-			PlayerName:          player.Name,
-			PlayerImageURL:      player.ImageURL,
-			Category:            player.DefaultCategory,
-			Credits:             player.DefaultCredits,
-			IsStarting6:         teamPlayer.Role == "captain" || len(team1Players) < 6, // First 6 are starting
-			JerseyNumber:        teamPlayer.JerseyNumber,
-			LastMatchPoints:     0,
-			SelectionPercentage: 50.0,
-			LiveStats: PlayerLiveStats{
-				Attacks: 0, Aces: 0, Blocks: 0, ReceptionsSuccess: 0, ReceptionErrors: 0,
-				SetsPlayed: []int{}, SetsAsStarter: []int{}, SetsAsSubstitute: []int{}, TotalPoints: 0,
-			},
-		}
-		team1Players = append(team1Players, squadPlayer)
-	}
-	
-	// Process team 2 players
-	for {
-		doc, err := team2Iter.Next()
+		lineup, err := s.announcedLineup(ctx, matchId, teamID)
 		if err != nil {
-			break
-		}
-		
-		var teamPlayer TeamPlayer
-		doc.DataTo(&teamPlayer)
-		
-		// Get player details
-		playerDoc, playerErr := s.firestoreClient.Collection("players").Doc(teamPlayer.PlayerID).Get(ctx)
-		if playerErr != nil || !playerDoc.Exists() {
-			continue
+			writeError(w, r, err)
+			return
 		}
-		
-		var player Player
-		playerDoc.DataTo(&player)
-		
-		squadPlayer := MatchSquadPlayer{
-			PlayerID:            player.PlayerID,
-			PlayerName:          player.Name,
-			PlayerImageURL:      player.ImageURL,
-			Category:            player.DefaultCategory,
-			Credits:             player.DefaultCredits,
-			IsStarting6:         teamPlayer.Role == "captain" || len(team2Players) < 6, // First 6 are starting
-			JerseyNumber:        teamPlayer.JerseyNumber,
-			LastMatchPoints:     0,
-			SelectionPercentage: 50.0,
-			LiveStats: PlayerLiveStats{
-				Attacks: 0, Aces: 0, Blocks: 0, ReceptionsSuccess: 0, ReceptionErrors: 0,
-				SetsPlayed: []int{}, SetsAsStarter: []int{}, SetsAsSubstitute: []int{}, TotalPoints: 0,
-			},
+		if lineup != nil {
+			models.ApplyLineup(sides[i], lineup)
+			lineupAt[i] = lineup.AnnouncedAt
 		}
-		team2Players = append(team2Players, squadPlayer)
 	}
+	counts, err := s.loadPicks(ctx, matchId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	applyPicks(counts, sides[0], sides[1])
+	if err := s.applyForm(ctx, match, sides[0], sides[1]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Injured, suspended and travelling-reserve players are left out; doubtful
+	// ones stay in, flagged
+	if err := s.applyAvailability(ctx, match, sides[0], sides[1]); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	unavailable := []string{}
+	for i := range sides {
+		var left []string
+		sides[i], left = withoutUnavailable(sides[i])
+		unavailable = append(unavailable, left...)
+	}
+	team1Players, team2Players := sides[0], sides[1]
 	
 	if len(team1Players) == 0 && len(team2Players) == 0 {
-		http.Error(w, "No team players found. Please assign players to teams first.", http.StatusBadRequest)
+		writeError(w, r, errorf(ErrInvalidRequest, "No team players found. Please assign players to teams first."))
 		return
 	}
 	
@@ -1996,23 +1906,38 @@ func (s *Server) autoAssignMatchSquad(w http.ResponseWriter, r *http.Request) {
 		Team2ID:      match.Team2ID,
 		Team1Players: team1Players,
 		Team2Players: team2Players,
-		CreatedAt:    time.Now().Format(time.RFC3339),
-		UpdatedAt:    time.Now().Format(time.RFC3339),
+		Team1LineupAt: lineupAt[0],
+		Team2LineupAt: lineupAt[1],
+		CreatedAt:    time.Now().UTC(),
+		UpdatedAt:    time.Now().UTC(),
 	}
 	
-	// Save to database
-	_, err = s.firestoreClient.Collection("matchSquads").Doc(matchId).Set(ctx, matchSquad)
+	// Save to database as a new version
+	var version *models.SquadVersion
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		prev, err := s.loadSquadTx(tx, matchId)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			matchSquad.CreatedAt = prev.CreatedAt
+		}
+		keepLiveStats(prev, matchSquad.Team1Players, matchSquad.Team2Players)
+		version, err = s.saveSquad(tx, match, prev, &matchSquad, edit)
+		return err
+	})
 	if err != nil {
-		http.Error(w, "Failed to create match squad", http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("save match squad: %w", err))
 		return
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status": "success",
 		"message": fmt.Sprintf("Auto-assigned %d players (%d team1, %d team2) to match squad", 
 			len(team1Players)+len(team2Players), len(team1Players), len(team2Players)),
 		"squad": matchSquad,
+		"unavailable": unavailable,
+		"changes": versionChanges(version),
 	})
 }
 
@@ -2021,7 +1946,7 @@ func (s *Server) cleanupOldMatchPlayers(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	matchId := vars["matchId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Delete all old matchPlayers documents for this match
 	iter := s.firestoreClient.Collection("matchPlayers").Where("matchId", "==", matchId).Documents(ctx)
@@ -2029,9 +1954,13 @@ func (s *Server) cleanupOldMatchPlayers(w http.ResponseWriter, r *http.Request)
 	
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		_, deleteErr := doc.Ref.Delete(ctx)
 		if deleteErr == nil {
@@ -2039,8 +1968,7 @@ func (s *Server) cleanupOldMatchPlayers(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"status": "cleaned",
 		"deletedCount": deletedCount,
 	})
@@ -2048,8 +1976,7 @@ func (s *Server) cleanupOldMatchPlayers(w http.ResponseWriter, r *http.Request)
 
 // Admin: Update match player stats (placeholder)
 func (s *Server) updateMatchPlayerStats(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated", "message": "Match stats update coming soon"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated", "message": "Match stats update coming soon"})
 }
 
 // Get user's joined contests
@@ -2058,7 +1985,7 @@ func (s *Server) getUserContests(w http.ResponseWriter, r *http.Request) {
 	userID := vars["userId"]
 	matchID := r.URL.Query().Get("matchId") // Optional match filter
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Query contest teams for this user
 	query := s.firestoreClient.Collection("contestTeams").Where("userId", "==", userID)
@@ -2071,9 +1998,13 @@ func (s *Server) getUserContests(w http.ResponseWriter, r *http.Request) {
 	
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var contestTeam ContestTeam
 		doc.DataTo(&contestTeam)
@@ -2124,8 +2055,7 @@ func (s *Server) getUserContests(w http.ResponseWriter, r *http.Request) {
 		contests = append(contests, *contest)
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contests)
+	writeJSON(w, http.StatusOK, contests)
 }
 
 // Get contest leaderboard
@@ -2133,7 +2063,7 @@ func (s *Server) getContestLeaderboard(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	contestID := vars["contestId"]
 	
-	ctx := context.Background()
+	ctx := r.Context()
 	
 	// Get all contest teams for this contest, ordered by points
 	iter := s.firestoreClient.Collection("contestTeams").
@@ -2149,9 +2079,13 @@ func (s *Server) getContestLeaderboard(w http.ResponseWriter, r *http.Request) {
 	
 	for {
 		doc, err := iter.Next()
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 		
 		var contestTeam ContestTeam
 		doc.DataTo(&contestTeam)
@@ -2205,8 +2139,7 @@ func (s *Server) getContestLeaderboard(w http.ResponseWriter, r *http.Request) {
 		lastPoints = contestTeam.TotalPoints
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(leaderboard)
+	writeJSON(w, http.StatusOK, leaderboard)
 }
 
 // Get contest details
@@ -2214,24 +2147,22 @@ func (s *Server) getContestDetails(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	contestID := vars["contestId"]
 	
-	ctx := context.Background()
-	contestDoc, err := s.firestoreClient.Collection("contests").Doc(contestID).Get(ctx)
+	ctx := r.Context()
+	contestDoc, err := getDocument(ctx, s.firestoreClient.Collection("contests").Doc(contestID), "Contest")
 	if err != nil {
-		http.Error(w, "Contest not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 	
 	var contest Contest
 	contestDoc.DataTo(&contest)
 	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contest)
+	writeJSON(w, http.StatusOK, contest)
 }
 
 // Admin: Update player stats (placeholder)  
 func (s *Server) updatePlayerStats(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "updated", "message": "Stats update coming soon"})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "updated", "message": "Stats update coming soon"})
 }
 
 // Generate 6-digit OTP
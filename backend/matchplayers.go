@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// A squad player as listed for a match, with their team's code and logo
+type MatchPlayer struct {
+	MatchSquadPlayer
+	TeamID   string `json:"teamId"`
+	TeamCode string `json:"teamCode"`
+	TeamLogo string `json:"teamLogo"`
+}
+
+type MatchPlayersTeam struct {
+	TeamID          string    `json:"teamId"`
+	Team            TeamInfo  `json:"team"`
+	LineupAnnounced bool      `json:"lineupAnnounced"`
+	LineupAt        time.Time `json:"lineupAt"`
+}
+
+type MatchPlayerCategory struct {
+	Category string        `json:"category"`
+	Players  []MatchPlayer `json:"players"`
+}
+
+// Everything the team builder needs for a match's player pool
+type MatchPlayers struct {
+	MatchID    string                `json:"matchId"`
+	Team1      MatchPlayersTeam      `json:"team1"`
+	Team2      MatchPlayersTeam      `json:"team2"`
+	TotalTeams int                   `json:"totalTeams"` // fantasy teams the pick rates are out of
+	Categories []MatchPlayerCategory `json:"categories"`
+}
+
+// Get the player pool for a match from its squad, grouped by category with
+// lineup status and pick rates (public endpoint). Tagged with an ETag so
+// clients can poll it cheaply.
+func (s *Server) getPlayersByMatch(w http.ResponseWriter, r *http.Request) {
+	matchID := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchID), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	matchDoc.DataTo(&match)
+
+	// A match without a squad yet has an empty pool
+	var squad MatchSquad
+	squadDoc, err := s.firestoreClient.Collection("matchSquads").Doc(matchID).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		writeError(w, r, err)
+		return
+	}
+	if err == nil {
+		squadDoc.DataTo(&squad)
+	}
+
+	counts, err := s.loadPicks(ctx, matchID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	result := MatchPlayers{
+		MatchID:    matchID,
+		Team1:      MatchPlayersTeam{TeamID: match.Team1ID, Team: match.Team1, LineupAnnounced: !squad.Team1LineupAt.IsZero(), LineupAt: squad.Team1LineupAt},
+		Team2:      MatchPlayersTeam{TeamID: match.Team2ID, Team: match.Team2, LineupAnnounced: !squad.Team2LineupAt.IsZero(), LineupAt: squad.Team2LineupAt},
+		TotalTeams: counts.Teams,
+	}
+	byCategory := map[string][]MatchPlayer{}
+	for _, side := range []struct {
+		team    MatchPlayersTeam
+		players []MatchSquadPlayer
+	}{{result.Team1, squad.Team1Players}, {result.Team2, squad.Team2Players}} {
+		for _, player := range side.players {
+			counts.Apply(&player)
+			byCategory[player.Category] = append(byCategory[player.Category], MatchPlayer{
+				MatchSquadPlayer: player,
+				TeamID:           side.team.TeamID,
+				TeamCode:         side.team.Team.Code,
+				TeamLogo:         side.team.Team.Logo,
+			})
+		}
+	}
+
+	// Known categories in their usual order, then any others alphabetically
+	categories := append([]string{}, models.Categories...)
+	var others []string
+	for category := range byCategory {
+		if !slices.Contains(models.Categories, category) {
+			others = append(others, category)
+		}
+	}
+	sort.Strings(others)
+	result.Categories = []MatchPlayerCategory{}
+	for _, category := range append(categories, others...) {
+		players := byCategory[category]
+		if len(players) == 0 {
+			continue
+		}
+		// Starters first, then the priciest
+		sort.SliceStable(players, func(i, j int) bool {
+			if players[i].IsStarting6 != players[j].IsStarting6 {
+				return players[i].IsStarting6
+			}
+			if players[i].Credits != players[j].Credits {
+				return players[i].Credits > players[j].Credits
+			}
+			return strings.ToLower(players[i].PlayerName) < strings.ToLower(players[j].PlayerName)
+		})
+		result.Categories = append(result.Categories, MatchPlayerCategory{Category: category, Players: players})
+	}
+
+	writeJSONWithETag(w, r, result)
+}
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Most duplicate pairs reported at once
+const maxDuplicatePairs = 200
+
+type DuplicatePlayer struct {
+	PlayerID     string    `json:"playerId"`
+	Name         string    `json:"name"`
+	DateOfBirth  string    `json:"dateOfBirth"`
+	Nationality  string    `json:"nationality"`
+	Category     string    `json:"category"`
+	TeamIDs      []string  `json:"teamIds"` // every team the player has been associated with
+	Associations int       `json:"associations"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Two players that are likely the same person
+type DuplicateCandidate struct {
+	Players             [2]DuplicatePlayer `json:"players"`
+	Score               float64            `json:"score"`
+	Reasons             []string           `json:"reasons"`
+	SuggestedSurvivorID string             `json:"suggestedSurvivorId"` // most associations, then the oldest
+}
+
+// Likely duplicates among live players, highest score first. Only players
+// sharing the start of a phonetic name word are compared.
+func (ix *playerIndex) duplicates(minScore float64) []DuplicateCandidate {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	evidence := map[string]models.DuplicateEvidence{}
+	summaries := map[string]*DuplicatePlayer{}
+	blocks := map[string][]string{}
+	for id, p := range ix.players {
+		if !p.player.ArchivedAt.IsZero() {
+			continue
+		}
+		evidence[id] = models.DuplicateEvidence{Name: p.name, DateOfBirth: p.player.DateOfBirth, Jerseys: map[string]int{}}
+		summaries[id] = &DuplicatePlayer{
+			PlayerID:    id,
+			Name:        p.player.Name,
+			DateOfBirth: p.player.DateOfBirth,
+			Nationality: p.player.Nationality,
+			Category:    p.player.DefaultCategory,
+			TeamIDs:     []string{},
+			CreatedAt:   p.player.CreatedAt,
+		}
+		for _, key := range p.name.BlockKeys() {
+			if !slices.Contains(blocks[key], id) {
+				blocks[key] = append(blocks[key], id)
+			}
+		}
+	}
+	for _, a := range ix.associations {
+		e, ok := evidence[a.PlayerID]
+		if !ok {
+			continue
+		}
+		e.Jerseys[a.TeamID] = a.JerseyNumber
+		summary := summaries[a.PlayerID]
+		summary.Associations++
+		if !slices.Contains(summary.TeamIDs, a.TeamID) {
+			summary.TeamIDs = append(summary.TeamIDs, a.TeamID)
+		}
+	}
+
+	seen := map[[2]string]bool{}
+	candidates := []DuplicateCandidate{}
+	for _, ids := range blocks {
+		for i := range ids {
+			for j := i + 1; j < len(ids); j++ {
+				pair := [2]string{ids[i], ids[j]}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				if seen[pair] {
+					continue
+				}
+				seen[pair] = true
+				score, reasons := models.DuplicateScore(evidence[pair[0]], evidence[pair[1]])
+				if score < minScore {
+					continue
+				}
+				a, b := *summaries[pair[0]], *summaries[pair[1]]
+				sort.Strings(a.TeamIDs)
+				sort.Strings(b.TeamIDs)
+				survivor := a.PlayerID
+				if b.Associations > a.Associations || (b.Associations == a.Associations && b.CreatedAt.Before(a.CreatedAt)) {
+					survivor = b.PlayerID
+				}
+				candidates = append(candidates, DuplicateCandidate{
+					Players:             [2]DuplicatePlayer{a, b},
+					Score:               score,
+					Reasons:             reasons,
+					SuggestedSurvivorID: survivor,
+				})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Players[0].PlayerID < candidates[j].Players[0].PlayerID
+	})
+	if len(candidates) > maxDuplicatePairs {
+		candidates = candidates[:maxDuplicatePairs]
+	}
+	return candidates
+}
+
+// Admin: List likely duplicate players by name similarity, date of birth and
+// team history; ?minScore= (default 0.6) sets the bar
+func (s *Server) getDuplicatePlayers(w http.ResponseWriter, r *http.Request) {
+	minScore := models.DefaultDuplicateScore
+	if raw := r.URL.Query().Get("minScore"); raw != "" {
+		var err error
+		if minScore, err = strconv.ParseFloat(raw, 64); err != nil || minScore < 0 || minScore > 1 {
+			writeError(w, r, errorf(ErrInvalidRequest, "minScore must be between 0 and 1"))
+			return
+		}
+	}
+	if !s.players.ready() {
+		writeError(w, r, errorf(ErrUnavailable, "Player search index is still loading"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.players.duplicates(minScore))
+}
+
+// Rewrites of every reference to one player ID into another, gathered before
+// anything is written. A merge rewrites loser to survivor across the
+// collections; a revert rewrites survivor back to loser in the documents the
+// merge recorded.
+type playerRewrite struct {
+	s        *Server
+	from, to string
+	toPlayer Player // name and image for match squad entries
+	override bool   // rewrite squads and fantasy teams of locked matches
+	now      time.Time
+
+	references  map[string][]string
+	deactivated []string
+	endDates    map[string]time.Time // end dates of deactivated associations before the merge
+	blockers    []string
+	writes      []planWrite
+	matchIDs    map[string]bool // matches whose fantasy teams changed
+	locked      map[string]bool // matches whose squads and teams are locked
+	picked      map[string][]UserTeam
+}
+
+func (s *Server) newPlayerRewrite(from, to string, toPlayer Player) *playerRewrite {
+	return &playerRewrite{
+		s:          s,
+		from:       from,
+		to:         to,
+		toPlayer:   toPlayer,
+		now:        time.Now().UTC(),
+		references: map[string][]string{},
+		endDates:   map[string]time.Time{},
+		matchIDs:   map[string]bool{},
+		locked:     map[string]bool{},
+		picked:     map[string][]UserTeam{},
+	}
+}
+
+func (rw *playerRewrite) update(collection string, ref *firestore.DocumentRef, updates ...firestore.Update) {
+	rw.references[collection] = append(rw.references[collection], ref.ID)
+	rw.writes = append(rw.writes, planWrite{ref: ref, updates: updates})
+}
+
+func (rw *playerRewrite) block(format string, args ...interface{}) {
+	rw.blockers = append(rw.blockers, fmt.Sprintf(format, args...))
+}
+
+// Replace from with to in a list of player IDs
+func (rw *playerRewrite) swap(ids []string) ([]string, bool) {
+	swapped := make([]string, len(ids))
+	changed := false
+	for i, id := range ids {
+		swapped[i] = id
+		if id == rw.from {
+			swapped[i] = rw.to
+			changed = true
+		}
+	}
+	return swapped, changed
+}
+
+func (rw *playerRewrite) swapOne(id string) string {
+	if id == rw.from {
+		return rw.to
+	}
+	return id
+}
+
+// A team-player association. deactivate ends its spell now too; reactivate
+// restores the end date it had.
+func (rw *playerRewrite) teamPlayer(doc *firestore.DocumentSnapshot, deactivate, reactivate bool) {
+	var tp TeamPlayer
+	doc.DataTo(&tp)
+	if tp.PlayerID != rw.from {
+		return
+	}
+	updates := []firestore.Update{{Path: "playerId", Value: rw.to}}
+	if deactivate {
+		updates = append(updates,
+			firestore.Update{Path: "isActive", Value: false},
+			firestore.Update{Path: "endDate", Value: rw.now},
+		)
+		rw.deactivated = append(rw.deactivated, doc.Ref.ID)
+		rw.endDates[doc.Ref.ID] = tp.EndDate
+	}
+	if reactivate {
+		updates = append(updates,
+			firestore.Update{Path: "isActive", Value: true},
+			firestore.Update{Path: "endDate", Value: rw.endDates[doc.Ref.ID]},
+		)
+	}
+	rw.update("teamPlayers", doc.Ref, updates...)
+}
+
+// An announced lineup
+func (rw *playerRewrite) lineup(doc *firestore.DocumentSnapshot) {
+	var squad Squad
+	doc.DataTo(&squad)
+	if !slices.Contains(squad.PlayerIDs, rw.from) {
+		return
+	}
+	if slices.Contains(squad.PlayerIDs, rw.to) {
+		rw.block("lineup %s names both players", doc.Ref.ID)
+		return
+	}
+	playerIDs, _ := rw.swap(squad.PlayerIDs)
+	starting6, _ := rw.swap(squad.Starting6)
+	substitutes, _ := rw.swap(squad.Substitutes)
+	rw.update("squads", doc.Ref,
+		firestore.Update{Path: "playerIds", Value: playerIDs},
+		firestore.Update{Path: "starting6", Value: starting6},
+		firestore.Update{Path: "libero", Value: rw.swapOne(squad.Libero)},
+		firestore.Update{Path: "substitutes", Value: substitutes},
+	)
+}
+
+func squadHasPlayer(squad MatchSquad, playerID string) bool {
+	for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+		for _, p := range players {
+			if p.PlayerID == playerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Note which matches of the squads and fantasy teams holding the player being
+// replaced are locked, and the teams each of them picked it in
+func (rw *playerRewrite) loadLocks(ctx context.Context, squads, teams []*firestore.DocumentSnapshot) error {
+	matchIDs := map[string]bool{}
+	for _, doc := range squads {
+		var squad MatchSquad
+		doc.DataTo(&squad)
+		if squadHasPlayer(squad, rw.from) {
+			matchIDs[doc.Ref.ID] = true
+		}
+	}
+	for _, doc := range teams {
+		var team UserTeam
+		doc.DataTo(&team)
+		if !slices.Contains(team.Players, rw.from) {
+			continue
+		}
+		team.TeamID = doc.Ref.ID
+		matchIDs[team.MatchID] = true
+		rw.picked[team.MatchID] = append(rw.picked[team.MatchID], team)
+	}
+	if len(matchIDs) == 0 {
+		return nil
+	}
+	refs := make([]*firestore.DocumentRef, 0, len(matchIDs))
+	for id := range matchIDs {
+		refs = append(refs, rw.s.firestoreClient.Collection("matches").Doc(id))
+	}
+	docs, err := rw.s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var match Match
+		doc.DataTo(&match)
+		rw.locked[doc.Ref.ID] = squadLocked(match, rw.now)
+	}
+	return nil
+}
+
+// Fantasy teams of a locked match that picked the replaced player, with their
+// credits under the squad before and after the rewrite
+func (rw *playerRewrite) impact(prev, next MatchSquad) []models.TeamImpact {
+	before, after := map[string]float64{}, map[string]float64{}
+	for _, players := range [][]MatchSquadPlayer{prev.Team1Players, prev.Team2Players} {
+		for _, p := range players {
+			before[p.PlayerID] = p.Credits
+		}
+	}
+	for _, players := range [][]MatchSquadPlayer{next.Team1Players, next.Team2Players} {
+		for _, p := range players {
+			after[p.PlayerID] = p.Credits
+		}
+	}
+	impacts := []models.TeamImpact{}
+	for _, team := range rw.picked[next.MatchID] {
+		impact := models.TeamImpact{TeamID: team.TeamID, UserID: team.UserID, Players: []string{rw.from}}
+		for _, id := range team.Players {
+			impact.CreditsBefore += before[id]
+			impact.CreditsAfter += after[rw.swapOne(id)]
+		}
+		impacts = append(impacts, impact)
+	}
+	return impacts
+}
+
+// A match squad; the entry keeps its credits and stats and takes the new
+// player's name and image. A locked squad is only rewritten with override,
+// and its version records the fantasy teams the rewrite touches.
+func (rw *playerRewrite) matchSquad(doc *firestore.DocumentSnapshot) {
+	var prev, squad MatchSquad
+	doc.DataTo(&prev)
+	doc.DataTo(&squad)
+	squad.MatchID = doc.Ref.ID
+	if !squadHasPlayer(squad, rw.from) {
+		return
+	}
+	if squadHasPlayer(squad, rw.to) {
+		rw.block("match squad %s has both players", doc.Ref.ID)
+		return
+	}
+	var override *models.SquadOverride
+	if rw.locked[squad.MatchID] {
+		if !rw.override {
+			rw.block("match squad %s is locked; pass override to rewrite it", doc.Ref.ID)
+			return
+		}
+		override = &models.SquadOverride{LockedVersion: prev.LockedVersion}
+	}
+	for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+		for i := range players {
+			if players[i].PlayerID == rw.from {
+				players[i].PlayerID = rw.to
+				players[i].PlayerName = rw.toPlayer.Name
+				players[i].PlayerImageURL = rw.toPlayer.ImageURL
+			}
+		}
+	}
+	rw.references["matchSquads"] = append(rw.references["matchSquads"], doc.Ref.ID)
+	if override != nil {
+		override.Teams = rw.impact(prev, squad)
+		override.TeamsAffected = len(override.Teams)
+	}
+	rw.writes = append(rw.writes, rw.s.planSquadVersion(prev, &squad, SquadEdit{
+		Source: models.SquadSourceMerge,
+		Reason: fmt.Sprintf("player %s replaced by %s", rw.from, rw.to),
+	}, override, rw.now)...)
+}
+
+// A fantasy team's picks, captain and vice-captain
+func (rw *playerRewrite) userTeam(doc *firestore.DocumentSnapshot) {
+	var team UserTeam
+	doc.DataTo(&team)
+	if !slices.Contains(team.Players, rw.from) {
+		return
+	}
+	if slices.Contains(team.Players, rw.to) {
+		rw.block("fantasy team %s picked both players", doc.Ref.ID)
+		return
+	}
+	if rw.locked[team.MatchID] && !rw.override {
+		rw.block("fantasy team %s is for locked match %s; pass override to rewrite it", doc.Ref.ID, team.MatchID)
+		return
+	}
+	players, _ := rw.swap(team.Players)
+	rw.update("userTeams", doc.Ref,
+		firestore.Update{Path: "players", Value: players},
+		firestore.Update{Path: "captainId", Value: rw.swapOne(team.CaptainID)},
+		firestore.Update{Path: "viceCaptainId", Value: rw.swapOne(team.ViceCaptainID)},
+	)
+	rw.matchIDs[team.MatchID] = true
+}
+
+// A match history record. Its ID keeps the old player; the next rescore of
+// the match rewrites it under the new one.
+func (rw *playerRewrite) history(doc *firestore.DocumentSnapshot) {
+	var record models.PlayerMatchRecord
+	doc.DataTo(&record)
+	if record.PlayerID == rw.from {
+		rw.update("playerHistory", doc.Ref, firestore.Update{Path: "playerId", Value: rw.to})
+	}
+}
+
+// Find every reference to the loser for a merge
+func (rw *playerRewrite) planMerge(ctx context.Context) error {
+	client := rw.s.firestoreClient
+
+	// A loser association on a team the survivor is already on is ended so the
+	// roster does not list the survivor twice
+	survivorTeams := map[string]bool{}
+	roster, err := rw.s.associationsOn(ctx, "playerId", rw.to, rw.now)
+	if err != nil {
+		return err
+	}
+	for _, tp := range roster {
+		survivorTeams[tp.TeamID] = true
+	}
+	associations, err := client.Collection("teamPlayers").Where("playerId", "==", rw.from).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range associations {
+		var tp TeamPlayer
+		doc.DataTo(&tp)
+		rw.teamPlayer(doc, tp.ValidOn(rw.now) && survivorTeams[tp.TeamID], false)
+	}
+
+	lineups, err := client.Collection("squads").Where("playerIds", "array-contains", rw.from).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range lineups {
+		rw.lineup(doc)
+	}
+
+	// Squad entries are not queryable by player, so every squad is read
+	squads, err := client.Collection("matchSquads").Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	teams, err := client.Collection("userTeams").Where("players", "array-contains", rw.from).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	if err := rw.loadLocks(ctx, squads, teams); err != nil {
+		return err
+	}
+	for _, doc := range squads {
+		rw.matchSquad(doc)
+	}
+	for _, doc := range teams {
+		rw.userTeam(doc)
+	}
+
+	history, err := client.Collection("playerHistory").Where("playerId", "==", rw.from).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range history {
+		rw.history(doc)
+	}
+	return nil
+}
+
+// Rewrite back the documents a merge recorded
+func (rw *playerRewrite) planRevert(ctx context.Context, merge models.PlayerMerge) error {
+	collections := []string{"teamPlayers", "squads", "matchSquads", "userTeams", "playerHistory"}
+	recorded := map[string][]*firestore.DocumentSnapshot{}
+	for _, collection := range collections {
+		ids := merge.References[collection]
+		if len(ids) == 0 {
+			continue
+		}
+		refs := make([]*firestore.DocumentRef, len(ids))
+		for i, id := range ids {
+			refs[i] = rw.s.firestoreClient.Collection(collection).Doc(id)
+		}
+		docs, err := rw.s.firestoreClient.GetAll(ctx, refs)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if doc.Exists() {
+				recorded[collection] = append(recorded[collection], doc)
+			}
+		}
+	}
+	if err := rw.loadLocks(ctx, recorded["matchSquads"], recorded["userTeams"]); err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		for _, doc := range recorded[collection] {
+			switch collection {
+			case "teamPlayers":
+				rw.teamPlayer(doc, false, slices.Contains(merge.Deactivated, doc.Ref.ID))
+			case "squads":
+				rw.lineup(doc)
+			case "matchSquads":
+				rw.matchSquad(doc)
+			case "userTeams":
+				rw.userTeam(doc)
+			case "playerHistory":
+				rw.history(doc)
+			}
+		}
+	}
+	return nil
+}
+
+// Write the rewrites, then final in a batch of its own so a failure part way
+// leaves the merge record as it was and the operation can be retried
+func (rw *playerRewrite) commit(ctx context.Context, final ...planWrite) error {
+	for start := 0; start < len(rw.writes); start += maxBatchWrites {
+		batch := rw.s.firestoreClient.Batch()
+		for _, write := range rw.writes[start:min(start+maxBatchWrites, len(rw.writes))] {
+			if write.data != nil {
+				batch.Set(write.ref, write.data)
+			} else {
+				batch.Update(write.ref, write.updates)
+			}
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	batch := rw.s.firestoreClient.Batch()
+	for _, write := range final {
+		batch.Update(write.ref, write.updates)
+	}
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// Pick counts follow fantasy teams, so recount the matches whose teams
+// changed. The merge is already saved, so failures are logged; the recount
+// endpoint can be run again.
+func (rw *playerRewrite) recountPicks(ctx context.Context) {
+	for matchID := range rw.matchIDs {
+		if _, _, err := rw.s.recountPicks(ctx, matchID, false); err != nil {
+			log.Printf("Pick counts for match %s not recounted after player merge: %v", matchID, err)
+		}
+	}
+}
+
+type MergeRequest struct {
+	SurvivorID string `json:"survivorId"`
+	LoserID    string `json:"loserId"`
+	Reason     string `json:"reason"`
+	Override   bool   `json:"override"` // also rewrite squads and fantasy teams of locked matches
+}
+
+type MergeResult struct {
+	Merge    models.PlayerMerge `json:"merge"`
+	DryRun   bool               `json:"dryRun"`
+	Blockers []string           `json:"blockers"`
+}
+
+func (s *Server) loadPlayer(ctx context.Context, playerID string) (Player, error) {
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("players").Doc(playerID), "Player")
+	if err != nil {
+		return Player{}, err
+	}
+	var player Player
+	doc.DataTo(&player)
+	player.PlayerID = playerID
+	return player, nil
+}
+
+// Admin: Merge a duplicate player into the one kept. References in team-player
+// associations, lineups, match squads, fantasy teams and match history move to
+// the survivor, the loser is archived and the merge is recorded in
+// playerMerges so it can be reverted. Squads and fantasy teams of locked
+// matches are only rewritten with override and a reason, and the squad version
+// records the teams affected. ?dryRun=true reports what would change.
+func (s *Server) mergePlayers(w http.ResponseWriter, r *http.Request) {
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	if req.SurvivorID == "" || req.LoserID == "" || req.SurvivorID == req.LoserID {
+		writeError(w, r, errorf(ErrInvalidRequest, "survivorId and loserId are required and must differ"))
+		return
+	}
+	if req.Override && strings.TrimSpace(req.Reason) == "" {
+		writeError(w, r, errorf(ErrInvalidRequest, "A reason is required to override locked matches"))
+		return
+	}
+	dryRun := false
+	if raw := r.URL.Query().Get("dryRun"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "dryRun must be true or false"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	survivor, err := s.loadPlayer(ctx, req.SurvivorID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	loser, err := s.loadPlayer(ctx, req.LoserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	rw := s.newPlayerRewrite(loser.PlayerID, survivor.PlayerID, survivor)
+	rw.override = req.Override
+	if !survivor.ArchivedAt.IsZero() {
+		rw.block("survivor %s is archived", survivor.PlayerID)
+	}
+	if !loser.ArchivedAt.IsZero() {
+		rw.block("player %s is already archived", loser.PlayerID)
+	}
+	if err := rw.planMerge(ctx); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ref := s.firestoreClient.Collection("playerMerges").Doc(fmt.Sprintf("merge_%d", rw.now.UnixNano()))
+	result := MergeResult{
+		Merge: models.PlayerMerge{
+			MergeID:     ref.ID,
+			SurvivorID:  survivor.PlayerID,
+			LoserID:     loser.PlayerID,
+			PlayerIDs:   []string{survivor.PlayerID, loser.PlayerID},
+			Loser:       loser,
+			Status:      models.MergePending,
+			Reason:      req.Reason,
+			References:  rw.references,
+			Deactivated: rw.deactivated,
+			EndDates:    rw.endDates,
+			MergedBy:    adminID(r),
+			MergedAt:    rw.now,
+		},
+		DryRun:   dryRun,
+		Blockers: rw.blockers,
+	}
+	if result.Merge.Deactivated == nil {
+		result.Merge.Deactivated = []string{}
+	}
+	if result.Blockers == nil {
+		result.Blockers = []string{}
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	if len(rw.blockers) > 0 {
+		writeError(w, r, errorWithDetails(ErrConflict, result, "Cannot merge player %s into %s", loser.PlayerID, survivor.PlayerID))
+		return
+	}
+
+	// Recorded first, so a merge that fails part way can still be reverted
+	if _, err := ref.Create(ctx, result.Merge); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = rw.commit(ctx,
+		planWrite{ref: s.firestoreClient.Collection("players").Doc(loser.PlayerID), updates: []firestore.Update{
+			{Path: "archivedAt", Value: rw.now},
+			{Path: "mergedInto", Value: survivor.PlayerID},
+		}},
+		planWrite{ref: ref, updates: []firestore.Update{{Path: "status", Value: models.MergeMerged}}},
+	)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rw.recountPicks(ctx)
+
+	result.Merge.Status = models.MergeMerged
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Admin: Revert a player merge: the recorded documents point at the loser
+// again, associations the merge turned inactive are reactivated and the loser
+// is restored. Locked matches need ?override=true, as for the merge.
+func (s *Server) revertPlayerMerge(w http.ResponseWriter, r *http.Request) {
+	mergeId := mux.Vars(r)["mergeId"]
+	override := false
+	if raw := r.URL.Query().Get("override"); raw != "" {
+		var err error
+		if override, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "override must be true or false"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	ref := s.firestoreClient.Collection("playerMerges").Doc(mergeId)
+	doc, err := getDocument(ctx, ref, "Player merge")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var merge models.PlayerMerge
+	doc.DataTo(&merge)
+	if merge.Status == models.MergeReverted {
+		writeError(w, r, errorf(ErrConflict, "Merge %s has already been reverted", mergeId))
+		return
+	}
+	survivor, err := s.loadPlayer(ctx, merge.SurvivorID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if survivor.MergedInto != "" {
+		writeError(w, r, errorf(ErrConflict, "Player %s has since been merged into %s; revert that merge first", survivor.PlayerID, survivor.MergedInto))
+		return
+	}
+
+	rw := s.newPlayerRewrite(merge.SurvivorID, merge.LoserID, merge.Loser)
+	rw.override = override
+	if merge.EndDates != nil {
+		rw.endDates = merge.EndDates
+	}
+	if err := rw.planRevert(ctx, merge); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(rw.blockers) > 0 {
+		writeError(w, r, errorWithDetails(ErrConflict, rw.blockers, "Cannot revert merge %s", mergeId))
+		return
+	}
+	err = rw.commit(ctx,
+		planWrite{ref: s.firestoreClient.Collection("players").Doc(merge.LoserID), updates: []firestore.Update{
+			{Path: "archivedAt", Value: merge.Loser.ArchivedAt},
+			{Path: "mergedInto", Value: firestore.Delete},
+		}},
+		planWrite{ref: ref, updates: []firestore.Update{
+			{Path: "status", Value: models.MergeReverted},
+			{Path: "revertedBy", Value: adminID(r)},
+			{Path: "revertedAt", Value: rw.now},
+		}},
+	)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rw.recountPicks(ctx)
+
+	merge.Status = models.MergeReverted
+	merge.RevertedBy = adminID(r)
+	merge.RevertedAt = rw.now
+	writeJSON(w, http.StatusOK, merge)
+}
+
+// Admin: List player merges, latest first; ?playerId= narrows to merges
+// involving that player
+func (s *Server) getPlayerMerges(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := s.firestoreClient.Collection("playerMerges").Query
+	if playerID := r.URL.Query().Get("playerId"); playerID != "" {
+		q = q.Where("playerIds", "array-contains", playerID)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	merges := make([]models.PlayerMerge, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&merges[i])
+	}
+	sort.Slice(merges, func(i, j int) bool { return merges[i].MergedAt.After(merges[j].MergedAt) })
+
+	writeJSON(w, http.StatusOK, merges)
+}
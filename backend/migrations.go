@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Fields that used to be stored as strings and are now Firestore timestamps
+var timestampFields = map[string][]string{
+	"leagues":          {"startDate", "endDate", "createdAt"},
+	"teams":            {"createdAt"},
+	"squads":           {"createdAt"},
+	"matches":          {"startTime", "createdAt"},
+	"contestTemplates": {"createdAt"},
+	"contests":         {"createdAt"},
+	"players":          {"createdAt"},
+	"teamPlayers":      {"startDate", "endDate", "createdAt"},
+	"matchSquads":      {"createdAt", "updatedAt"},
+	"userTeams":        {"createdAt"},
+	"contestTeams":     {"joinedAt"},
+}
+
+// Whether a stored string is read in the league's timezone rather than the
+// server default
+func leagueDated(collection, field string) bool {
+	switch collection {
+	case "leagues", "teamPlayers":
+		return field == "startDate" || field == "endDate"
+	case "matches":
+		return field == "startTime"
+	}
+	return false
+}
+
+// Firestore rejects batches larger than this
+const maxBatchWrites = 500
+
+type MigrationFailure struct {
+	Collection string `json:"collection"`
+	DocID      string `json:"docId"`
+	Field      string `json:"field"`
+	Value      string `json:"value"`
+	Reason     string `json:"reason"`
+}
+
+type TimestampMigrationResult struct {
+	DryRun    bool               `json:"dryRun"`
+	Scanned   map[string]int     `json:"scanned"`
+	Converted map[string]int     `json:"converted"`
+	Failures  []MigrationFailure `json:"failures"`
+}
+
+// Admin: Convert legacy string time fields to Firestore timestamps.
+// Idempotent; pass ?dryRun=true to report what would change without writing.
+func (s *Server) migrateTimestamps(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	result, err := s.runTimestampMigration(r.Context(), dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) runTimestampMigration(ctx context.Context, dryRun bool) (*TimestampMigrationResult, error) {
+	result := &TimestampMigrationResult{
+		DryRun:    dryRun,
+		Scanned:   map[string]int{},
+		Converted: map[string]int{},
+		Failures:  []MigrationFailure{},
+	}
+
+	defaultLoc, err := loadLeagueLocation("")
+	if err != nil {
+		return nil, err
+	}
+	// League dates, and match start times and team-player dates without an
+	// offset, are read in their league's timezone. Time zones are taken from the raw league documents up front: leagues
+	// with string dates don't decode, and a dry run never converts them.
+	leagues, err := s.firestoreClient.Collection("leagues").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	leagueLocs := map[string]*time.Location{}
+	leagueErrs := map[string]error{}
+	for _, doc := range leagues {
+		name, _ := doc.Data()["timezone"].(string)
+		if leagueLocs[doc.Ref.ID], err = models.LoadLeagueLocation(name); err != nil {
+			leagueErrs[doc.Ref.ID] = fmt.Errorf("league %s: %w", doc.Ref.ID, err)
+		}
+	}
+	locationFor := func(data map[string]interface{}) (*time.Location, error) {
+		leagueID, _ := data["leagueId"].(string)
+		if leagueID == "" {
+			return defaultLoc, nil
+		}
+		if err := leagueErrs[leagueID]; err != nil {
+			return nil, err
+		}
+		loc, ok := leagueLocs[leagueID]
+		if !ok {
+			return nil, fmt.Errorf("league %s not found", leagueID)
+		}
+		return loc, nil
+	}
+	fail := func(failure MigrationFailure) {
+		log.Printf("Timestamp migration: %s/%s %s %q not converted: %s", failure.Collection, failure.DocID, failure.Field, failure.Value, failure.Reason)
+		result.Failures = append(result.Failures, failure)
+	}
+
+	collections := make([]string, 0, len(timestampFields))
+	for collection := range timestampFields {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		batch := s.firestoreClient.Batch()
+		pending := 0
+		flush := func() error {
+			if pending == 0 || dryRun {
+				return nil
+			}
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch = s.firestoreClient.Batch()
+			pending = 0
+			return nil
+		}
+
+		iter := s.firestoreClient.Collection(collection).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				return nil, err
+			}
+			result.Scanned[collection]++
+
+			data := doc.Data()
+			var updates []firestore.Update
+			for _, field := range timestampFields[collection] {
+				raw, isString := data[field].(string)
+				if !isString {
+					continue
+				}
+				if raw == "" {
+					updates = append(updates, firestore.Update{Path: field, Value: firestore.Delete})
+					continue
+				}
+				loc := defaultLoc
+				if leagueDated(collection, field) {
+					leagueData := data
+					if collection == "leagues" {
+						leagueData = map[string]interface{}{"leagueId": doc.Ref.ID}
+					}
+					if loc, err = locationFor(leagueData); err != nil {
+						fail(MigrationFailure{Collection: collection, DocID: doc.Ref.ID, Field: field, Value: raw, Reason: err.Error()})
+						continue
+					}
+				}
+				t, err := parseTimestamp(raw, loc)
+				if err != nil {
+					fail(MigrationFailure{Collection: collection, DocID: doc.Ref.ID, Field: field, Value: raw, Reason: err.Error()})
+					continue
+				}
+				updates = append(updates, firestore.Update{Path: field, Value: t})
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			result.Converted[collection]++
+			if dryRun {
+				continue
+			}
+			batch.Update(doc.Ref, updates)
+			pending++
+			if pending == maxBatchWrites {
+				if err := flush(); err != nil {
+					iter.Stop()
+					return nil, err
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Timestamp migration (dryRun=%v): converted %v, %d failures", dryRun, result.Converted, len(result.Failures))
+	return result, nil
+}
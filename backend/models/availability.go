@@ -0,0 +1,85 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Availability statuses. Doubtful players may still play; the others are out
+// until their expected return, or until the status is changed if none is set.
+const (
+	Available     = "available"
+	Doubtful      = "doubtful"
+	Injured       = "injured"
+	Suspended     = "suspended"
+	NotTravelling = "not_travelling"
+)
+
+var AvailabilityStatuses = []string{Available, Doubtful, Injured, Suspended, NotTravelling}
+
+// A player's availability, stored at availability/{playerId}
+type Availability struct {
+	PlayerID       string    `json:"playerId" firestore:"playerId"`
+	Status         string    `json:"status" firestore:"status"`
+	Reason         string    `json:"reason" firestore:"reason"`
+	ExpectedReturn time.Time `json:"expectedReturn" firestore:"expectedReturn"` // zero when unknown
+	Source         string    `json:"source" firestore:"source"`                 // where the news came from, e.g. team release
+	UpdatedBy      string    `json:"updatedBy" firestore:"updatedBy"`
+	UpdatedAt      time.Time `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// Whether the player can play at the given time
+func (a Availability) AvailableOn(t time.Time) bool {
+	switch a.Status {
+	case "", Available, Doubtful:
+		return true
+	}
+	return !a.ExpectedReturn.IsZero() && !t.Before(a.ExpectedReturn)
+}
+
+// The status in force at the given time; once the expected return has passed
+// the player counts as available
+func (a Availability) StatusOn(t time.Time) string {
+	returned := !a.ExpectedReturn.IsZero() && !t.Before(a.ExpectedReturn)
+	if a.Status == "" || returned {
+		return Available
+	}
+	return a.Status
+}
+
+func ValidAvailabilityStatus(status string) bool {
+	return slices.Contains(AvailabilityStatuses, status)
+}
+
+// Availability as shown on a match squad player, nil while available
+type SquadAvailability struct {
+	Status         string    `json:"status" firestore:"status"`
+	Reason         string    `json:"reason" firestore:"reason"`
+	ExpectedReturn time.Time `json:"expectedReturn" firestore:"expectedReturn"`
+}
+
+// What a squad for a match at the given time shows, nil while available
+func (a Availability) ForMatch(t time.Time) *SquadAvailability {
+	status := a.StatusOn(t)
+	if status == Available {
+		return nil
+	}
+	return &SquadAvailability{Status: status, Reason: a.Reason, ExpectedReturn: a.ExpectedReturn}
+}
+
+// Notification types
+const NotificationPlayerUnavailable = "player_unavailable"
+
+// Something for one user, stored in notifications
+type Notification struct {
+	NotificationID string    `json:"notificationId" firestore:"notificationId"`
+	UserID         string    `json:"userId" firestore:"userId"`
+	Type           string    `json:"type" firestore:"type"`
+	MatchID        string    `json:"matchId" firestore:"matchId"`
+	PlayerID       string    `json:"playerId" firestore:"playerId"`
+	TeamIDs        []string  `json:"teamIds" firestore:"teamIds"` // the user's fantasy teams it concerns
+	Message        string    `json:"message" firestore:"message"`
+	LocksAt        time.Time `json:"locksAt" firestore:"locksAt"` // teams can be changed until then
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+	ReadAt         time.Time `json:"readAt" firestore:"readAt"` // zero while unread
+}
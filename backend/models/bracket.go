@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Match stages. Matches created before stages existed have none and count as
+// league stage.
+const (
+	StageLeague  = "league"
+	StagePlayoff = "playoff"
+)
+
+// Where a playoff fixture's team comes from: a final league position, or the
+// winner or loser of an earlier fixture in the bracket. TeamID is filled in
+// once the source is decided.
+type TeamSource struct {
+	Standing int    `json:"standing,omitempty" firestore:"standing,omitempty"`
+	WinnerOf string `json:"winnerOf,omitempty" firestore:"winnerOf,omitempty"`
+	LoserOf  string `json:"loserOf,omitempty" firestore:"loserOf,omitempty"`
+	TeamID   string `json:"teamId" firestore:"teamId"`
+}
+
+// Placeholder name shown for the team until the source is decided
+func (t TeamSource) Label() string {
+	switch {
+	case t.WinnerOf != "":
+		return "Winner " + t.WinnerOf
+	case t.LoserOf != "":
+		return "Loser " + t.LoserOf
+	}
+	return "Position " + strconv.Itoa(t.Standing)
+}
+
+type BracketFixture struct {
+	Key     string     `json:"key" firestore:"key"` // e.g. SF1, F
+	Name    string     `json:"name" firestore:"name"`
+	MatchID string     `json:"matchId" firestore:"matchId"`
+	Team1   TeamSource `json:"team1" firestore:"team1"`
+	Team2   TeamSource `json:"team2" firestore:"team2"`
+}
+
+type BracketRound struct {
+	Name     string           `json:"name" firestore:"name"`
+	Fixtures []BracketFixture `json:"fixtures" firestore:"fixtures"`
+}
+
+// Knockout bracket for a league's playoffs, stored at brackets/{bracketId}.
+// Each fixture is a Match document whose teams are filled in as standings and
+// earlier results decide them.
+type Bracket struct {
+	BracketID string         `json:"bracketId" firestore:"bracketId"`
+	LeagueID  string         `json:"leagueId" firestore:"leagueId"`
+	Name      string         `json:"name" firestore:"name"`
+	Rounds    []BracketRound `json:"rounds" firestore:"rounds"`
+	SeededAt  time.Time      `json:"seededAt" firestore:"seededAt"` // standings seeds were fixed; zero until then
+	CreatedAt time.Time      `json:"createdAt" firestore:"createdAt"`
+}
+
+// Fixture with the given key, or nil
+func (b *Bracket) Fixture(key string) *BracketFixture {
+	for i := range b.Rounds {
+		for j := range b.Rounds[i].Fixtures {
+			if b.Rounds[i].Fixtures[j].Key == key {
+				return &b.Rounds[i].Fixtures[j]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import "testing"
+
+func TestTeamSourceLabel(t *testing.T) {
+	tests := []struct {
+		source TeamSource
+		want   string
+	}{
+		{TeamSource{Standing: 1}, "Position 1"},
+		{TeamSource{Standing: 8}, "Position 8"},
+		{TeamSource{WinnerOf: "QF2"}, "Winner QF2"},
+		{TeamSource{LoserOf: "SF1"}, "Loser SF1"},
+		{TeamSource{WinnerOf: "SF1", TeamID: "t1"}, "Winner SF1"}, // decided sources keep their label
+	}
+	for _, tt := range tests {
+		if got := tt.source.Label(); got != tt.want {
+			t.Errorf("%+v.Label() = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestBracketFixture(t *testing.T) {
+	bracket := Bracket{Rounds: []BracketRound{
+		{Name: "Semi-finals", Fixtures: []BracketFixture{
+			{Key: "SF1", MatchID: "m1", Team1: TeamSource{Standing: 1}, Team2: TeamSource{Standing: 4}},
+			{Key: "SF2", MatchID: "m2", Team1: TeamSource{Standing: 2}, Team2: TeamSource{Standing: 3}},
+		}},
+		{Name: "Final", Fixtures: []BracketFixture{
+			{Key: "F", MatchID: "m3", Team1: TeamSource{WinnerOf: "SF1"}, Team2: TeamSource{WinnerOf: "SF2"}},
+		}},
+	}}
+	for key, matchID := range map[string]string{"SF1": "m1", "SF2": "m2", "F": "m3"} {
+		f := bracket.Fixture(key)
+		if f == nil || f.MatchID != matchID {
+			t.Errorf("Fixture(%q) = %+v, want match %s", key, f, matchID)
+		}
+	}
+	if f := bracket.Fixture("QF1"); f != nil {
+		t.Errorf("Fixture(%q) = %+v, want nil", "QF1", f)
+	}
+
+	// The fixture is returned in place, so deciding a team updates the bracket
+	bracket.Fixture("F").Team1.TeamID = "t1"
+	if got := bracket.Rounds[1].Fixtures[0].Team1.TeamID; got != "t1" {
+		t.Errorf("final team 1 = %q after deciding it, want t1", got)
+	}
+}
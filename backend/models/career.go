@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+)
+
+// A player's totals over a set of matches: one league's season, or a career
+type SeasonStats struct {
+	LeagueID          string  `json:"leagueId,omitempty"`
+	LeagueName        string  `json:"leagueName,omitempty"`
+	Matches           int     `json:"matches"`
+	Wins              int     `json:"wins"`
+	Attacks           int     `json:"attacks"`
+	Aces              int     `json:"aces"`
+	Blocks            int     `json:"blocks"`
+	ReceptionsSuccess int     `json:"receptionsSuccess"`
+	ReceptionErrors   int     `json:"receptionErrors"`
+	SetsPlayed        int     `json:"setsPlayed"`
+	FantasyPoints     int     `json:"fantasyPoints"`
+	PointsPerMatch    float64 `json:"pointsPerMatch"`
+	AvgSelection      float64 `json:"avgSelection"` // mean selection percentage over the matches
+}
+
+func (st *SeasonStats) add(r PlayerMatchRecord) {
+	st.Matches++
+	if r.Won {
+		st.Wins++
+	}
+	st.Attacks += r.Stats.Attacks
+	st.Aces += r.Stats.Aces
+	st.Blocks += r.Stats.Blocks
+	st.ReceptionsSuccess += r.Stats.ReceptionsSuccess
+	st.ReceptionErrors += r.Stats.ReceptionErrors
+	st.SetsPlayed += len(r.Stats.SetsPlayed)
+	st.FantasyPoints += r.FantasyPoints
+	st.AvgSelection += r.SelectionPercentage
+}
+
+func (st *SeasonStats) finish() {
+	if st.Matches > 0 {
+		st.PointsPerMatch = round1(float64(st.FantasyPoints) / float64(st.Matches))
+		st.AvgSelection = round1(st.AvgSelection / float64(st.Matches))
+	}
+}
+
+// Totals over all the records
+func CareerStats(records []PlayerMatchRecord) SeasonStats {
+	var career SeasonStats
+	for _, r := range records {
+		career.add(r)
+	}
+	career.finish()
+	return career
+}
+
+// Totals per league from records sorted latest first, latest league first
+func SeasonsOf(records []PlayerMatchRecord) []SeasonStats {
+	seasons := []SeasonStats{}
+	index := map[string]int{}
+	for _, r := range records {
+		i, ok := index[r.LeagueID]
+		if !ok {
+			i = len(seasons)
+			index[r.LeagueID] = i
+			seasons = append(seasons, SeasonStats{LeagueID: r.LeagueID})
+		}
+		seasons[i].add(r)
+	}
+	for i := range seasons {
+		seasons[i].finish()
+	}
+	return seasons
+}
+
+// Age in whole years on the given day from a YYYY-MM-DD date of birth;
+// false if the date is missing or malformed
+func AgeOn(dateOfBirth string, now time.Time) (int, bool) {
+	dob, err := time.Parse(time.DateOnly, dateOfBirth)
+	if err != nil {
+		return 0, false
+	}
+	age := now.Year() - dob.Year()
+	if now.Month() < dob.Month() || (now.Month() == dob.Month() && now.Day() < dob.Day()) {
+		age--
+	}
+	return age, age >= 0
+}
+
+// How a player's selection percentage moved: the latest match against the
+// mean of the ones before it, over the last five
+type SelectionTrend struct {
+	Latest         float64 `json:"latest"`
+	PreviousAvg    float64 `json:"previousAvg"`
+	Change         float64 `json:"change"`
+	MatchesCounted int     `json:"matchesCounted"`
+}
+
+// Trend from records sorted latest first
+func SelectionTrendOf(records []PlayerMatchRecord) SelectionTrend {
+	if len(records) > 5 {
+		records = records[:5]
+	}
+	trend := SelectionTrend{MatchesCounted: len(records)}
+	if len(records) == 0 {
+		return trend
+	}
+	trend.Latest = round1(records[0].SelectionPercentage)
+	if len(records) > 1 {
+		total := 0.0
+		for _, r := range records[1:] {
+			total += r.SelectionPercentage
+		}
+		trend.PreviousAvg = round1(total / float64(len(records)-1))
+		trend.Change = round1(trend.Latest - trend.PreviousAvg)
+	}
+	return trend
+}
@@ -0,0 +1,34 @@
+package models
+
+import "strings"
+
+// Fantasy player categories
+const (
+	CategoryLibero    = "libero"
+	CategorySetter    = "setter"
+	CategoryAttacker  = "attacker"
+	CategoryBlocker   = "blocker"
+	CategoryUniversal = "universal"
+)
+
+var Categories = []string{CategoryLibero, CategorySetter, CategoryAttacker, CategoryBlocker, CategoryUniversal}
+
+// Playing positions as published by the league, mapped to fantasy categories
+var positionCategories = map[string]string{
+	"setter":         CategorySetter,
+	"attacker":       CategoryAttacker,
+	"outside hitter": CategoryAttacker,
+	"outside spiker": CategoryAttacker,
+	"opposite":       CategoryAttacker,
+	"universal":      CategoryUniversal,
+	"blocker":        CategoryBlocker,
+	"middle blocker": CategoryBlocker,
+	"libero":         CategoryLibero,
+}
+
+// Fantasy category for a category name or playing position, and whether it was recognised
+func NormalizeCategory(position string) (string, bool) {
+	key := strings.ToLower(strings.Join(strings.Fields(position), " "))
+	category, ok := positionCategories[key]
+	return category, ok
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Match event types. Player events credit the player's live stats; set_start
+// lists each side's starters, substitution brings PlayerInID on for PlayerOutID,
+// and undo cancels the event with sequence number UndoesSeq.
+const (
+	EventSetStart         = "set_start"
+	EventSetEnd           = "set_end"
+	EventRallyWon         = "rally_won"
+	EventAttackKill       = "attack_kill"
+	EventAce              = "ace"
+	EventBlock            = "block"
+	EventReceptionSuccess = "reception_success"
+	EventReceptionError   = "reception_error"
+	EventSubstitution     = "substitution"
+	EventUndo             = "undo"
+)
+
+// One entry in a match's append-only event log, stored at
+// matchEvents/{matchId}/events/{seq}
+type MatchEvent struct {
+	Seq           int       `json:"seq" firestore:"seq"`
+	MatchID       string    `json:"matchId" firestore:"matchId"`
+	Type          string    `json:"type" firestore:"type"`
+	Set           int       `json:"set" firestore:"set"`
+	TeamID        string    `json:"teamId,omitempty" firestore:"teamId,omitempty"`
+	PlayerID      string    `json:"playerId,omitempty" firestore:"playerId,omitempty"`
+	PlayerInID    string    `json:"playerInId,omitempty" firestore:"playerInId,omitempty"`
+	PlayerOutID   string    `json:"playerOutId,omitempty" firestore:"playerOutId,omitempty"`
+	Team1Starters []string  `json:"team1Starters,omitempty" firestore:"team1Starters,omitempty"`
+	Team2Starters []string  `json:"team2Starters,omitempty" firestore:"team2Starters,omitempty"`
+	UndoesSeq     int       `json:"undoesSeq,omitempty" firestore:"undoesSeq,omitempty"`
+	Timestamp     time.Time `json:"timestamp" firestore:"timestamp"` // when it happened on court
+	RecordedAt    time.Time `json:"recordedAt" firestore:"recordedAt"`
+	RecordedBy    string    `json:"recordedBy" firestore:"recordedBy"`
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// A player's final line in one completed match, stored at
+// playerHistory/{matchId}_{playerId}. Only players who took the court get one.
+type PlayerMatchRecord struct {
+	RecordID       string          `json:"recordId" firestore:"recordId"`
+	PlayerID       string          `json:"playerId" firestore:"playerId"`
+	MatchID        string          `json:"matchId" firestore:"matchId"`
+	LeagueID       string          `json:"leagueId" firestore:"leagueId"`
+	TeamID         string          `json:"teamId" firestore:"teamId"`
+	OpponentTeamID string          `json:"opponentTeamId" firestore:"opponentTeamId"`
+	Opponent       TeamInfo        `json:"opponent" firestore:"opponent"`
+	Won            bool            `json:"won" firestore:"won"`
+	StartTime      time.Time       `json:"startTime" firestore:"startTime"`
+	Stats          PlayerLiveStats `json:"stats" firestore:"stats"`
+	FantasyPoints  int             `json:"fantasyPoints" firestore:"fantasyPoints"`
+	Credits        float64         `json:"credits" firestore:"credits"` // price in that match
+	// Share of the match's fantasy teams that picked or captained the player,
+	// as frozen at lock
+	SelectionPercentage float64   `json:"selectionPercentage" firestore:"selectionPercentage"`
+	CaptainPercentage   float64   `json:"captainPercentage" firestore:"captainPercentage"`
+	RecordedAt          time.Time `json:"recordedAt" firestore:"recordedAt"`
+}
+
+// Whether the stats show the player took the court
+func Played(stats PlayerLiveStats) bool {
+	return len(stats.SetsPlayed) > 0 || stats.TotalPoints != 0
+}
+
+// Form shown on a match squad player, from the matches before it
+type PlayerForm struct {
+	LastMatchPoints int     `json:"lastMatchPoints"`
+	Last5Average    float64 `json:"last5Average"`
+	SeasonPoints    int     `json:"seasonPoints"` // in the league of the match
+	MatchesPlayed   int     `json:"matchesPlayed"`
+}
+
+// Form going into a match of leagueID that starts at before, from a player's
+// records in any order. Later matches are ignored so a squad rebuilt after the
+// fact shows what it showed at the time.
+func FormBefore(records []PlayerMatchRecord, leagueID string, before time.Time) PlayerForm {
+	prior := RecordsBefore(records, before)
+
+	var form PlayerForm
+	if len(prior) > 0 {
+		form.LastMatchPoints = prior[0].FantasyPoints
+	}
+	last5 := 0
+	for i, r := range prior {
+		if i < 5 {
+			last5 += r.FantasyPoints
+		}
+		if r.LeagueID == leagueID {
+			form.SeasonPoints += r.FantasyPoints
+			form.MatchesPlayed++
+		}
+	}
+	if n := min(len(prior), 5); n > 0 {
+		form.Last5Average = math.Round(float64(last5)*10/float64(n)) / 10
+	}
+	return form
+}
+
+// Records of matches that started before the given time, latest first
+func RecordsBefore(records []PlayerMatchRecord, before time.Time) []PlayerMatchRecord {
+	var prior []PlayerMatchRecord
+	for _, r := range records {
+		if r.StartTime.Before(before) {
+			prior = append(prior, r)
+		}
+	}
+	SortRecentFirst(prior)
+	return prior
+}
+
+func SortRecentFirst(records []PlayerMatchRecord) {
+	sort.Slice(records, func(i, j int) bool { return records[i].StartTime.After(records[j].StartTime) })
+}
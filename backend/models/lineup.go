@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Largest match roster: twelve players and two liberos
+const MaxLineupPlayers = 14
+
+// Problems with the lineup for a team whose players on the match date are
+// roster, one message per problem. A valid lineup has six distinct starters,
+// a libero who is not one of them, and substitutes who are neither.
+func (sq *Squad) Problems(roster map[string]bool) []string {
+	var problems []string
+	if len(sq.Starting6) != 6 {
+		problems = append(problems, fmt.Sprintf("starting6 must name 6 players, got %d", len(sq.Starting6)))
+	}
+	if sq.Libero == "" {
+		problems = append(problems, "libero is required")
+	}
+
+	seen := map[string]string{}
+	check := func(field, playerID string) {
+		if playerID == "" {
+			problems = append(problems, field+": player ID is empty")
+			return
+		}
+		if other, ok := seen[playerID]; ok {
+			problems = append(problems, fmt.Sprintf("%s: player %s is already in %s", field, playerID, other))
+			return
+		}
+		seen[playerID] = field
+		if !roster[playerID] {
+			problems = append(problems, fmt.Sprintf("%s: player %s is not on the roster of team %s for the match", field, playerID, sq.TeamID))
+		}
+	}
+	for _, id := range sq.Starting6 {
+		check("starting6", id)
+	}
+	if sq.Libero != "" {
+		check("libero", sq.Libero)
+	}
+	for _, id := range sq.Substitutes {
+		check("substitutes", id)
+	}
+	if n := len(sq.Starting6) + 1 + len(sq.Substitutes); n > MaxLineupPlayers {
+		problems = append(problems, fmt.Sprintf("a lineup has at most %d players, got %d", MaxLineupPlayers, n))
+	}
+	return problems
+}
+
+// Every player in the lineup: starters, libero, then substitutes
+func (sq *Squad) Players() []string {
+	ids := append([]string{}, sq.Starting6...)
+	if sq.Libero != "" {
+		ids = append(ids, sq.Libero)
+	}
+	return append(ids, sq.Substitutes...)
+}
+
+// Mark a team's side of a match squad with its announced lineup
+func ApplyLineup(players []MatchSquadPlayer, sq *Squad) {
+	starters := map[string]bool{}
+	for _, id := range sq.Starting6 {
+		starters[id] = true
+	}
+	for i := range players {
+		players[i].IsStarting6 = starters[players[i].PlayerID]
+		players[i].IsLibero = players[i].PlayerID == sq.Libero
+	}
+}
+
+// Announcement types
+const AnnouncementLineup = "lineup_announced"
+
+// Something users should hear about before a match locks, stored in
+// announcements for clients to list or subscribe to
+type Announcement struct {
+	AnnouncementID string    `json:"announcementId" firestore:"announcementId"`
+	Type           string    `json:"type" firestore:"type"`
+	MatchID        string    `json:"matchId" firestore:"matchId"`
+	TeamID         string    `json:"teamId" firestore:"teamId"`
+	Message        string    `json:"message" firestore:"message"`
+	Starting6      []string  `json:"starting6" firestore:"starting6"`
+	Libero         string    `json:"libero" firestore:"libero"`
+	LocksAt        time.Time `json:"locksAt" firestore:"locksAt"` // match start; teams can change until then
+	CreatedAt      time.Time `json:"createdAt" firestore:"createdAt"`
+}
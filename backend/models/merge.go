@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Least duplicate score reported by default
+const DefaultDuplicateScore = 0.6
+
+// What is known about a player when looking for duplicates
+type DuplicateEvidence struct {
+	Name        SearchName
+	DateOfBirth string
+	Jerseys     map[string]int // team ID to jersey number, over every association
+}
+
+// How likely two players are the same person, from 0 to 1, with the reasons.
+// The name carries most weight; a matching date of birth or team history adds
+// to it and differing dates of birth count against it.
+func DuplicateScore(a, b DuplicateEvidence) (float64, []string) {
+	nameScore, how := a.Name.Match(b.Name)
+	if reverse, reverseHow := b.Name.Match(a.Name); reverse > nameScore {
+		nameScore, how = reverse, reverseHow
+	}
+	if nameScore == 0 {
+		return 0, nil
+	}
+	score := nameScore * 0.6
+	reasons := []string{fmt.Sprintf("%s name match (%.2f)", how, nameScore)}
+
+	if a.DateOfBirth != "" && b.DateOfBirth != "" {
+		if a.DateOfBirth == b.DateOfBirth {
+			score += 0.3
+			reasons = append(reasons, "same date of birth")
+		} else {
+			score -= 0.4
+			reasons = append(reasons, "different dates of birth")
+		}
+	}
+
+	var shared []string
+	for teamID := range a.Jerseys {
+		if _, ok := b.Jerseys[teamID]; ok {
+			shared = append(shared, teamID)
+		}
+	}
+	sort.Strings(shared)
+	teamScore := 0.0
+	for _, teamID := range shared {
+		if a.Jerseys[teamID] != 0 && a.Jerseys[teamID] == b.Jerseys[teamID] {
+			teamScore += 0.2
+			reasons = append(reasons, fmt.Sprintf("same jersey %d at team %s", a.Jerseys[teamID], teamID))
+		} else {
+			teamScore += 0.1
+			reasons = append(reasons, "both played for team "+teamID)
+		}
+	}
+	score += math.Min(teamScore, 0.2)
+
+	return math.Round(math.Max(0, math.Min(1, score))*100) / 100, reasons
+}
+
+// Block keys for a name: the start of each word's consonant skeleton, so
+// vowel spellings do not split a pair. Only players sharing a key are
+// compared.
+func (n SearchName) BlockKeys() []string {
+	var keys []string
+	for _, sk := range n.Skeletons {
+		if len(sk) >= 2 {
+			keys = append(keys, sk[:2])
+		}
+	}
+	return keys
+}
+
+// Merge states
+const (
+	MergePending  = "pending" // references being rewritten
+	MergeMerged   = "merged"
+	MergeReverted = "reverted"
+)
+
+// A merge of a duplicate player into the one kept, stored in playerMerges.
+// References lists the documents rewritten, by collection, so a revert can
+// rewrite exactly those back.
+type PlayerMerge struct {
+	MergeID     string               `json:"mergeId" firestore:"mergeId"`
+	SurvivorID  string               `json:"survivorId" firestore:"survivorId"`
+	LoserID     string               `json:"loserId" firestore:"loserId"`
+	PlayerIDs   []string             `json:"playerIds" firestore:"playerIds"` // both, for lookups
+	Loser       Player               `json:"loser" firestore:"loser"`         // as it was before the merge
+	Status      string               `json:"status" firestore:"status"`
+	Reason      string               `json:"reason" firestore:"reason"`
+	References  map[string][]string  `json:"references" firestore:"references"`
+	Deactivated []string             `json:"deactivated" firestore:"deactivated"` // loser associations turned inactive because the survivor already had the team
+	EndDates    map[string]time.Time `json:"endDates" firestore:"endDates"`       // end dates the deactivated associations had, zero for open-ended
+	MergedBy    string               `json:"mergedBy" firestore:"mergedBy"`
+	MergedAt    time.Time            `json:"mergedAt" firestore:"mergedAt"`
+	RevertedBy  string               `json:"revertedBy,omitempty" firestore:"revertedBy,omitempty"`
+	RevertedAt  time.Time            `json:"revertedAt" firestore:"revertedAt"`
+}
@@ -0,0 +1,257 @@
+package models
+
+import "time"
+
+type League struct {
+	LeagueID    string    `json:"leagueId" firestore:"leagueId"`
+	Name        string    `json:"name" firestore:"name"`
+	Description string    `json:"description" firestore:"description"`
+	StartDate   time.Time `json:"startDate" firestore:"startDate"`
+	EndDate     time.Time `json:"endDate" firestore:"endDate"`
+	Timezone    string    `json:"timezone" firestore:"timezone"` // IANA name; match times without an offset are read in this zone
+	Status      string    `json:"status" firestore:"status"`
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
+	ArchivedAt  time.Time `json:"archivedAt" firestore:"archivedAt"` // soft-deleted; zero while live
+
+	PointsScheme PointsScheme `json:"pointsScheme" firestore:"pointsScheme"` // standings points; zero means DefaultPointsScheme
+}
+
+type Team struct {
+	TeamID     string    `json:"teamId" firestore:"teamId"`
+	Name       string    `json:"name" firestore:"name"`
+	Code       string    `json:"code" firestore:"code"`
+	Logo       string    `json:"logo" firestore:"logo"`
+	LeagueID   string    `json:"leagueId" firestore:"leagueId"`
+	HomeCity   string    `json:"homeCity" firestore:"homeCity"`
+	Captain    string    `json:"captain" firestore:"captain"`
+	Coach      string    `json:"coach" firestore:"coach"`
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+	ArchivedAt time.Time `json:"archivedAt" firestore:"archivedAt"` // soft-deleted; zero while live
+}
+
+// A team's announced lineup for a match, stored at squads/{matchId}_{teamId}
+type Squad struct {
+	SquadID     string    `json:"squadId" firestore:"squadId"`
+	TeamID      string    `json:"teamId" firestore:"teamId"`
+	PlayerIDs   []string  `json:"playerIds" firestore:"playerIds"` // starters, libero and substitutes
+	MatchID     string    `json:"matchId" firestore:"matchId"`
+	Starting6   []string  `json:"starting6" firestore:"starting6"`
+	Libero      string    `json:"libero" firestore:"libero"`
+	Substitutes []string  `json:"substitutes" firestore:"substitutes"`
+	AnnouncedAt time.Time `json:"announcedAt" firestore:"announcedAt"` // latest announcement; lineups can be revised until lock
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+type Match struct {
+	MatchID    string    `json:"matchId" firestore:"matchId"`
+	LeagueID   string    `json:"leagueId" firestore:"leagueId"`
+	Team1ID    string    `json:"team1Id" firestore:"team1Id"`
+	Team2ID    string    `json:"team2Id" firestore:"team2Id"`
+	Team1      TeamInfo  `json:"team1" firestore:"team1"`
+	Team2      TeamInfo  `json:"team2" firestore:"team2"`
+	StartTime  time.Time `json:"startTime" firestore:"startTime"`
+	Status     string    `json:"status" firestore:"status"`
+	Venue      string    `json:"venue" firestore:"venue"`
+	Round      string    `json:"round" firestore:"round"`
+	Stage      string    `json:"stage" firestore:"stage"`           // league or playoff; empty counts as league
+	BracketID  string    `json:"bracketId" firestore:"bracketId"`   // playoff matches only
+	BracketKey string    `json:"bracketKey" firestore:"bracketKey"` // fixture key within the bracket
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+	ArchivedAt time.Time `json:"archivedAt" firestore:"archivedAt"` // cancelled; zero while live
+
+	// Scoreboard, kept by the admin scorer; see Settle
+	SetScores       []SetScore `json:"setScores" firestore:"setScores"`
+	Team1SetsWon    int        `json:"team1SetsWon" firestore:"team1SetsWon"`
+	Team2SetsWon    int        `json:"team2SetsWon" firestore:"team2SetsWon"`
+	WinnerTeamID    string     `json:"winnerTeamId" firestore:"winnerTeamId"`
+	ServingTeamID   string     `json:"servingTeamId" firestore:"servingTeamId"`
+	StartedAt       time.Time  `json:"startedAt" firestore:"startedAt"`
+	CompletedAt     time.Time  `json:"completedAt" firestore:"completedAt"`
+	DurationMinutes int        `json:"durationMinutes" firestore:"durationMinutes"`
+}
+
+// Copy of a team's display fields kept on each match. The teams collection is
+// the source; see Team.Info.
+type TeamInfo struct {
+	Name string `json:"name" firestore:"name"`
+	Code string `json:"code" firestore:"code"`
+	Logo string `json:"logo" firestore:"logo"`
+}
+
+func (t Team) Info() TeamInfo {
+	return TeamInfo{Name: t.Name, Code: t.Code, Logo: t.Logo}
+}
+
+type ContestTemplate struct {
+	TemplateID        string      `json:"templateId" firestore:"templateId"`
+	Name              string      `json:"name" firestore:"name"`
+	Description       string      `json:"description" firestore:"description"`
+	EntryFee          int         `json:"entryFee" firestore:"entryFee"`
+	TotalPrizePool    int         `json:"totalPrizePool" firestore:"totalPrizePool"`
+	MaxSpots          int         `json:"maxSpots" firestore:"maxSpots"`
+	MaxTeamsPerUser   int         `json:"maxTeamsPerUser" firestore:"maxTeamsPerUser"`
+	IsGuaranteed      bool        `json:"isGuaranteed" firestore:"isGuaranteed"`
+	PrizeDistribution []PrizeRank `json:"prizeDistribution" firestore:"prizeDistribution"`
+	CreatedAt         time.Time   `json:"createdAt" firestore:"createdAt"`
+}
+
+type PrizeRank struct {
+	RankStart   int    `json:"rankStart" firestore:"rankStart"`     // Starting rank (e.g., 1 for rank 1, 2 for rank 2-3)
+	RankEnd     int    `json:"rankEnd" firestore:"rankEnd"`         // Ending rank (e.g., 1 for rank 1, 3 for rank 2-3)
+	PrizeAmount int    `json:"prizeAmount" firestore:"prizeAmount"` // Cash prize amount (0 if kind)
+	PrizeType   string `json:"prizeType" firestore:"prizeType"`     // "cash" or "kind"
+	PrizeDesc   string `json:"prizeDesc" firestore:"prizeDesc"`     // Description for kind prizes
+}
+
+// Base player information - unique and permanent
+type Player struct {
+	PlayerID        string    `json:"playerId" firestore:"playerId"`
+	Name            string    `json:"name" firestore:"name"`
+	ImageURL        string    `json:"imageUrl" firestore:"imageUrl"`
+	DefaultCategory string    `json:"defaultCategory" firestore:"defaultCategory"`
+	DefaultCredits  float64   `json:"defaultCredits" firestore:"defaultCredits"`
+	DateOfBirth     string    `json:"dateOfBirth" firestore:"dateOfBirth"` // calendar date YYYY-MM-DD, not an instant
+	Nationality     string    `json:"nationality" firestore:"nationality"`
+	CreatedAt       time.Time `json:"createdAt" firestore:"createdAt"`
+	ArchivedAt      time.Time `json:"archivedAt" firestore:"archivedAt"`                     // soft-deleted; zero while live
+	MergedInto      string    `json:"mergedInto,omitempty" firestore:"mergedInto,omitempty"` // survivor of a merge that archived this player
+}
+
+// Team-Player association for a season/league
+type TeamPlayer struct {
+	AssociationID string    `json:"associationId" firestore:"associationId"`
+	PlayerID      string    `json:"playerId" firestore:"playerId"`
+	TeamID        string    `json:"teamId" firestore:"teamId"`
+	LeagueID      string    `json:"leagueId" firestore:"leagueId"`
+	Season        string    `json:"season" firestore:"season"`
+	JerseyNumber  int       `json:"jerseyNumber" firestore:"jerseyNumber"`
+	Role          string    `json:"role" firestore:"role"` // captain, vice-captain, player
+	StartDate     time.Time `json:"startDate" firestore:"startDate"`
+	EndDate       time.Time `json:"endDate" firestore:"endDate"` // zero means open-ended
+	IsActive      bool      `json:"isActive" firestore:"isActive"`
+	CreatedAt     time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// Single match squad document containing all players for that match
+type MatchSquad struct {
+	MatchSquadID  string             `json:"matchSquadId" firestore:"matchSquadId"`
+	MatchID       string             `json:"matchId" firestore:"matchId"`
+	Team1ID       string             `json:"team1Id" firestore:"team1Id"`
+	Team2ID       string             `json:"team2Id" firestore:"team2Id"`
+	Team1Players  []MatchSquadPlayer `json:"team1Players" firestore:"team1Players"`
+	Team2Players  []MatchSquadPlayer `json:"team2Players" firestore:"team2Players"`
+	Team1LineupAt time.Time          `json:"team1LineupAt" firestore:"team1LineupAt"` // when team 1's lineup was announced; zero until then
+	Team2LineupAt time.Time          `json:"team2LineupAt" firestore:"team2LineupAt"`
+	Version       int                `json:"version" firestore:"version"`             // latest in matchSquads/{matchId}/versions; 0 before the first versioned write
+	LockedVersion int                `json:"lockedVersion" firestore:"lockedVersion"` // version in force when the match locked; 0 until then
+	LockedAt      time.Time          `json:"lockedAt" firestore:"lockedAt"`
+	CreatedAt     time.Time          `json:"createdAt" firestore:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// Player information within a match squad
+type MatchSquadPlayer struct {
+	PlayerID              string             `json:"playerId" firestore:"playerId"`
+	PlayerName            string             `json:"playerName" firestore:"playerName"`
+	PlayerImageURL        string             `json:"playerImageUrl" firestore:"playerImageUrl"`
+	Category              string             `json:"category" firestore:"category"`
+	Credits               float64            `json:"credits" firestore:"credits"`
+	IsStarting6           bool               `json:"isStarting6" firestore:"isStarting6"`
+	IsLibero              bool               `json:"isLibero" firestore:"isLibero"`
+	JerseyNumber          int                `json:"jerseyNumber" firestore:"jerseyNumber"`
+	LastMatchPoints       int                `json:"lastMatchPoints" firestore:"lastMatchPoints"`
+	Last5Average          float64            `json:"last5Average" firestore:"last5Average"`
+	SeasonPoints          int                `json:"seasonPoints" firestore:"seasonPoints"`                   // fantasy points in earlier matches of the league
+	SelectionPercentage   float64            `json:"selectionPercentage" firestore:"selectionPercentage"`     // share of the match's fantasy teams that picked the player
+	CaptainPercentage     float64            `json:"captainPercentage" firestore:"captainPercentage"`         // share that made them captain
+	ViceCaptainPercentage float64            `json:"viceCaptainPercentage" firestore:"viceCaptainPercentage"` // share that made them vice-captain
+	LiveStats             PlayerLiveStats    `json:"liveStats" firestore:"liveStats"`
+	Availability          *SquadAvailability `json:"availability,omitempty" firestore:"availability,omitempty"` // nil while available
+}
+
+type PlayerLiveStats struct {
+	Attacks           int   `json:"attacks" firestore:"attacks"`
+	Aces              int   `json:"aces" firestore:"aces"`
+	Blocks            int   `json:"blocks" firestore:"blocks"`
+	ReceptionsSuccess int   `json:"receptionsSuccess" firestore:"receptionsSuccess"`
+	ReceptionErrors   int   `json:"receptionErrors" firestore:"receptionErrors"`
+	SetsPlayed        []int `json:"setsPlayed" firestore:"setsPlayed"`
+	SetsAsStarter     []int `json:"setsAsStarter" firestore:"setsAsStarter"`
+	SetsAsSubstitute  []int `json:"setsAsSubstitute" firestore:"setsAsSubstitute"`
+	SetsWon           []int `json:"setsWon" firestore:"setsWon"`   // sets started that the player's team won
+	SetsLost          []int `json:"setsLost" firestore:"setsLost"` // sets started that the player's team lost
+	TotalPoints       int   `json:"totalPoints" firestore:"totalPoints"`
+}
+
+type Contest struct {
+	ContestID         string      `json:"contestId" firestore:"contestId"`
+	MatchID           string      `json:"matchId" firestore:"matchId"`
+	TemplateID        string      `json:"templateId" firestore:"templateId"`
+	Name              string      `json:"name" firestore:"name"`
+	Description       string      `json:"description" firestore:"description"`
+	EntryFee          int         `json:"entryFee" firestore:"entryFee"`
+	TotalPrizePool    int         `json:"totalPrizePool" firestore:"totalPrizePool"`
+	MaxSpots          int         `json:"maxSpots" firestore:"maxSpots"`
+	SpotsLeft         int         `json:"spotsLeft" firestore:"spotsLeft"`
+	JoinedUsers       int         `json:"joinedUsers" firestore:"joinedUsers"`
+	MaxTeamsPerUser   int         `json:"maxTeamsPerUser" firestore:"maxTeamsPerUser"`
+	IsGuaranteed      bool        `json:"isGuaranteed" firestore:"isGuaranteed"`
+	PrizeDistribution []PrizeRank `json:"prizeDistribution" firestore:"prizeDistribution"`
+	Status            string      `json:"status" firestore:"status"`
+	SquadVersion      int         `json:"squadVersion" firestore:"squadVersion"` // match squad version frozen at lock that the contest is played on; 0 until then
+	CreatedAt         time.Time   `json:"createdAt" firestore:"createdAt"`
+	ArchivedAt        time.Time   `json:"archivedAt" firestore:"archivedAt"` // cancelled and refunded; zero while live
+}
+
+type UserTeam struct {
+	TeamID        string    `json:"teamId" firestore:"teamId"`
+	UserID        string    `json:"userId" firestore:"userId"`
+	MatchID       string    `json:"matchId" firestore:"matchId"`
+	ContestID     string    `json:"contestId" firestore:"contestId"`
+	TeamName      string    `json:"teamName" firestore:"teamName"`
+	Players       []string  `json:"players" firestore:"players"`
+	CaptainID     string    `json:"captainId" firestore:"captainId"`
+	ViceCaptainID string    `json:"viceCaptainId" firestore:"viceCaptainId"`
+	TotalPoints   int       `json:"totalPoints" firestore:"totalPoints"`
+	Rank          int       `json:"rank" firestore:"rank"`
+	CreatedAt     time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// ContestTeam represents a team participating in a specific contest
+type ContestTeam struct {
+	ContestTeamID string    `json:"contestTeamId" firestore:"contestTeamId"`
+	ContestID     string    `json:"contestId" firestore:"contestId"`
+	TeamID        string    `json:"teamId" firestore:"teamId"`
+	UserID        string    `json:"userId" firestore:"userId"`
+	MatchID       string    `json:"matchId" firestore:"matchId"`
+	EntryFee      int       `json:"entryFee" firestore:"entryFee"`
+	TotalPoints   int       `json:"totalPoints" firestore:"totalPoints"`
+	Rank          int       `json:"rank" firestore:"rank"`
+	JoinedAt      time.Time `json:"joinedAt" firestore:"joinedAt"`
+	RefundedAt    time.Time `json:"refundedAt" firestore:"refundedAt"` // entry fee refunded when the contest was cancelled
+}
+
+// Entry fee owed back to a user for a cancelled contest entry, stored at
+// refunds/refund_{contestTeamId} so cancelling twice cannot refund twice.
+// Paying it out is up to the payments side, which moves it past pending.
+type Refund struct {
+	RefundID      string    `json:"refundId" firestore:"refundId"`
+	ContestTeamID string    `json:"contestTeamId" firestore:"contestTeamId"`
+	ContestID     string    `json:"contestId" firestore:"contestId"`
+	MatchID       string    `json:"matchId" firestore:"matchId"`
+	UserID        string    `json:"userId" firestore:"userId"`
+	Amount        int       `json:"amount" firestore:"amount"`
+	Reason        string    `json:"reason" firestore:"reason"`
+	Status        string    `json:"status" firestore:"status"` // pending
+	CreatedAt     time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+type User struct {
+	UID                 string    `json:"uid" firestore:"uid"`
+	Phone               string    `json:"phone" firestore:"phone"`
+	Name                string    `json:"name" firestore:"name"`
+	Email               string    `json:"email" firestore:"email"`
+	CreatedAt           time.Time `json:"createdAt" firestore:"createdAt"`
+	TotalContestsJoined int       `json:"totalContestsJoined" firestore:"totalContestsJoined"`
+	TotalWins           int       `json:"totalWins" firestore:"totalWins"`
+}
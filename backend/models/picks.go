@@ -0,0 +1,52 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// How often a match's fantasy teams picked, captained and vice-captained each
+// player, stored at pickCounts/{matchId}. Kept up to date as teams are saved
+// and frozen once the match locks.
+type PickCounts struct {
+	MatchID     string         `json:"matchId" firestore:"matchId"`
+	Teams       int            `json:"teams" firestore:"teams"`
+	Picked      map[string]int `json:"picked" firestore:"picked"`
+	Captain     map[string]int `json:"captain" firestore:"captain"`
+	ViceCaptain map[string]int `json:"viceCaptain" firestore:"viceCaptain"`
+	FrozenAt    time.Time      `json:"frozenAt" firestore:"frozenAt"` // zero until the match locks
+	UpdatedAt   time.Time      `json:"updatedAt" firestore:"updatedAt"`
+}
+
+func NewPickCounts(matchID string) *PickCounts {
+	return &PickCounts{MatchID: matchID, Picked: map[string]int{}, Captain: map[string]int{}, ViceCaptain: map[string]int{}}
+}
+
+// Count one team's picks
+func (c *PickCounts) Add(team UserTeam) {
+	c.Teams++
+	for _, playerID := range team.Players {
+		c.Picked[playerID]++
+	}
+	if team.CaptainID != "" {
+		c.Captain[team.CaptainID]++
+	}
+	if team.ViceCaptainID != "" {
+		c.ViceCaptain[team.ViceCaptainID]++
+	}
+}
+
+// Set a squad player's pick rates from the counts
+func (c *PickCounts) Apply(player *MatchSquadPlayer) {
+	player.SelectionPercentage = percentage(c.Picked[player.PlayerID], c.Teams)
+	player.CaptainPercentage = percentage(c.Captain[player.PlayerID], c.Teams)
+	player.ViceCaptainPercentage = percentage(c.ViceCaptain[player.PlayerID], c.Teams)
+}
+
+// n of total as a percentage to one decimal place; 0 when there is no total
+func percentage(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
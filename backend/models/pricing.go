@@ -0,0 +1,126 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Bounds and step of a player's match credits
+const (
+	MinCredits  = 4.0
+	MaxCredits  = 12.0
+	CreditsStep = 0.5
+)
+
+// Most a single pricing factor moves a player's credits
+const (
+	maxFormAdjustment     = 2.0
+	maxSetsAdjustment     = 1.0
+	maxOpponentAdjustment = 0.5
+)
+
+// Sets in the shortest match; a player on court for all of them is a regular
+const setsPerMatch = 3
+
+// Sources of a price change
+const (
+	PriceSourceEngine   = "engine"   // a proposal accepted as is
+	PriceSourceOverride = "override" // credits an admin entered
+	PriceSourceDefault  = "default"  // the player's default credits edited
+)
+
+// What the engine priced a player on, so a price can be explained later
+type PriceFactors struct {
+	MatchesConsidered  int     `json:"matchesConsidered" firestore:"matchesConsidered"` // of the last 5 before the match
+	Last5Average       float64 `json:"last5Average" firestore:"last5Average"`
+	CategoryAverage    float64 `json:"categoryAverage" firestore:"categoryAverage"` // last-5 average of the category's players in the match
+	SetsPerMatch       float64 `json:"setsPerMatch" firestore:"setsPerMatch"`
+	OpponentWinRate    float64 `json:"opponentWinRate" firestore:"opponentWinRate"` // 0.5 when the opponent has no results
+	FormAdjustment     float64 `json:"formAdjustment" firestore:"formAdjustment"`
+	SetsAdjustment     float64 `json:"setsAdjustment" firestore:"setsAdjustment"`
+	OpponentAdjustment float64 `json:"opponentAdjustment" firestore:"opponentAdjustment"`
+}
+
+// A player going into a match, as the engine sees them
+type PricingInput struct {
+	DefaultCredits  float64
+	Recent          []PlayerMatchRecord // latest first, before the match
+	CategoryAverage float64
+	OpponentWinRate float64
+}
+
+// Propose match credits: the default credits moved by form against the
+// player's category, by how many sets they play and by how strong the
+// opponent is, rounded to the credit step and kept within bounds. A player
+// with no recent matches keeps the default.
+func ProposeCredits(in PricingInput) (float64, PriceFactors) {
+	recent := in.Recent
+	if len(recent) > 5 {
+		recent = recent[:5]
+	}
+	f := PriceFactors{
+		MatchesConsidered: len(recent),
+		CategoryAverage:   round1(in.CategoryAverage),
+		OpponentWinRate:   round1(in.OpponentWinRate),
+	}
+	if len(recent) == 0 {
+		return clampCredits(in.DefaultCredits), f
+	}
+
+	points, sets := 0, 0
+	for _, r := range recent {
+		points += r.FantasyPoints
+		sets += len(r.Stats.SetsPlayed)
+	}
+	f.Last5Average = round1(float64(points) / float64(len(recent)))
+	f.SetsPerMatch = round1(float64(sets) / float64(len(recent)))
+
+	// Form relative to the category: twice the category average is the
+	// largest rise, nothing at all the largest drop
+	if in.CategoryAverage > 0 {
+		f.FormAdjustment = clamp((f.Last5Average-in.CategoryAverage)/in.CategoryAverage*maxFormAdjustment, maxFormAdjustment)
+	}
+	// Players who miss sets are cheaper; regulars are not pushed up
+	f.SetsAdjustment = clamp((math.Min(f.SetsPerMatch/setsPerMatch, 1)-1)*maxSetsAdjustment, maxSetsAdjustment)
+	// A weak opponent makes points likelier
+	f.OpponentAdjustment = clamp((0.5-in.OpponentWinRate)*2*maxOpponentAdjustment, maxOpponentAdjustment)
+
+	f.FormAdjustment = round1(f.FormAdjustment)
+	f.SetsAdjustment = round1(f.SetsAdjustment)
+	f.OpponentAdjustment = round1(f.OpponentAdjustment)
+	return clampCredits(in.DefaultCredits + f.FormAdjustment + f.SetsAdjustment + f.OpponentAdjustment), f
+}
+
+// Whether credits are within bounds and on the step
+func ValidCredits(credits float64) bool {
+	return credits >= MinCredits && credits <= MaxCredits && math.Mod(credits, CreditsStep) == 0
+}
+
+func clampCredits(credits float64) float64 {
+	credits = math.Round(credits/CreditsStep) * CreditsStep
+	return math.Max(MinCredits, math.Min(MaxCredits, credits))
+}
+
+func clamp(v, limit float64) float64 {
+	return math.Max(-limit, math.Min(limit, v))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// An audited change to a player's credits, stored in priceChanges. Match
+// prices carry the match; default credit edits do not.
+type PriceChange struct {
+	ChangeID        string        `json:"changeId" firestore:"changeId"`
+	PlayerID        string        `json:"playerId" firestore:"playerId"`
+	MatchID         string        `json:"matchId" firestore:"matchId"`
+	Source          string        `json:"source" firestore:"source"`
+	OldCredits      float64       `json:"oldCredits" firestore:"oldCredits"`
+	NewCredits      float64       `json:"newCredits" firestore:"newCredits"`
+	ProposedCredits float64       `json:"proposedCredits" firestore:"proposedCredits"` // engine proposal at the time; 0 for default edits
+	Factors         *PriceFactors `json:"factors,omitempty" firestore:"factors,omitempty"`
+	Reason          string        `json:"reason" firestore:"reason"`
+	ChangedBy       string        `json:"changedBy" firestore:"changedBy"` // admin ID
+	ChangedAt       time.Time     `json:"changedAt" firestore:"changedAt"`
+}
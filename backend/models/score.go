@@ -0,0 +1,165 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Match statuses
+const (
+	MatchUpcoming  = "upcoming"
+	MatchLive      = "live"
+	MatchCompleted = "completed"
+)
+
+// Volleyball scoring: sets are played to 25 and the deciding fifth set to 15,
+// always with a two-point lead; three sets win the match.
+const (
+	SetTarget         = 25
+	DecidingSetTarget = 15
+	SetsToWin         = 3
+	MaxSets           = 2*SetsToWin - 1
+)
+
+// Points in one set. WinnerTeamID is set once the set is over.
+type SetScore struct {
+	Team1Points  int    `json:"team1Points" firestore:"team1Points"`
+	Team2Points  int    `json:"team2Points" firestore:"team2Points"`
+	WinnerTeamID string `json:"winnerTeamId" firestore:"winnerTeamId"`
+}
+
+// Points the given set (1-5) is played to
+func SetTargetFor(number int) int {
+	if number == MaxSets {
+		return DecidingSetTarget
+	}
+	return SetTarget
+}
+
+// Whether the leading side has reached the set's target with a two-point lead
+func (s SetScore) Finished(number int) bool {
+	high, low := s.Team1Points, s.Team2Points
+	if low > high {
+		high, low = low, high
+	}
+	return high >= SetTargetFor(number) && high-low >= 2
+}
+
+// The set being played, or nil between sets
+func (m *Match) CurrentSet() *SetScore {
+	if n := len(m.SetScores); n > 0 && m.SetScores[n-1].WinnerTeamID == "" {
+		return &m.SetScores[n-1]
+	}
+	return nil
+}
+
+// Derive set winners, sets won, the match winner and status from the set
+// points. Every set but the last must be finished and no set may follow the
+// match being decided. Marks the match live or completed as the score
+// requires, stamping StartedAt, CompletedAt and the duration; a match without
+// a status counts as upcoming.
+func (m *Match) Settle(now time.Time) error {
+	if len(m.SetScores) > MaxSets {
+		return fmt.Errorf("a match has at most %d sets", MaxSets)
+	}
+	if len(m.SetScores) > 0 && (m.Team1ID == "" || m.Team2ID == "") {
+		return fmt.Errorf("the match's teams are not decided yet")
+	}
+	team1Sets, team2Sets := 0, 0
+	winner := ""
+	for i := range m.SetScores {
+		set := &m.SetScores[i]
+		number := i + 1
+		if winner != "" {
+			return fmt.Errorf("set %d follows the end of the match", number)
+		}
+		if set.Team1Points < 0 || set.Team2Points < 0 {
+			return fmt.Errorf("set %d has negative points", number)
+		}
+
+		set.WinnerTeamID = ""
+		if !set.Finished(number) {
+			if number < len(m.SetScores) {
+				return fmt.Errorf("set %d is not finished (%d-%d)", number, set.Team1Points, set.Team2Points)
+			}
+			continue
+		}
+		target := SetTargetFor(number)
+		if max(set.Team1Points, set.Team2Points) > target && abs(set.Team1Points-set.Team2Points) != 2 {
+			return fmt.Errorf("set %d went past %d, so it must be won by exactly two (%d-%d)", number, target, set.Team1Points, set.Team2Points)
+		}
+		set.WinnerTeamID = m.Team1ID
+		if set.Team2Points > set.Team1Points {
+			set.WinnerTeamID = m.Team2ID
+		}
+
+		if set.WinnerTeamID == m.Team1ID {
+			team1Sets++
+		} else {
+			team2Sets++
+		}
+		if team1Sets == SetsToWin {
+			winner = m.Team1ID
+		} else if team2Sets == SetsToWin {
+			winner = m.Team2ID
+		}
+	}
+
+	m.Team1SetsWon, m.Team2SetsWon = team1Sets, team2Sets
+	m.WinnerTeamID = winner
+	switch {
+	case winner != "":
+		if m.Status != MatchCompleted || m.CompletedAt.IsZero() {
+			m.CompletedAt = now
+		}
+		m.Status = MatchCompleted
+		m.ServingTeamID = ""
+	case len(m.SetScores) > 0 || m.Status == MatchCompleted:
+		m.Status = MatchLive
+		m.CompletedAt = time.Time{}
+	case m.Status == "":
+		m.Status = MatchUpcoming // created without a status
+	}
+	if m.Status != MatchUpcoming && m.StartedAt.IsZero() {
+		m.StartedAt = now
+	}
+	m.DurationMinutes = 0
+	if !m.StartedAt.IsZero() {
+		end := now
+		if !m.CompletedAt.IsZero() {
+			end = m.CompletedAt
+		}
+		m.DurationMinutes = int(end.Sub(m.StartedAt).Minutes())
+	}
+	return nil
+}
+
+// Award a rally to teamID: starts the next set if none is in progress, adds the
+// point, hands the serve to the rally winner and settles the score
+func (m *Match) ScoreRally(teamID string, now time.Time) error {
+	if teamID == "" || (teamID != m.Team1ID && teamID != m.Team2ID) {
+		return fmt.Errorf("team %s does not play in this match", teamID)
+	}
+	if m.WinnerTeamID != "" {
+		return fmt.Errorf("the match is over")
+	}
+	set := m.CurrentSet()
+	if set == nil {
+		m.SetScores = append(m.SetScores, SetScore{})
+		set = &m.SetScores[len(m.SetScores)-1]
+	}
+	if teamID == m.Team1ID {
+		set.Team1Points++
+	} else {
+		set.Team2Points++
+	}
+	m.ServingTeamID = teamID
+	return m.Settle(now)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
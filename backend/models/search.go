@@ -0,0 +1,193 @@
+package models
+
+import (
+	"strings"
+)
+
+// How a search query matched a name, best first
+const (
+	MatchExact    = "exact"
+	MatchPrefix   = "prefix"
+	MatchPhonetic = "phonetic"
+	MatchFuzzy    = "fuzzy"
+)
+
+// Least similarity of two phonetic keys for a fuzzy match
+const minFuzzySimilarity = 0.7
+
+// Latin letters with diacritics, folded to ASCII
+var diacritics = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a", "ā", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e", "ē", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i", "ī", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o", "ō", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u", "ū", "u",
+	"ñ", "n", "ṇ", "n", "ṅ", "n", "ç", "c", "ś", "s", "ṣ", "s", "ṭ", "t", "ḍ", "d", "ṛ", "r", "ṁ", "m", "ṃ", "m", "ḥ", "h",
+)
+
+// Spellings that romanised Indian names use interchangeably, reduced to one
+// form. Order matters: longer clusters go first.
+var phoneticRules = strings.NewReplacer(
+	"sch", "s", "sh", "s", "ch", "c", "kh", "k", "gh", "g", "ph", "f", "bh", "b",
+	"dh", "d", "th", "t", "jh", "j", "ck", "k", "q", "k", "z", "j", "w", "v", "x", "ks",
+	"ee", "i", "oo", "u", "ou", "u", "aa", "a", "ii", "i", "uu", "u", "y", "i",
+)
+
+// A name prepared for matching: folded to lowercase ASCII words, with a
+// phonetic key and consonant skeleton per word
+type SearchName struct {
+	Folded    string
+	Tokens    []string
+	Keys      []string
+	Skeletons []string
+}
+
+func NewSearchName(name string) SearchName {
+	folded := diacritics.Replace(strings.ToLower(name))
+	folded = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return ' '
+	}, folded)
+	n := SearchName{Tokens: strings.Fields(folded)}
+	n.Folded = strings.Join(n.Tokens, " ")
+	for _, token := range n.Tokens {
+		key := phoneticKey(token)
+		n.Keys = append(n.Keys, key)
+		n.Skeletons = append(n.Skeletons, skeleton(key))
+	}
+	return n
+}
+
+// Phonetic form of one word: spelling variants merged, aspirate h dropped,
+// doubled letters collapsed and a trailing schwa removed, so Shaikh and
+// Sheikh or Karthik and Kartik meet
+func phoneticKey(token string) string {
+	key := phoneticRules.Replace(token)
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c == 'h' && i > 0 {
+			continue
+		}
+		if b.Len() > 0 && b.String()[b.Len()-1] == c {
+			continue
+		}
+		b.WriteByte(c)
+	}
+	key = b.String()
+	if len(key) > 3 && key[len(key)-1] == 'a' && !isVowel(key[len(key)-2]) {
+		key = key[:len(key)-1]
+	}
+	return key
+}
+
+// Key without vowels after the first letter, so Mohammad and Muhammed meet
+func skeleton(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		if i == 0 || !isVowel(key[i]) {
+			b.WriteByte(key[i])
+		}
+	}
+	return b.String()
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+// How well the query matches the name, from 0 (no match) to 1, and how. Every
+// word of the query has to match some word of the name; the score is their
+// mean.
+func (n SearchName) Match(query SearchName) (float64, string) {
+	if len(query.Tokens) == 0 || len(n.Tokens) == 0 {
+		return 0, ""
+	}
+	if n.Folded == query.Folded {
+		return 1, MatchExact
+	}
+	if strings.HasPrefix(n.Folded, query.Folded) {
+		return 0.95, MatchPrefix
+	}
+
+	total, kind := 0.0, MatchPrefix
+	for i := range query.Tokens {
+		best, bestKind := 0.0, ""
+		for j := range n.Tokens {
+			score, how := matchToken(query, i, n, j)
+			if score > best {
+				best, bestKind = score, how
+			}
+		}
+		if best == 0 {
+			return 0, ""
+		}
+		total += best
+		if matchRank(bestKind) > matchRank(kind) {
+			kind = bestKind
+		}
+	}
+	return total / float64(len(query.Tokens)), kind
+}
+
+func matchRank(kind string) int {
+	switch kind {
+	case MatchFuzzy:
+		return 3
+	case MatchPhonetic:
+		return 2
+	case MatchPrefix:
+		return 1
+	}
+	return 0
+}
+
+// Score of query word i against name word j
+func matchToken(q SearchName, i int, n SearchName, j int) (float64, string) {
+	qt, nt := q.Tokens[i], n.Tokens[j]
+	qk, nk := q.Keys[i], n.Keys[j]
+	switch {
+	case qt == nt:
+		return 1, MatchPrefix
+	case strings.HasPrefix(nt, qt):
+		return 0.9, MatchPrefix
+	case qk == nk:
+		return 0.85, MatchPhonetic
+	case len(qk) >= 2 && strings.HasPrefix(nk, qk):
+		return 0.8, MatchPhonetic
+	case len(qt) >= 4 && len(q.Skeletons[i]) >= 2 && q.Skeletons[i] == n.Skeletons[j]:
+		return 0.75, MatchPhonetic
+	}
+	if len(qt) < 3 {
+		return 0, ""
+	}
+	longest := max(len(qk), len(nk))
+	similarity := 1 - float64(levenshtein(qk, nk))/float64(longest)
+	if similarity < minFuzzySimilarity {
+		return 0, ""
+	}
+	return similarity * 0.7, MatchFuzzy
+}
+
+// Edit distance between two ASCII strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPhoneticKey(t *testing.T) {
+	tests := []struct {
+		token, key, skeleton string
+	}{
+		{"shaikh", "saik", "sk"},
+		{"sheikh", "seik", "sk"},
+		{"karthik", "kartik", "krtk"},
+		{"kartik", "kartik", "krtk"},
+		{"mohammad", "moamad", "mmd"},
+		{"muhammed", "muamed", "mmd"},
+		{"ashwin", "asvin", "asvn"},
+		{"joshna", "josn", "jsn"}, // trailing schwa dropped
+	}
+	for _, tt := range tests {
+		key := phoneticKey(tt.token)
+		if key != tt.key {
+			t.Errorf("phoneticKey(%q) = %q, want %q", tt.token, key, tt.key)
+		}
+		if got := skeleton(key); got != tt.skeleton {
+			t.Errorf("skeleton(%q) = %q, want %q", key, got, tt.skeleton)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name, query string
+		score       float64
+		kind        string
+	}{
+		{"Karthik Raja", "karthik raja", 1, MatchExact},
+		{"Karthik Raja", "Kar", 0.95, MatchPrefix},
+		{"Karthik", "Kartik", 0.85, MatchPhonetic},
+		{"Karthik Raja", "Kartik", 0.85, MatchPhonetic},
+		{"Shaikh", "Sheikh", 0.75, MatchPhonetic},
+		{"Mohammad", "Muhammed", 0.75, MatchPhonetic},
+		{"Mohammad Shaikh", "Muhammed Sheikh", 0.75, MatchPhonetic},
+		{"Karthik", "Kartil", 0.7 * (1 - 1.0/6), MatchFuzzy},
+		{"Mohammad Shaikh", "Muhammed Rohit", 0, ""}, // every query word has to match
+		{"Rohit", "Sheikh", 0, ""},
+		{"Karthik", "", 0, ""},
+	}
+	for _, tt := range tests {
+		score, kind := NewSearchName(tt.name).Match(NewSearchName(tt.query))
+		if math.Abs(score-tt.score) > 1e-9 || kind != tt.kind {
+			t.Errorf("%q.Match(%q) = %v, %q; want %v, %q", tt.name, tt.query, score, kind, tt.score, tt.kind)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"same", "same", 0},
+		{"kitten", "sitting", 3},
+		{"karthik", "kartik", 1},
+		{"shaikh", "sheikh", 1},
+		{"mohammad", "muhammed", 2},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
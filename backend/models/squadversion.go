@@ -0,0 +1,194 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// What wrote a squad version
+const (
+	SquadSourceCreate       = "create"
+	SquadSourceEdit         = "edit"
+	SquadSourceAutoAssign   = "auto_assign"
+	SquadSourceLineup       = "lineup"
+	SquadSourcePricing      = "pricing"
+	SquadSourceAvailability = "availability"
+	SquadSourceArchive      = "archive"
+	SquadSourceMerge        = "merge"
+	SquadSourceLock         = "lock" // baseline for squads written before versioning
+)
+
+// Kinds of squad change
+const (
+	SquadPlayerAdded   = "added"
+	SquadPlayerRemoved = "removed"
+	SquadPlayerChanged = "changed"
+)
+
+// One difference between two versions of a squad. Changed entries name the
+// field; live stats, form and pick rates are derived and not compared.
+type SquadChange struct {
+	Kind     string `json:"kind" firestore:"kind"`
+	TeamID   string `json:"teamId" firestore:"teamId"`
+	PlayerID string `json:"playerId" firestore:"playerId"`
+	Field    string `json:"field,omitempty" firestore:"field,omitempty"`
+	From     string `json:"from,omitempty" firestore:"from,omitempty"`
+	To       string `json:"to,omitempty" firestore:"to,omitempty"`
+}
+
+// A fantasy team touched by an edit after lock
+type TeamImpact struct {
+	TeamID        string   `json:"teamId" firestore:"teamId"`
+	UserID        string   `json:"userId" firestore:"userId"`
+	Players       []string `json:"players" firestore:"players"` // picked players the edit changed or removed
+	CreditsBefore float64  `json:"creditsBefore" firestore:"creditsBefore"`
+	CreditsAfter  float64  `json:"creditsAfter" firestore:"creditsAfter"`
+}
+
+// Record of an edit made after the squad locked
+type SquadOverride struct {
+	LockedVersion int          `json:"lockedVersion" firestore:"lockedVersion"`
+	TeamsAffected int          `json:"teamsAffected" firestore:"teamsAffected"`
+	Teams         []TeamImpact `json:"teams" firestore:"teams"`
+}
+
+// One write of a match squad, stored at matchSquads/{matchId}/versions/{version}
+type SquadVersion struct {
+	MatchID   string         `json:"matchId" firestore:"matchId"`
+	Version   int            `json:"version" firestore:"version"`
+	Source    string         `json:"source" firestore:"source"`
+	Reason    string         `json:"reason" firestore:"reason"`
+	ChangedBy string         `json:"changedBy" firestore:"changedBy"` // admin ID; empty for system writes
+	Changes   []SquadChange  `json:"changes" firestore:"changes"`     // against the previous version
+	Override  *SquadOverride `json:"override,omitempty" firestore:"override,omitempty"`
+	Squad     MatchSquad     `json:"squad" firestore:"squad"` // as written
+	CreatedAt time.Time      `json:"createdAt" firestore:"createdAt"`
+}
+
+// A copy of the squad whose player lists can be changed without touching sq's
+func (sq MatchSquad) Clone() MatchSquad {
+	sq.Team1Players = append([]MatchSquadPlayer{}, sq.Team1Players...)
+	sq.Team2Players = append([]MatchSquadPlayer{}, sq.Team2Players...)
+	return sq
+}
+
+// Document ID of a version, zero-padded so IDs sort in order
+func SquadVersionID(version int) string {
+	return fmt.Sprintf("%06d", version)
+}
+
+func squadFields(p MatchSquadPlayer) [][2]string {
+	availability := ""
+	if p.Availability != nil {
+		availability = p.Availability.Status
+	}
+	return [][2]string{
+		{"playerName", p.PlayerName},
+		{"category", p.Category},
+		{"credits", strconv.FormatFloat(p.Credits, 'f', -1, 64)},
+		{"isStarting6", strconv.FormatBool(p.IsStarting6)},
+		{"isLibero", strconv.FormatBool(p.IsLibero)},
+		{"jerseyNumber", strconv.Itoa(p.JerseyNumber)},
+		{"availability", availability},
+	}
+}
+
+// Differences from old to next: changed and added players in next's order,
+// then removed ones in old's
+func DiffSquads(old, next MatchSquad) []SquadChange {
+	changes := []SquadChange{}
+	for _, side := range []struct {
+		before, after []MatchSquadPlayer
+		teamID        string
+	}{
+		{old.Team1Players, next.Team1Players, next.Team1ID},
+		{old.Team2Players, next.Team2Players, next.Team2ID},
+	} {
+		before, after, teamID := side.before, side.after, side.teamID
+		byID := make(map[string]MatchSquadPlayer, len(before))
+		for _, p := range before {
+			byID[p.PlayerID] = p
+		}
+		kept := map[string]bool{}
+		for _, p := range after {
+			kept[p.PlayerID] = true
+			prev, ok := byID[p.PlayerID]
+			if !ok {
+				changes = append(changes, SquadChange{Kind: SquadPlayerAdded, TeamID: teamID, PlayerID: p.PlayerID})
+				continue
+			}
+			from, to := squadFields(prev), squadFields(p)
+			for i := range to {
+				if from[i][1] != to[i][1] {
+					changes = append(changes, SquadChange{Kind: SquadPlayerChanged, TeamID: teamID, PlayerID: p.PlayerID, Field: to[i][0], From: from[i][1], To: to[i][1]})
+				}
+			}
+		}
+		for _, p := range before {
+			if !kept[p.PlayerID] {
+				changes = append(changes, SquadChange{Kind: SquadPlayerRemoved, TeamID: teamID, PlayerID: p.PlayerID})
+			}
+		}
+	}
+	return changes
+}
+
+// The version that writing next over prev creates. next takes the following
+// version number and prev's lock. ok is false when nothing compared changed
+// and prev is already versioned, in which case no version is stored.
+func NextSquadVersion(prev MatchSquad, next *MatchSquad, source, reason, changedBy string, now time.Time) (SquadVersion, bool) {
+	changes := DiffSquads(prev, *next)
+	next.Version = prev.Version
+	next.LockedVersion = prev.LockedVersion
+	next.LockedAt = prev.LockedAt
+	if len(changes) == 0 && prev.Version > 0 {
+		return SquadVersion{}, false
+	}
+	next.Version = prev.Version + 1
+	return SquadVersion{
+		MatchID:   next.MatchID,
+		Version:   next.Version,
+		Source:    source,
+		Reason:    reason,
+		ChangedBy: changedBy,
+		Changes:   changes,
+		Squad:     *next,
+		CreatedAt: now,
+	}, true
+}
+
+func squadCredits(squad MatchSquad) map[string]float64 {
+	credits := map[string]float64{}
+	for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+		for _, p := range players {
+			credits[p.PlayerID] = p.Credits
+		}
+	}
+	return credits
+}
+
+// Fantasy teams that picked a player the changes touch, with their credits
+// under the squad before and after
+func ImpactOn(teams []UserTeam, changes []SquadChange, before, after MatchSquad) []TeamImpact {
+	touched := map[string]bool{}
+	for _, c := range changes {
+		touched[c.PlayerID] = true
+	}
+	creditsBefore, creditsAfter := squadCredits(before), squadCredits(after)
+	impacts := []TeamImpact{}
+	for _, team := range teams {
+		impact := TeamImpact{TeamID: team.TeamID, UserID: team.UserID, Players: []string{}}
+		for _, id := range team.Players {
+			impact.CreditsBefore += creditsBefore[id]
+			impact.CreditsAfter += creditsAfter[id]
+			if touched[id] {
+				impact.Players = append(impact.Players, id)
+			}
+		}
+		if len(impact.Players) > 0 {
+			impacts = append(impacts, impact)
+		}
+	}
+	return impacts
+}
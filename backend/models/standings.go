@@ -0,0 +1,232 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// League points awarded per match result. A league whose scheme is all zero
+// uses DefaultPointsScheme.
+type PointsScheme struct {
+	StraightWin  int `json:"straightWin" firestore:"straightWin"`   // 3-0 or 3-1
+	TieBreakWin  int `json:"tieBreakWin" firestore:"tieBreakWin"`   // 3-2
+	TieBreakLoss int `json:"tieBreakLoss" firestore:"tieBreakLoss"` // 2-3
+	StraightLoss int `json:"straightLoss" firestore:"straightLoss"` // 0-3 or 1-3
+}
+
+// FIVB scheme: 3 points for a 3-0 or 3-1 win, 2 for 3-2, 1 for 2-3
+var DefaultPointsScheme = PointsScheme{StraightWin: 3, TieBreakWin: 2, TieBreakLoss: 1}
+
+// The league's points scheme, or the default when none is set
+func (l League) Scheme() PointsScheme {
+	if l.PointsScheme == (PointsScheme{}) {
+		return DefaultPointsScheme
+	}
+	return l.PointsScheme
+}
+
+// League points for a team that won setsFor sets and lost setsAgainst
+func (p PointsScheme) Points(setsFor, setsAgainst int) int {
+	tieBreak := setsFor+setsAgainst == MaxSets
+	switch {
+	case setsFor > setsAgainst && tieBreak:
+		return p.TieBreakWin
+	case setsFor > setsAgainst:
+		return p.StraightWin
+	case tieBreak:
+		return p.TieBreakLoss
+	}
+	return p.StraightLoss
+}
+
+// A completed match as it counts towards the standings
+type MatchResult struct {
+	MatchID     string    `json:"matchId" firestore:"matchId"`
+	Team1ID     string    `json:"team1Id" firestore:"team1Id"`
+	Team2ID     string    `json:"team2Id" firestore:"team2Id"`
+	Team1       TeamInfo  `json:"team1" firestore:"team1"`
+	Team2       TeamInfo  `json:"team2" firestore:"team2"`
+	Team1Sets   int       `json:"team1Sets" firestore:"team1Sets"`
+	Team2Sets   int       `json:"team2Sets" firestore:"team2Sets"`
+	Team1Points int       `json:"team1Points" firestore:"team1Points"` // rally points over all sets
+	Team2Points int       `json:"team2Points" firestore:"team2Points"`
+	CompletedAt time.Time `json:"completedAt" firestore:"completedAt"`
+}
+
+// Whether the match counts towards the league table. Playoff matches don't,
+// and neither do cancelled ones.
+func (m *Match) LeagueStage() bool {
+	return m.Stage != StagePlayoff && m.ArchivedAt.IsZero()
+}
+
+// Whether every league-stage match among the league's matches is completed
+func LeagueStageComplete(matches []Match) bool {
+	for i := range matches {
+		if matches[i].LeagueStage() && matches[i].Status != MatchCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// The result of a completed match
+func (m *Match) Result() MatchResult {
+	result := MatchResult{
+		MatchID:     m.MatchID,
+		Team1ID:     m.Team1ID,
+		Team2ID:     m.Team2ID,
+		Team1:       m.Team1,
+		Team2:       m.Team2,
+		Team1Sets:   m.Team1SetsWon,
+		Team2Sets:   m.Team2SetsWon,
+		CompletedAt: m.CompletedAt,
+	}
+	for _, set := range m.SetScores {
+		result.Team1Points += set.Team1Points
+		result.Team2Points += set.Team2Points
+	}
+	return result
+}
+
+// One team's line in the table. The ratios are nil when nothing was lost,
+// which tables show as MAX.
+type StandingsRow struct {
+	Position      int      `json:"position" firestore:"position"`
+	TeamID        string   `json:"teamId" firestore:"teamId"`
+	Team          TeamInfo `json:"team" firestore:"team"`
+	Played        int      `json:"played" firestore:"played"`
+	Won           int      `json:"won" firestore:"won"`
+	Lost          int      `json:"lost" firestore:"lost"`
+	SetsWon       int      `json:"setsWon" firestore:"setsWon"`
+	SetsLost      int      `json:"setsLost" firestore:"setsLost"`
+	SetRatio      *float64 `json:"setRatio" firestore:"setRatio"`
+	PointsFor     int      `json:"pointsFor" firestore:"pointsFor"`
+	PointsAgainst int      `json:"pointsAgainst" firestore:"pointsAgainst"`
+	PointsRatio   *float64 `json:"pointsRatio" firestore:"pointsRatio"`
+	LeaguePoints  int      `json:"leaguePoints" firestore:"leaguePoints"`
+}
+
+// A league's table, stored at standings/{leagueId} with the results it was
+// built from, keyed by match ID, so one match can be applied or withdrawn
+// without reading the others
+type Standings struct {
+	LeagueID     string                 `json:"leagueId" firestore:"leagueId"`
+	PointsScheme PointsScheme           `json:"pointsScheme" firestore:"pointsScheme"`
+	Results      map[string]MatchResult `json:"-" firestore:"results"`
+	Rows         []StandingsRow         `json:"rows" firestore:"rows"`
+	UpdatedAt    time.Time              `json:"updatedAt" firestore:"updatedAt"`
+}
+
+// Build the table from match results. Every team in teams gets a row, played
+// or not. Teams are ranked by league points, then wins, set ratio, points
+// ratio and name.
+func BuildStandings(results map[string]MatchResult, scheme PointsScheme, teams map[string]TeamInfo) []StandingsRow {
+	rows := map[string]*StandingsRow{}
+	row := func(teamID string, info TeamInfo) *StandingsRow {
+		r, ok := rows[teamID]
+		if !ok {
+			r = &StandingsRow{TeamID: teamID, Team: info}
+			rows[teamID] = r
+		}
+		return r
+	}
+	for teamID, info := range teams {
+		row(teamID, info)
+	}
+	for _, result := range results {
+		for _, side := range []struct {
+			team, opponent         *StandingsRow
+			sets, oppSets          int
+			points, opponentPoints int
+		}{
+			{row(result.Team1ID, result.Team1), row(result.Team2ID, result.Team2), result.Team1Sets, result.Team2Sets, result.Team1Points, result.Team2Points},
+			{row(result.Team2ID, result.Team2), row(result.Team1ID, result.Team1), result.Team2Sets, result.Team1Sets, result.Team2Points, result.Team1Points},
+		} {
+			r := side.team
+			r.Played++
+			if side.sets > side.oppSets {
+				r.Won++
+			} else {
+				r.Lost++
+			}
+			r.SetsWon += side.sets
+			r.SetsLost += side.oppSets
+			r.PointsFor += side.points
+			r.PointsAgainst += side.opponentPoints
+			r.LeaguePoints += scheme.Points(side.sets, side.oppSets)
+		}
+	}
+
+	table := make([]StandingsRow, 0, len(rows))
+	for _, r := range rows {
+		r.SetRatio = ratio(r.SetsWon, r.SetsLost)
+		r.PointsRatio = ratio(r.PointsFor, r.PointsAgainst)
+		table = append(table, *r)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if a.LeaguePoints != b.LeaguePoints {
+			return a.LeaguePoints > b.LeaguePoints
+		}
+		if a.Won != b.Won {
+			return a.Won > b.Won
+		}
+		if c := compareRatio(a.SetsWon, a.SetsLost, b.SetsWon, b.SetsLost); c != 0 {
+			return c > 0
+		}
+		if c := compareRatio(a.PointsFor, a.PointsAgainst, b.PointsFor, b.PointsAgainst); c != 0 {
+			return c > 0
+		}
+		if a.Team.Name != b.Team.Name {
+			return strings.ToLower(a.Team.Name) < strings.ToLower(b.Team.Name)
+		}
+		return a.TeamID < b.TeamID
+	})
+	for i := range table {
+		table[i].Position = i + 1
+	}
+	return table
+}
+
+func ratio(won, lost int) *float64 {
+	if lost == 0 {
+		return nil
+	}
+	r := float64(won) / float64(lost)
+	return &r
+}
+
+// Compare a/b with c/d, where anything over zero is infinite and 0/0 ranks
+// lowest. Returns 1, 0 or -1.
+func compareRatio(a, b, c, d int) int {
+	rank := func(won, lost int) int {
+		switch {
+		case lost == 0 && won > 0:
+			return 2
+		case lost == 0:
+			return 0
+		}
+		return 1
+	}
+	ra, rc := rank(a, b), rank(c, d)
+	switch {
+	case ra != rc:
+		return sign(ra - rc)
+	case ra == 2:
+		return sign(a - c)
+	case ra == 0:
+		return 0
+	}
+	return sign(a*d - c*b)
+}
+
+func sign(v int) int {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
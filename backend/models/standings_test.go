@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeagueStageComplete(t *testing.T) {
+	archived := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		matches []Match
+		want    bool
+	}{
+		{"no matches", nil, true},
+		{"all completed", []Match{
+			{Status: MatchCompleted},
+			{Status: MatchCompleted, Stage: StageLeague},
+		}, true},
+		{"league match upcoming", []Match{
+			{Status: MatchCompleted},
+			{Status: MatchUpcoming, Stage: StageLeague},
+		}, false},
+		{"match without a stage live", []Match{
+			{Status: MatchLive},
+		}, false},
+		{"only playoffs unfinished", []Match{
+			{Status: MatchCompleted},
+			{Status: MatchUpcoming, Stage: StagePlayoff},
+			{Status: MatchLive, Stage: StagePlayoff},
+		}, true},
+		{"archived fixtures unfinished", []Match{
+			{Status: MatchCompleted},
+			{Status: MatchUpcoming, ArchivedAt: archived},
+			{Status: MatchLive, Stage: StageLeague, ArchivedAt: archived},
+		}, true},
+		{"archived fixture beside an unfinished one", []Match{
+			{Status: MatchUpcoming, ArchivedAt: archived},
+			{Status: MatchUpcoming},
+		}, false},
+	}
+	for _, tt := range tests {
+		if got := LeagueStageComplete(tt.matches); got != tt.want {
+			t.Errorf("%s: LeagueStageComplete = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchLeagueStage(t *testing.T) {
+	archived := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		match Match
+		want  bool
+	}{
+		{Match{}, true},
+		{Match{Stage: StageLeague}, true},
+		{Match{Stage: StagePlayoff}, false},
+		{Match{ArchivedAt: archived}, false},
+		{Match{Stage: StageLeague, ArchivedAt: archived}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.match.LeagueStage(); got != tt.want {
+			t.Errorf("Match{Stage: %q, ArchivedAt: %v}.LeagueStage() = %v, want %v", tt.match.Stage, tt.match.ArchivedAt, got, tt.want)
+		}
+	}
+}
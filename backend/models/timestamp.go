@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // the container image may not ship a zoneinfo database
+)
+
+// Timezone assumed for leagues that don't set one. Admins enter match times in IST.
+const DefaultLeagueTimezone = "Asia/Kolkata"
+
+// Layouts accepted by ParseTimestamp. Layouts without an offset are wall-clock
+// times interpreted in the caller's location.
+var timestampLayouts = []struct {
+	layout    string
+	hasOffset bool
+}{
+	{time.RFC3339Nano, true},
+	{"2006-01-02T15:04:05", false},
+	{"2006-01-02T15:04", false},
+	{"2006-01-02 15:04:05", false},
+	{"2006-01-02 15:04", false},
+	{"2006-01-02", false},
+}
+
+// The single place a client- or legacy-supplied time string becomes a timestamp.
+// Values with an explicit offset keep it; values without one are read as wall-clock
+// time in loc. The result is normalised to UTC, which is how Firestore stores it.
+func ParseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("Time value is empty")
+	}
+	for _, candidate := range timestampLayouts {
+		var t time.Time
+		var err error
+		if candidate.hasOffset {
+			t, err = time.Parse(candidate.layout, value)
+		} else {
+			t, err = time.ParseInLocation(candidate.layout, value, loc)
+		}
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unrecognised time %q; use RFC 3339 or YYYY-MM-DDTHH:MM", value)
+}
+
+// Resolve an IANA timezone name, falling back to the default league timezone
+func LoadLeagueLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultLeagueTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// Whether team creation and contest entry are closed for a match
+func (m Match) IsLocked(now time.Time) bool {
+	return !now.Before(m.StartTime)
+}
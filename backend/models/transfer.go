@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Whether the association covers the given time. Its spell runs from
+// StartDate up to but not including EndDate; a zero StartDate is open at the
+// start and a zero EndDate open at the end. Legacy associations with neither
+// date go by IsActive. For dated ones IsActive is only as of the last write,
+// so a spell is ended by setting EndDate.
+func (tp TeamPlayer) ValidOn(t time.Time) bool {
+	if tp.StartDate.IsZero() && tp.EndDate.IsZero() {
+		return tp.IsActive
+	}
+	return !t.Before(tp.StartDate) && (tp.EndDate.IsZero() || t.Before(tp.EndDate))
+}
+
+// Whether the association is in force at t or may be later: it has not
+// ended, though it may not have started yet
+func (tp TeamPlayer) OpenAt(t time.Time) bool {
+	if tp.StartDate.IsZero() && tp.EndDate.IsZero() {
+		return tp.IsActive
+	}
+	return tp.EndDate.IsZero() || tp.EndDate.After(t)
+}
+
+// Whether the spells of two associations share any time. Legacy associations
+// without dates overlap only while both are active.
+func (tp TeamPlayer) Overlaps(other TeamPlayer) bool {
+	undated := func(a TeamPlayer) bool { return a.StartDate.IsZero() && a.EndDate.IsZero() }
+	if undated(tp) || undated(other) {
+		return tp.IsActive && other.IsActive
+	}
+	startsBeforeOtherEnds := other.EndDate.IsZero() || tp.StartDate.Before(other.EndDate)
+	otherStartsBeforeEnd := tp.EndDate.IsZero() || other.StartDate.Before(tp.EndDate)
+	return startsBeforeOtherEnds && otherStartsBeforeEnd
+}
+
+func (tp TeamPlayer) spell() string {
+	from, to := "the start", "open-ended"
+	if !tp.StartDate.IsZero() {
+		from = tp.StartDate.Format(time.DateOnly)
+	}
+	if !tp.EndDate.IsZero() {
+		to = tp.EndDate.Format(time.DateOnly)
+	}
+	return from + " to " + to
+}
+
+// Problems with opening an association, one message per problem: its dates,
+// a spell of the same player overlapping it (the player's own associations
+// in playerSpells), and another player of the team wearing the same jersey in
+// the same season at the same time (the team's associations in teamSpells).
+// Associations with the same ID are ignored.
+func AssociationProblems(tp TeamPlayer, playerSpells, teamSpells []TeamPlayer) []string {
+	var problems []string
+	if tp.PlayerID == "" {
+		problems = append(problems, "playerId is required")
+	}
+	if tp.TeamID == "" {
+		problems = append(problems, "teamId is required")
+	}
+	if tp.JerseyNumber < 0 {
+		problems = append(problems, "jerseyNumber cannot be negative")
+	}
+	if !tp.EndDate.IsZero() && !tp.EndDate.After(tp.StartDate) {
+		problems = append(problems, "endDate must be after startDate")
+	}
+	for _, other := range playerSpells {
+		if other.AssociationID == tp.AssociationID || other.PlayerID != tp.PlayerID {
+			continue
+		}
+		if tp.Overlaps(other) {
+			problems = append(problems, fmt.Sprintf("player %s already has a spell at team %s from %s (%s)", tp.PlayerID, other.TeamID, other.spell(), other.AssociationID))
+		}
+	}
+	for _, other := range teamSpells {
+		if other.AssociationID == tp.AssociationID || other.PlayerID == tp.PlayerID || other.TeamID != tp.TeamID {
+			continue
+		}
+		if tp.JerseyNumber != 0 && other.JerseyNumber == tp.JerseyNumber && other.Season == tp.Season && tp.Overlaps(other) {
+			problems = append(problems, fmt.Sprintf("jersey %d is worn by player %s at team %s in season %s", tp.JerseyNumber, other.PlayerID, tp.TeamID, tp.Season))
+		}
+	}
+	return problems
+}
+
+// A player's move between teams, stored in transfers. The old association is
+// closed on Date and the new one opened on it.
+type Transfer struct {
+	TransferID        string    `json:"transferId" firestore:"transferId"`
+	PlayerID          string    `json:"playerId" firestore:"playerId"`
+	FromTeamID        string    `json:"fromTeamId" firestore:"fromTeamId"` // empty when the player had no team
+	ToTeamID          string    `json:"toTeamId" firestore:"toTeamId"`
+	FromAssociationID string    `json:"fromAssociationId" firestore:"fromAssociationId"`
+	ToAssociationID   string    `json:"toAssociationId" firestore:"toAssociationId"`
+	LeagueID          string    `json:"leagueId" firestore:"leagueId"`
+	Season            string    `json:"season" firestore:"season"`
+	JerseyNumber      int       `json:"jerseyNumber" firestore:"jerseyNumber"`
+	Date              time.Time `json:"date" firestore:"date"`
+	Note              string    `json:"note" firestore:"note"`
+	CreatedBy         string    `json:"createdBy" firestore:"createdBy"` // admin ID
+	CreatedAt         time.Time `json:"createdAt" firestore:"createdAt"`
+}
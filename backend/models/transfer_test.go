@@ -0,0 +1,137 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func spell(start, end int) TeamPlayer {
+	var tp TeamPlayer
+	if start != 0 {
+		tp.StartDate = day(start)
+	}
+	if end != 0 {
+		tp.EndDate = day(end)
+	}
+	return tp
+}
+
+func TestTeamPlayerValidOn(t *testing.T) {
+	tick := time.Nanosecond
+	tests := []struct {
+		name string
+		tp   TeamPlayer
+		at   time.Time
+		want bool
+	}{
+		{"before start", spell(10, 20), day(10).Add(-tick), false},
+		{"on start", spell(10, 20), day(10), true},
+		{"inside", spell(10, 20), day(15), true},
+		{"just before end", spell(10, 20), day(20).Add(-tick), true},
+		{"on end", spell(10, 20), day(20), false},
+		{"open-ended", spell(10, 0), day(31), true},
+		{"open-ended before start", spell(10, 0), day(9), false},
+		{"open start", spell(0, 20), day(1), true},
+		{"open start on end", spell(0, 20), day(20), false},
+		{"undated active", TeamPlayer{IsActive: true}, day(1), true},
+		{"undated inactive", TeamPlayer{}, day(1), false},
+		{"dated ignores isActive", TeamPlayer{StartDate: day(10), IsActive: true}, day(1), false},
+	}
+	for _, tt := range tests {
+		if got := tt.tp.ValidOn(tt.at); got != tt.want {
+			t.Errorf("%s: ValidOn = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTeamPlayerOpenAt(t *testing.T) {
+	tests := []struct {
+		name string
+		tp   TeamPlayer
+		at   time.Time
+		want bool
+	}{
+		{"not started yet", spell(10, 20), day(1), true},
+		{"running", spell(10, 20), day(15), true},
+		{"on end", spell(10, 20), day(20), false},
+		{"ended", spell(10, 20), day(25), false},
+		{"open-ended", spell(10, 0), day(31), true},
+		{"undated active", TeamPlayer{IsActive: true}, day(1), true},
+		{"undated inactive", TeamPlayer{}, day(1), false},
+	}
+	for _, tt := range tests {
+		if got := tt.tp.OpenAt(tt.at); got != tt.want {
+			t.Errorf("%s: OpenAt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTeamPlayerOverlaps(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b TeamPlayer
+		want bool
+	}{
+		{"disjoint", spell(1, 5), spell(10, 20), false},
+		{"end meets start", spell(1, 10), spell(10, 20), false},
+		{"one day shared", spell(1, 11), spell(10, 20), true},
+		{"contained", spell(1, 30), spell(10, 20), true},
+		{"same spell", spell(10, 20), spell(10, 20), true},
+		{"open-ended after", spell(10, 0), spell(1, 10), false},
+		{"open-ended over", spell(10, 0), spell(1, 11), true},
+		{"both open-ended", spell(10, 0), spell(20, 0), true},
+		{"open start before", spell(0, 10), spell(10, 20), false},
+		{"open start over", spell(0, 11), spell(10, 20), true},
+		{"undated both active", TeamPlayer{IsActive: true}, TeamPlayer{IsActive: true}, true},
+		{"undated one inactive", TeamPlayer{IsActive: true}, TeamPlayer{}, false},
+		{"undated and dated active", TeamPlayer{IsActive: true}, TeamPlayer{StartDate: day(1), IsActive: true}, true},
+		{"undated and dated inactive", TeamPlayer{IsActive: true}, spell(1, 5), false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Overlaps(tt.b); got != tt.want {
+			t.Errorf("%s: a.Overlaps(b) = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.b.Overlaps(tt.a); got != tt.want {
+			t.Errorf("%s: b.Overlaps(a) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAssociationProblems(t *testing.T) {
+	tp := TeamPlayer{AssociationID: "new", PlayerID: "p1", TeamID: "t1", Season: "2025", JerseyNumber: 7, StartDate: day(10)}
+	tests := []struct {
+		name         string
+		tp           TeamPlayer
+		playerSpells []TeamPlayer
+		teamSpells   []TeamPlayer
+		want         []string
+	}{
+		{"clean", tp, nil, nil, nil},
+		{"end not after start", TeamPlayer{PlayerID: "p1", TeamID: "t1", StartDate: day(10), EndDate: day(10)}, nil, nil,
+			[]string{"endDate must be after startDate"}},
+		{"player spell overlaps", tp,
+			[]TeamPlayer{{AssociationID: "old", PlayerID: "p1", TeamID: "t2", StartDate: day(1), EndDate: day(11)}}, nil,
+			[]string{"player p1 already has a spell at team t2 from 2025-01-01 to 2025-01-11 (old)"}},
+		{"player spell ends on start", tp,
+			[]TeamPlayer{{AssociationID: "old", PlayerID: "p1", TeamID: "t2", StartDate: day(1), EndDate: day(10)}}, nil, nil},
+		{"itself ignored", tp, []TeamPlayer{tp}, []TeamPlayer{tp}, nil},
+		{"jersey taken", tp, nil,
+			[]TeamPlayer{{AssociationID: "x", PlayerID: "p2", TeamID: "t1", Season: "2025", JerseyNumber: 7, StartDate: day(1)}},
+			[]string{"jersey 7 is worn by player p2 at team t1 in season 2025"}},
+		{"jersey free another season", tp, nil,
+			[]TeamPlayer{{AssociationID: "x", PlayerID: "p2", TeamID: "t1", Season: "2024", JerseyNumber: 7, StartDate: day(1)}}, nil},
+		{"jersey freed before start", tp, nil,
+			[]TeamPlayer{{AssociationID: "x", PlayerID: "p2", TeamID: "t1", Season: "2025", JerseyNumber: 7, StartDate: day(1), EndDate: day(10)}}, nil},
+	}
+	for _, tt := range tests {
+		got := AssociationProblems(tt.tp, tt.playerSpells, tt.teamSpells)
+		if strings.Join(got, "; ") != strings.Join(tt.want, "; ") {
+			t.Errorf("%s: problems %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
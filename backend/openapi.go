@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenAPI 3 document describing every route registered in main().
+// Keep it in sync when adding or changing a route; missing routes are logged at startup.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Largest request body the validator will read
+const maxRequestBodyBytes = 1 << 20
+
+// Subset of JSON Schema understood by the request validator
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *schema            `json:"items"`
+	Enum       []interface{}      `json:"enum"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	MinLength  *int               `json:"minLength"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+}
+
+type apiOperation struct {
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type apiSpec struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadAPISpec() (*apiSpec, error) {
+	var spec apiSpec
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		return nil, fmt.Errorf("parse openapi.json: %w", err)
+	}
+	return &spec, nil
+}
+
+// Request body schema for a route template and method, or nil if the operation takes no body
+func (spec *apiSpec) bodySchema(pathTemplate, method string) *schema {
+	op := spec.Paths[pathTemplate][strings.ToLower(method)]
+	if op == nil || op.RequestBody == nil {
+		return nil
+	}
+	return op.RequestBody.Content["application/json"].Schema
+}
+
+// Log routes registered on the router that the document does not describe
+func (spec *apiSpec) reportUndocumentedRoutes(router *mux.Router) {
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			if spec.Paths[tpl][strings.ToLower(method)] == nil {
+				log.Printf("openapi.json does not document %s %s", method, tpl)
+			}
+		}
+		return nil
+	})
+}
+
+// Serve the OpenAPI document (public endpoint)
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// Middleware that rejects request bodies not matching the operation's schema.
+// The auth middlewares run it after authenticating, so only callers allowed on a route see its schema errors.
+func (s *Server) validateRequestBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bodySchema := s.apiSpec.bodySchema(tpl, r.Method)
+		if bodySchema == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+		if err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "Failed to read request body"))
+			return
+		}
+		if len(body) > maxRequestBodyBytes {
+			writeError(w, r, errorf(ErrBodyTooLarge, "Request body exceeds %d bytes", maxRequestBodyBytes))
+			return
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "Request body is not valid JSON: %v", err))
+			return
+		}
+		if problems := s.apiSpec.validate(bodySchema, value, ""); len(problems) > 0 {
+			writeError(w, r, errorWithDetails(ErrInvalidRequest, problems, "Request body does not match the API schema"))
+			return
+		}
+
+		// Hand the handler a fresh reader over the bytes we consumed
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Validate a decoded JSON value against a schema, returning one message per violation.
+// Null is accepted for optional properties, matching how encoding/json treats it.
+func (spec *apiSpec) validate(sch *schema, value interface{}, path string) []string {
+	if sch.Ref != "" {
+		name := strings.TrimPrefix(sch.Ref, "#/components/schemas/")
+		resolved, ok := spec.Components.Schemas[name]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", displayPath(path), name)}
+		}
+		return spec.validate(resolved, value, path)
+	}
+
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, displayPath(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch sch.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("expected object")
+			return problems
+		}
+		for _, name := range sch.Required {
+			if v, present := obj[name]; !present || v == nil {
+				problems = append(problems, displayPath(joinPath(path, name))+": is required")
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, known := sch.Properties[name]
+			if !known || obj[name] == nil {
+				continue
+			}
+			problems = append(problems, spec.validate(prop, obj[name], joinPath(path, name))...)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("expected array")
+			return problems
+		}
+		if sch.MinItems != nil && len(items) < *sch.MinItems {
+			fail("must have at least %d items", *sch.MinItems)
+		}
+		if sch.MaxItems != nil && len(items) > *sch.MaxItems {
+			fail("must have at most %d items", *sch.MaxItems)
+		}
+		if sch.Items != nil {
+			for i, item := range items {
+				problems = append(problems, spec.validate(sch.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("expected string")
+			return problems
+		}
+		if sch.MinLength != nil && len(str) < *sch.MinLength {
+			fail("must be at least %d characters", *sch.MinLength)
+		}
+	case "integer", "number":
+		num, ok := value.(float64)
+		if !ok {
+			fail("expected %s", sch.Type)
+			return problems
+		}
+		if sch.Type == "integer" && num != math.Trunc(num) {
+			fail("expected integer")
+		}
+		if sch.Minimum != nil && num < *sch.Minimum {
+			fail("must be >= %v", *sch.Minimum)
+		}
+		if sch.Maximum != nil && num > *sch.Maximum {
+			fail("must be <= %v", *sch.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected boolean")
+		}
+	}
+
+	if len(sch.Enum) > 0 && len(problems) == 0 {
+		allowed := false
+		for _, candidate := range sch.Enum {
+			if candidate == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			fail("must be one of %v", sch.Enum)
+		}
+	}
+	return problems
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
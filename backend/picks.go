@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func (s *Server) pickCountsRef(matchID string) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("pickCounts").Doc(matchID)
+}
+
+// Merge-set data that adds delta (1 for a new team, -1 for a replaced one) of
+// a team's picks to its match's counts
+func pickIncrements(team UserTeam, delta int) map[string]interface{} {
+	picked := map[string]interface{}{}
+	for _, playerID := range team.Players {
+		picked[playerID] = firestore.Increment(delta)
+	}
+	// An empty map would replace the stored one under MergeAll, so only
+	// non-empty maps are sent
+	data := map[string]interface{}{
+		"matchId":   team.MatchID,
+		"teams":     firestore.Increment(delta),
+		"updatedAt": time.Now().UTC(),
+	}
+	if len(picked) > 0 {
+		data["picked"] = picked
+	}
+	if team.CaptainID != "" {
+		data["captain"] = map[string]interface{}{team.CaptainID: firestore.Increment(delta)}
+	}
+	if team.ViceCaptainID != "" {
+		data["viceCaptain"] = map[string]interface{}{team.ViceCaptainID: firestore.Increment(delta)}
+	}
+	return data
+}
+
+// Save a fantasy team and count its picks in one batch. An edit passes the
+// team as it was, whose picks are taken back out.
+func (s *Server) saveUserTeam(ctx context.Context, team UserTeam, previous *UserTeam) error {
+	batch := s.firestoreClient.Batch()
+	batch.Set(s.firestoreClient.Collection("userTeams").Doc(team.TeamID), team)
+	if previous != nil {
+		batch.Set(s.pickCountsRef(previous.MatchID), pickIncrements(*previous, -1), firestore.MergeAll)
+	}
+	batch.Set(s.pickCountsRef(team.MatchID), pickIncrements(team, 1), firestore.MergeAll)
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// Stored counts for a match, empty if no team has been saved yet
+func (s *Server) loadPicks(ctx context.Context, matchID string) (*models.PickCounts, error) {
+	counts := models.NewPickCounts(matchID)
+	doc, err := s.pickCountsRef(matchID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.DataTo(counts)
+	return counts, nil
+}
+
+// Stored counts for a match read in tx, empty if no team has been saved yet
+func (s *Server) loadPicksTx(tx *firestore.Transaction, matchID string) (*models.PickCounts, error) {
+	counts := models.NewPickCounts(matchID)
+	doc, err := tx.Get(s.pickCountsRef(matchID))
+	if status.Code(err) == codes.NotFound {
+		return counts, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.DataTo(counts)
+	return counts, nil
+}
+
+// Set every squad player's pick rates from the counts
+func applyPicks(counts *models.PickCounts, sides ...[]MatchSquadPlayer) {
+	for _, players := range sides {
+		for i := range players {
+			counts.Apply(&players[i])
+		}
+	}
+}
+
+// Count picks over every fantasy team created for the match, read in tx
+func (s *Server) countPicks(tx *firestore.Transaction, matchID string) (*models.PickCounts, error) {
+	docs, err := tx.Documents(s.firestoreClient.Collection("userTeams").Where("matchId", "==", matchID)).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	counts := models.NewPickCounts(matchID)
+	for _, doc := range docs {
+		var team UserTeam
+		doc.DataTo(&team)
+		counts.Add(team)
+	}
+	return counts, nil
+}
+
+// Recount a match's picks from its teams, store the counts and write the pick
+// rates onto its squad. The teams and the stored counts are read in the same
+// transaction, so a team saved meanwhile retries the recount rather than
+// having its increments overwritten. With freeze the counts are marked final
+// unless they already are. Returns the counts and how many squad players were
+// updated.
+func (s *Server) recountPicks(ctx context.Context, matchID string, freeze bool) (*models.PickCounts, int, error) {
+	var counts *models.PickCounts
+	updated := 0
+	squadRef := s.firestoreClient.Collection("matchSquads").Doc(matchID)
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		updated = 0
+		stored, err := s.loadPicksTx(tx, matchID)
+		if err != nil {
+			return err
+		}
+		if counts, err = s.countPicks(tx, matchID); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		counts.UpdatedAt = now
+		counts.FrozenAt = stored.FrozenAt
+		if freeze && counts.FrozenAt.IsZero() {
+			counts.FrozenAt = now
+		}
+
+		squadDoc, err := tx.Get(squadRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var squad MatchSquad
+			squadDoc.DataTo(&squad)
+			for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+				for i := range players {
+					counts.Apply(&players[i])
+					updated++
+				}
+			}
+			if err := tx.Update(squadRef, []firestore.Update{
+				{Path: "team1Players", Value: squad.Team1Players},
+				{Path: "team2Players", Value: squad.Team2Players},
+			}); err != nil {
+				return err
+			}
+		}
+		return tx.Set(s.pickCountsRef(matchID), counts)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return counts, updated, nil
+}
+
+// Final counts for a match that has locked: recounted from its teams, which
+// can no longer change, and written onto the squad
+func (s *Server) freezePicks(ctx context.Context, matchID string) (*models.PickCounts, error) {
+	counts, _, err := s.recountPicks(ctx, matchID, true)
+	return counts, err
+}
+
+// Freeze the counts once a match is under way, logging failures; reading the
+// match's players after lock freezes them too
+func (s *Server) freezePicksOnStart(ctx context.Context, match *Match) {
+	if match.Status == models.MatchUpcoming {
+		return
+	}
+	counts, err := s.loadPicks(ctx, match.MatchID)
+	if err == nil && counts.FrozenAt.IsZero() {
+		_, err = s.freezePicks(ctx, match.MatchID)
+	}
+	if err != nil {
+		log.Printf("Pick counts for match %s not frozen: %v", match.MatchID, err)
+	}
+}
+
+// Admin: Recount a match's picks from its fantasy teams and write the pick
+// rates onto its squad
+func (s *Server) recountMatchPicks(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchId), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	doc.DataTo(&match)
+
+	counts, updated, err := s.recountPicks(ctx, matchId, match.IsLocked(time.Now()))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"counts":         counts,
+		"playersUpdated": updated,
+	})
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Most players a comparison takes
+const maxComparePlayers = 6
+
+// The team a player is currently registered with
+type PlayerTeamInfo struct {
+	TeamID       string   `json:"teamId"`
+	Team         TeamInfo `json:"team"`
+	LeagueID     string   `json:"leagueId"`
+	Season       string   `json:"season"`
+	JerseyNumber int      `json:"jerseyNumber"`
+	Role         string   `json:"role"`
+}
+
+// One completed match on a player page
+type PlayerMatchSummary struct {
+	MatchID             string    `json:"matchId"`
+	LeagueID            string    `json:"leagueId"`
+	StartTime           time.Time `json:"startTime"`
+	OpponentTeamID      string    `json:"opponentTeamId"`
+	Opponent            TeamInfo  `json:"opponent"`
+	Won                 bool      `json:"won"`
+	FantasyPoints       int       `json:"fantasyPoints"`
+	Credits             float64   `json:"credits"`
+	SelectionPercentage float64   `json:"selectionPercentage"`
+	CaptainPercentage   float64   `json:"captainPercentage"`
+}
+
+// Public player page data
+type PlayerProfile struct {
+	PlayerID       string                `json:"playerId"`
+	Name           string                `json:"name"`
+	ImageURL       string                `json:"imageUrl"`
+	Nationality    string                `json:"nationality"`
+	DateOfBirth    string                `json:"dateOfBirth"`
+	Age            *int                  `json:"age"` // null without a valid date of birth
+	Category       string                `json:"category"`
+	Credits        float64               `json:"credits"`
+	CurrentTeam    *PlayerTeamInfo       `json:"currentTeam"` // null while not on an active roster
+	Form           models.PlayerForm     `json:"form"`
+	Career         models.SeasonStats    `json:"career"`
+	Seasons        []models.SeasonStats  `json:"seasons"` // per league, latest first
+	Matches        []PlayerMatchSummary  `json:"matches"` // latest first
+	SelectionTrend models.SelectionTrend `json:"selectionTrend"`
+	Availability   models.Availability   `json:"availability"` // status as of now; available without a record
+}
+
+// A player's current team: of their associations in force now, the one that
+// started last
+func (s *Server) currentTeam(ctx context.Context, playerID string) (*PlayerTeamInfo, error) {
+	associations, err := s.associationsOn(ctx, "playerId", playerID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	var latest *TeamPlayer
+	for i, tp := range associations {
+		if latest == nil || tp.StartDate.After(latest.StartDate) {
+			latest = &associations[i]
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	info := &PlayerTeamInfo{
+		TeamID:       latest.TeamID,
+		LeagueID:     latest.LeagueID,
+		Season:       latest.Season,
+		JerseyNumber: latest.JerseyNumber,
+		Role:         latest.Role,
+	}
+	doc, err := s.firestoreClient.Collection("teams").Doc(latest.TeamID).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+	if err == nil {
+		var team Team
+		doc.DataTo(&team)
+		info.Team = team.Info()
+	}
+	return info, nil
+}
+
+// Names of the given leagues, by ID
+func (s *Server) leagueNames(ctx context.Context, leagueIDs []string) (map[string]string, error) {
+	names := map[string]string{}
+	var refs []*firestore.DocumentRef
+	for _, id := range leagueIDs {
+		if id != "" {
+			refs = append(refs, s.firestoreClient.Collection("leagues").Doc(id))
+		}
+	}
+	if len(refs) == 0 {
+		return names, nil
+	}
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if doc.Exists() {
+			var league League
+			doc.DataTo(&league)
+			names[doc.Ref.ID] = league.Name
+		}
+	}
+	return names, nil
+}
+
+// Build a live player's profile from their history. Archived players are not
+// found.
+func (s *Server) playerProfile(ctx context.Context, playerID string) (*PlayerProfile, error) {
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("players").Doc(playerID), "Player")
+	if err != nil {
+		return nil, err
+	}
+	var player Player
+	doc.DataTo(&player)
+	if !player.ArchivedAt.IsZero() {
+		return nil, errorf(ErrNotFound, "Player not found")
+	}
+
+	byPlayer, err := s.playerRecords(ctx, []string{playerID})
+	if err != nil {
+		return nil, err
+	}
+	records := byPlayer[playerID]
+	models.SortRecentFirst(records)
+
+	team, err := s.currentTeam(ctx, playerID)
+	if err != nil {
+		return nil, err
+	}
+	availability, err := s.availabilityOf(ctx, []string{playerID})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	status := availability[playerID]
+	status.Status = status.StatusOn(now)
+
+	profile := &PlayerProfile{
+		PlayerID:       playerID,
+		Name:           player.Name,
+		ImageURL:       player.ImageURL,
+		Nationality:    player.Nationality,
+		DateOfBirth:    player.DateOfBirth,
+		Category:       player.DefaultCategory,
+		Credits:        player.DefaultCredits,
+		CurrentTeam:    team,
+		Career:         models.CareerStats(records),
+		Seasons:        models.SeasonsOf(records),
+		Matches:        make([]PlayerMatchSummary, len(records)),
+		SelectionTrend: models.SelectionTrendOf(records),
+		Availability:   status,
+	}
+	if age, ok := models.AgeOn(player.DateOfBirth, now); ok {
+		profile.Age = &age
+	}
+	// Season points count the current team's league, else the latest played
+	season := ""
+	if len(records) > 0 {
+		season = records[0].LeagueID
+	}
+	if team != nil && team.LeagueID != "" {
+		season = team.LeagueID
+	}
+	profile.Form = models.FormBefore(records, season, now)
+
+	leagueIDs := make([]string, len(profile.Seasons))
+	for i, st := range profile.Seasons {
+		leagueIDs[i] = st.LeagueID
+	}
+	names, err := s.leagueNames(ctx, leagueIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range profile.Seasons {
+		profile.Seasons[i].LeagueName = names[profile.Seasons[i].LeagueID]
+	}
+	for i, r := range records {
+		profile.Matches[i] = PlayerMatchSummary{
+			MatchID:             r.MatchID,
+			LeagueID:            r.LeagueID,
+			StartTime:           r.StartTime,
+			OpponentTeamID:      r.OpponentTeamID,
+			Opponent:            r.Opponent,
+			Won:                 r.Won,
+			FantasyPoints:       r.FantasyPoints,
+			Credits:             r.Credits,
+			SelectionPercentage: r.SelectionPercentage,
+			CaptainPercentage:   r.CaptainPercentage,
+		}
+	}
+	return profile, nil
+}
+
+// Get a player's public profile: bio, current team, form, season and career
+// totals, points per match and selection trend (public endpoint)
+func (s *Server) getPlayerProfile(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+
+	profile, err := s.playerProfile(r.Context(), playerId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// One player in a comparison
+type PlayerComparisonEntry struct {
+	PlayerID       string                `json:"playerId"`
+	Name           string                `json:"name"`
+	ImageURL       string                `json:"imageUrl"`
+	Age            *int                  `json:"age"`
+	Category       string                `json:"category"`
+	Credits        float64               `json:"credits"`
+	CurrentTeam    *PlayerTeamInfo       `json:"currentTeam"`
+	Form           models.PlayerForm     `json:"form"`
+	Stats          models.SeasonStats    `json:"stats"` // the league compared, or the career
+	SelectionTrend models.SelectionTrend `json:"selectionTrend"`
+}
+
+type PlayerComparison struct {
+	LeagueID string                  `json:"leagueId"` // empty when careers are compared
+	Players  []PlayerComparisonEntry `json:"players"`
+	Leaders  map[string][]string     `json:"leaders"` // stat to the players with the highest value
+}
+
+// Stats a comparison names leaders for
+var comparedStats = map[string]func(models.SeasonStats) float64{
+	"fantasyPoints":     func(st models.SeasonStats) float64 { return float64(st.FantasyPoints) },
+	"pointsPerMatch":    func(st models.SeasonStats) float64 { return st.PointsPerMatch },
+	"attacks":           func(st models.SeasonStats) float64 { return float64(st.Attacks) },
+	"aces":              func(st models.SeasonStats) float64 { return float64(st.Aces) },
+	"blocks":            func(st models.SeasonStats) float64 { return float64(st.Blocks) },
+	"receptionsSuccess": func(st models.SeasonStats) float64 { return float64(st.ReceptionsSuccess) },
+	"setsPlayed":        func(st models.SeasonStats) float64 { return float64(st.SetsPlayed) },
+	"avgSelection":      func(st models.SeasonStats) float64 { return st.AvgSelection },
+}
+
+// Compare players side by side (public endpoint). ?ids= takes 2 to 6 comma
+// separated player IDs; ?leagueId= compares that league's season instead of
+// careers.
+func (s *Server) comparePlayers(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 || len(ids) > maxComparePlayers {
+		writeError(w, r, errorf(ErrInvalidRequest, "ids must name 2 to %d different players, got %d", maxComparePlayers, len(ids)))
+		return
+	}
+	leagueID := r.URL.Query().Get("leagueId")
+
+	ctx := r.Context()
+	result := PlayerComparison{LeagueID: leagueID, Players: make([]PlayerComparisonEntry, len(ids)), Leaders: map[string][]string{}}
+	for i, id := range ids {
+		profile, err := s.playerProfile(ctx, id)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		stats := profile.Career
+		if leagueID != "" {
+			stats = models.SeasonStats{LeagueID: leagueID}
+			for _, st := range profile.Seasons {
+				if st.LeagueID == leagueID {
+					stats = st
+				}
+			}
+		}
+		result.Players[i] = PlayerComparisonEntry{
+			PlayerID:       profile.PlayerID,
+			Name:           profile.Name,
+			ImageURL:       profile.ImageURL,
+			Age:            profile.Age,
+			Category:       profile.Category,
+			Credits:        profile.Credits,
+			CurrentTeam:    profile.CurrentTeam,
+			Form:           profile.Form,
+			Stats:          stats,
+			SelectionTrend: profile.SelectionTrend,
+		}
+	}
+
+	// No leader while everyone is on zero
+	for stat, value := range comparedStats {
+		best := 0.0
+		for _, p := range result.Players {
+			best = max(best, value(p.Stats))
+		}
+		if best == 0 {
+			continue
+		}
+		for _, p := range result.Players {
+			if value(p.Stats) == best {
+				result.Leaders[stat] = append(result.Leaders[stat], p.PlayerID)
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// The engine's price for one squad player, against their default and current
+// credits
+type PriceProposal struct {
+	PlayerID        string              `json:"playerId"`
+	PlayerName      string              `json:"playerName"`
+	TeamID          string              `json:"teamId"`
+	Category        string              `json:"category"`
+	DefaultCredits  float64             `json:"defaultCredits"`
+	CurrentCredits  float64             `json:"currentCredits"`
+	ProposedCredits float64             `json:"proposedCredits"`
+	DiffFromDefault float64             `json:"diffFromDefault"`
+	DiffFromCurrent float64             `json:"diffFromCurrent"`
+	Factors         models.PriceFactors `json:"factors"`
+}
+
+type PricingReview struct {
+	MatchID string          `json:"matchId"`
+	Players []PriceProposal `json:"players"`
+}
+
+// Prices to set on a match squad: proposals to accept as they are and credits
+// to set by hand, which win over an accept of the same player
+type PricingDecision struct {
+	Accept    []string           `json:"accept"`
+	AcceptAll bool               `json:"acceptAll"`
+	Overrides map[string]float64 `json:"overrides"`
+	Reason    string             `json:"reason"`
+}
+
+// Admin ID set by adminAuthMiddleware
+func adminID(r *http.Request) string {
+	id, _ := r.Context().Value("adminID").(string)
+	return id
+}
+
+func (s *Server) priceChangeRef(playerID string, at time.Time) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("priceChanges").Doc(fmt.Sprintf("price_%s_%d", playerID, at.UnixNano()))
+}
+
+// Win rate of each team in a league's standings
+func (s *Server) teamWinRates(ctx context.Context, leagueID string) (map[string]float64, error) {
+	rates := map[string]float64{}
+	if leagueID == "" {
+		return rates, nil
+	}
+	doc, err := s.standingsRef(leagueID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return rates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var standings models.Standings
+	doc.DataTo(&standings)
+	for _, row := range standings.Rows {
+		if row.Played > 0 {
+			rates[row.TeamID] = float64(row.Won) / float64(row.Played)
+		}
+	}
+	return rates, nil
+}
+
+// Price every player of a match squad from their history before the match
+func (s *Server) priceSquad(ctx context.Context, match Match, squad *MatchSquad) ([]PriceProposal, error) {
+	type entry struct {
+		player     MatchSquadPlayer
+		teamID     string
+		opponentID string
+	}
+	var entries []entry
+	var ids []string
+	for _, side := range []struct {
+		teamID, opponentID string
+		players            []MatchSquadPlayer
+	}{
+		{match.Team1ID, match.Team2ID, squad.Team1Players},
+		{match.Team2ID, match.Team1ID, squad.Team2Players},
+	} {
+		for _, player := range side.players {
+			entries = append(entries, entry{player, side.teamID, side.opponentID})
+			ids = append(ids, player.PlayerID)
+		}
+	}
+	proposals := []PriceProposal{}
+	if len(entries) == 0 {
+		return proposals, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = s.firestoreClient.Collection("players").Doc(id)
+	}
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	defaults := map[string]float64{}
+	for _, doc := range docs {
+		if doc.Exists() {
+			var player Player
+			doc.DataTo(&player)
+			defaults[doc.Ref.ID] = player.DefaultCredits
+		}
+	}
+	records, err := s.playerRecords(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	winRates, err := s.teamWinRates(ctx, match.LeagueID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Form is judged against players of the same category in the match
+	recent := map[string][]models.PlayerMatchRecord{}
+	totals, counted := map[string]float64{}, map[string]int{}
+	for _, e := range entries {
+		prior := models.RecordsBefore(records[e.player.PlayerID], match.StartTime)
+		recent[e.player.PlayerID] = prior
+		if form := models.FormBefore(prior, match.LeagueID, match.StartTime); len(prior) > 0 {
+			totals[e.player.Category] += form.Last5Average
+			counted[e.player.Category]++
+		}
+	}
+
+	for _, e := range entries {
+		categoryAverage := 0.0
+		if n := counted[e.player.Category]; n > 0 {
+			categoryAverage = totals[e.player.Category] / float64(n)
+		}
+		opponentRate, ok := winRates[e.opponentID]
+		if !ok {
+			opponentRate = 0.5
+		}
+		defaultCredits, ok := defaults[e.player.PlayerID]
+		if !ok {
+			defaultCredits = e.player.Credits
+		}
+		proposed, factors := models.ProposeCredits(models.PricingInput{
+			DefaultCredits:  defaultCredits,
+			Recent:          recent[e.player.PlayerID],
+			CategoryAverage: categoryAverage,
+			OpponentWinRate: opponentRate,
+		})
+		proposals = append(proposals, PriceProposal{
+			PlayerID:        e.player.PlayerID,
+			PlayerName:      e.player.PlayerName,
+			TeamID:          e.teamID,
+			Category:        e.player.Category,
+			DefaultCredits:  defaultCredits,
+			CurrentCredits:  e.player.Credits,
+			ProposedCredits: proposed,
+			DiffFromDefault: proposed - defaultCredits,
+			DiffFromCurrent: proposed - e.player.Credits,
+			Factors:         factors,
+		})
+	}
+	// Biggest moves first, for review
+	sort.SliceStable(proposals, func(i, j int) bool {
+		return abs(proposals[i].DiffFromCurrent) > abs(proposals[j].DiffFromCurrent)
+	})
+	return proposals, nil
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Load an open match and its squad for pricing
+func (s *Server) pricingMatch(ctx context.Context, matchID string) (Match, *MatchSquad, error) {
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchID), "Match")
+	if err != nil {
+		return Match{}, nil, err
+	}
+	var match Match
+	doc.DataTo(&match)
+	if err := checkMatchOpen(match, "change prices"); err != nil {
+		return Match{}, nil, err
+	}
+	squadDoc, err := getDocument(ctx, s.firestoreClient.Collection("matchSquads").Doc(matchID), "Match squad")
+	if err != nil {
+		return Match{}, nil, err
+	}
+	var squad MatchSquad
+	squadDoc.DataTo(&squad)
+	return match, &squad, nil
+}
+
+// Admin: Propose credits for a match squad's players from their form, with
+// the difference from their default and current credits
+func (s *Server) getSquadPricing(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	match, squad, err := s.pricingMatch(ctx, matchId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	proposals, err := s.priceSquad(ctx, match, squad)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, PricingReview{MatchID: matchId, Players: proposals})
+}
+
+// Admin: Set match squad credits by accepting proposals or overriding them
+// per player. Each change is recorded in priceChanges with the proposal and
+// the factors behind it.
+func (s *Server) applySquadPricing(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	var decision PricingDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+
+	ctx := r.Context()
+	match, squad, err := s.pricingMatch(ctx, matchId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	proposals, err := s.priceSquad(ctx, match, squad)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	byPlayer := make(map[string]PriceProposal, len(proposals))
+	for _, p := range proposals {
+		byPlayer[p.PlayerID] = p
+	}
+
+	// Credits to set and where they came from
+	type price struct {
+		credits float64
+		source  string
+	}
+	prices := map[string]price{}
+	var problems []string
+	if decision.AcceptAll {
+		for _, p := range proposals {
+			prices[p.PlayerID] = price{p.ProposedCredits, models.PriceSourceEngine}
+		}
+	}
+	for _, id := range decision.Accept {
+		p, ok := byPlayer[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("accept: player %s is not in the match squad", id))
+			continue
+		}
+		prices[id] = price{p.ProposedCredits, models.PriceSourceEngine}
+	}
+	for id, credits := range decision.Overrides {
+		if _, ok := byPlayer[id]; !ok {
+			problems = append(problems, fmt.Sprintf("overrides: player %s is not in the match squad", id))
+			continue
+		}
+		if !models.ValidCredits(credits) {
+			problems = append(problems, fmt.Sprintf("overrides: %v credits for player %s must be a multiple of %v from %v to %v", credits, id, models.CreditsStep, models.MinCredits, models.MaxCredits))
+			continue
+		}
+		prices[id] = price{credits, models.PriceSourceOverride}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		writeError(w, r, errorWithDetails(ErrInvalidRequest, problems, "Invalid pricing"))
+		return
+	}
+
+	now := time.Now().UTC()
+	changes := []models.PriceChange{}
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		changes = changes[:0]
+		prev, err := s.loadSquadTx(tx, matchId)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return errorf(ErrNotFound, "Match squad not found")
+		}
+		current := prev.Clone()
+		for _, players := range [][]MatchSquadPlayer{current.Team1Players, current.Team2Players} {
+			for i := range players {
+				p, ok := prices[players[i].PlayerID]
+				if !ok || players[i].Credits == p.credits {
+					continue
+				}
+				proposal := byPlayer[players[i].PlayerID]
+				changes = append(changes, models.PriceChange{
+					PlayerID:        players[i].PlayerID,
+					MatchID:         matchId,
+					Source:          p.source,
+					OldCredits:      players[i].Credits,
+					NewCredits:      p.credits,
+					ProposedCredits: proposal.ProposedCredits,
+					Factors:         &proposal.Factors,
+					Reason:          decision.Reason,
+					ChangedBy:       adminID(r),
+					ChangedAt:       now,
+				})
+				players[i].Credits = p.credits
+			}
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		if _, err := s.saveSquad(tx, match, prev, &current, SquadEdit{
+			Source: models.SquadSourcePricing,
+			Reason: decision.Reason,
+			By:     adminID(r),
+		}); err != nil {
+			return err
+		}
+		for i := range changes {
+			ref := s.priceChangeRef(changes[i].PlayerID, now)
+			changes[i].ChangeID = ref.ID
+			if err := tx.Create(ref, changes[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"matchId": matchId,
+		"changes": changes,
+	})
+}
+
+// Admin: Get a player's credit changes, latest first; ?matchId= narrows to one match
+func (s *Server) getPlayerPriceChanges(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+
+	ctx := r.Context()
+	q := s.firestoreClient.Collection("priceChanges").Where("playerId", "==", playerId)
+	if matchID := r.URL.Query().Get("matchId"); matchID != "" {
+		q = q.Where("matchId", "==", matchID)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	changes := make([]models.PriceChange, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&changes[i])
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ChangedAt.After(changes[j].ChangedAt) })
+
+	writeJSON(w, http.StatusOK, changes)
+}
@@ -0,0 +1,219 @@
+// Package pvl reads squad pages from the Prime Volleyball League website, e.g.
+// https://www.primevolleyballleague.com/squads/ahmedabad-defenders-69.
+package pvl
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Site the relative asset paths on squad pages resolve against
+const BaseURL = "https://www.primevolleyballleague.com"
+
+type Squad struct {
+	TeamName  string
+	PVLTeamID int // league website's team ID, from the logo path
+	LogoURL   string
+	HeadCoach string
+	Players   []SquadPlayer
+}
+
+type SquadPlayer struct {
+	PVLPlayerID  int // league website's player ID, from the photo path
+	FirstName    string
+	LastName     string
+	Tag          string // marker shown beside the name, e.g. "R" for replacement players
+	Nationality  string
+	Position     string // as published, e.g. "Middle Blocker"
+	Category     string // fantasy category the position maps to
+	JerseyNumber int
+	ImageURL     string
+}
+
+func (p SquadPlayer) Name() string {
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+// Parse a squad page. Every listed player must have a name and a position that
+// maps onto a fantasy category.
+func ParseSquadPage(r io.Reader) (*Squad, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse squad page: %w", err)
+	}
+
+	squad := &Squad{}
+	if team := findClass(doc, "waf-team"); team != nil {
+		if title := findClass(team, "content-title"); title != nil {
+			squad.TeamName = text(title)
+		}
+		if logo := findClass(team, "logo"); logo != nil {
+			squad.LogoURL = imageURL(logo)
+			squad.PVLTeamID = assetID(squad.LogoURL)
+		}
+		for _, item := range findAllClass(team, "card-content-item") {
+			if strings.EqualFold(text(findClass(item, "label")), "Head Coach") {
+				squad.HeadCoach = text(findClass(item, "text"))
+			}
+		}
+	}
+	if squad.TeamName == "" {
+		return nil, fmt.Errorf("parse squad page: no team name found")
+	}
+
+	for i, item := range findAllClass(doc, "squad-item") {
+		player := SquadPlayer{
+			FirstName:   text(findClass(item, "fname")),
+			Nationality: text(findClass(findClass(item, "squad-country"), "text")),
+			Position:    text(findClass(findClass(item, "squad-role"), "text")),
+		}
+		if lname := findClass(item, "lname"); lname != nil {
+			// The replacement marker sits inside the surname element
+			if tag := findClass(lname, "reason-tag"); tag != nil {
+				player.Tag = strings.Trim(text(tag), "()")
+				lname.RemoveChild(tag)
+			}
+			player.LastName = text(lname)
+		}
+		if thumbnail := findClass(item, "squad-thumbnail"); thumbnail != nil {
+			player.ImageURL = imageURL(thumbnail)
+			player.PVLPlayerID = assetID(player.ImageURL)
+		}
+		if number := text(findClass(findClass(item, "squad-number"), "text")); number != "" {
+			if player.JerseyNumber, err = strconv.Atoi(number); err != nil {
+				return nil, fmt.Errorf("squad item %d (%s): jersey number %q is not a number", i+1, player.Name(), number)
+			}
+		}
+
+		if player.Name() == "" {
+			return nil, fmt.Errorf("squad item %d: no player name", i+1)
+		}
+		category, ok := models.NormalizeCategory(player.Position)
+		if !ok {
+			return nil, fmt.Errorf("squad item %d (%s): unknown position %q", i+1, player.Name(), player.Position)
+		}
+		player.Category = category
+		squad.Players = append(squad.Players, player)
+	}
+	if len(squad.Players) == 0 {
+		return nil, fmt.Errorf("parse squad page: no players found for %s", squad.TeamName)
+	}
+	return squad, nil
+}
+
+// Absolute URL of the first image under n. Images are lazy-loaded, so the real
+// path is in data-src and src holds a placeholder. The cache-busting query is dropped.
+func imageURL(n *html.Node) string {
+	img := findElement(n, "img")
+	if img == nil {
+		return ""
+	}
+	raw := attr(img, "data-src")
+	if raw == "" {
+		raw = attr(img, "src")
+	}
+	ref, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return ""
+	}
+	base, _ := url.Parse(BaseURL)
+	resolved := base.ResolveReference(ref)
+	resolved.RawQuery = ""
+	return resolved.String()
+}
+
+// Numeric ID in an asset path such as /static-assets/images/players/1045.png
+func assetID(assetURL string) int {
+	name := path.Base(assetURL)
+	id, _ := strconv.Atoi(strings.TrimSuffix(name, path.Ext(name)))
+	return id
+}
+
+// HTML helpers
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// First descendant of n (or n itself) matching pred, depth first
+func find(n *html.Node, pred func(*html.Node) bool) *html.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Type == html.ElementNode && pred(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, pred); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findClass(n *html.Node, class string) *html.Node {
+	return find(n, func(n *html.Node) bool { return hasClass(n, class) })
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	return find(n, func(n *html.Node) bool { return n.Data == tag })
+}
+
+// Every element with the class, not descending into matches
+func findAllClass(n *html.Node, class string) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && hasClass(n, class) {
+			found = append(found, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// Text content of n with whitespace collapsed
+func text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
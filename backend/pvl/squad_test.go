@@ -0,0 +1,98 @@
+package pvl
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Saved copy of the Ahmedabad Defenders squad page
+const samplePage = "../../sample-squad-page.html"
+
+func parseSample(t *testing.T) *Squad {
+	t.Helper()
+	f, err := os.Open(samplePage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	squad, err := ParseSquadPage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return squad
+}
+
+func TestParseSquadPageTeam(t *testing.T) {
+	squad := parseSample(t)
+	if squad.TeamName != "Ahmedabad Defenders" {
+		t.Errorf("TeamName = %q", squad.TeamName)
+	}
+	if squad.PVLTeamID != 69 {
+		t.Errorf("PVLTeamID = %d, want 69", squad.PVLTeamID)
+	}
+	if squad.LogoURL != BaseURL+"/static-assets/images/team/69.png" {
+		t.Errorf("LogoURL = %q", squad.LogoURL)
+	}
+	if squad.HeadCoach != "Dragan Bonic" {
+		t.Errorf("HeadCoach = %q", squad.HeadCoach)
+	}
+	if len(squad.Players) != 14 {
+		t.Fatalf("got %d players, want 14", len(squad.Players))
+	}
+}
+
+func TestParseSquadPagePlayers(t *testing.T) {
+	squad := parseSample(t)
+	tests := []struct {
+		index int
+		want  SquadPlayer
+	}{
+		{0, SquadPlayer{
+			PVLPlayerID: 1045, FirstName: "Muthusamy", LastName: "Appavu", Nationality: "India",
+			Position: "Setter", Category: "setter", JerseyNumber: 16,
+			ImageURL: BaseURL + "/static-assets/images/players/1045.png",
+		}},
+		{4, SquadPlayer{
+			PVLPlayerID: 1040, FirstName: "Shon T", LastName: "John", Nationality: "India",
+			Position: "Attacker", Category: "attacker", JerseyNumber: 7,
+			ImageURL: BaseURL + "/static-assets/images/players/1040.png",
+		}},
+		{11, SquadPlayer{
+			PVLPlayerID: 6699, FirstName: "Ronald", LastName: "Martinez", Nationality: "Venezuela",
+			Position: "Middle Blocker", Category: "blocker", JerseyNumber: 14,
+			ImageURL: BaseURL + "/static-assets/images/players/6699.png",
+		}},
+		{13, SquadPlayer{
+			PVLPlayerID: 6682, FirstName: "Ayush", LastName: "Chaudhari", Tag: "R", Nationality: "India",
+			Position: "Libero", Category: "libero", JerseyNumber: 1,
+			ImageURL: BaseURL + "/static-assets/images/players/6682.png",
+		}},
+	}
+	for _, tt := range tests {
+		if got := squad.Players[tt.index]; got != tt.want {
+			t.Errorf("player %d:\n got %+v\nwant %+v", tt.index, got, tt.want)
+		}
+	}
+
+	categories := map[string]int{}
+	for _, p := range squad.Players {
+		categories[p.Category]++
+	}
+	want := map[string]int{"setter": 1, "attacker": 5, "universal": 2, "blocker": 4, "libero": 2}
+	for category, n := range want {
+		if categories[category] != n {
+			t.Errorf("%d %s players, want %d", categories[category], category, n)
+		}
+	}
+}
+
+func TestParseSquadPageRejectsUnknownPosition(t *testing.T) {
+	page := `<div class="waf-team"><h2 class="content-title">Test Team</h2></div>
+<div class="squad-item"><p class="name fname">A</p><p class="name lname">B</p>
+<div class="squad-role"><span class="text">Coach</span></div></div>`
+	_, err := ParseSquadPage(strings.NewReader(page))
+	if err == nil || !strings.Contains(err.Error(), `unknown position "Coach"`) {
+		t.Errorf("err = %v, want unknown position", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// Middleware that tags each request with an ID, echoed in the
+// X-Request-ID header and in error bodies so client reports can be matched to logs
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			// Cloud Run trace header looks like TRACE_ID/SPAN_ID;o=1
+			if trace := r.Header.Get("X-Cloud-Trace-Context"); trace != "" {
+				requestID = strings.SplitN(trace, "/", 2)[0]
+			}
+		}
+		if requestID == "" {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID)))
+	})
+}
+
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// Like writeJSON with status 200, tagged with an ETag of the body so polling
+// clients that send it back in If-None-Match get an empty 304 while nothing changed
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if candidate = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(candidate), "W/")); candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// Write err as the uniform JSON error envelope. Internal errors are logged with the
+// request ID and replaced by a generic message.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, body := classifyError(err)
+	body.RequestID = requestID(r)
+	if code >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v", body.RequestID, r.Method, r.URL.Path, err)
+	}
+	writeJSON(w, code, body)
+}
+
+// Fetch a document, turning a missing document into ErrNotFound named after what.
+func getDocument(ctx context.Context, ref *firestore.DocumentRef, what string) (*firestore.DocumentSnapshot, error) {
+	doc, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound || (err == nil && !doc.Exists()) {
+		return nil, errorf(ErrNotFound, "%s not found", what)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
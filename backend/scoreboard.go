@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+type RallyRequest struct {
+	TeamID string `json:"teamId"`
+}
+
+// Full scoreboard as entered by the admin, to correct a live score or record a
+// result. Set winners, sets won and the match winner are derived.
+type ScoreRequest struct {
+	SetScores     []SetScore `json:"setScores"`
+	ServingTeamID string     `json:"servingTeamId"`
+}
+
+type ScoreUpdateResult struct {
+	Match            Match `json:"match"`
+	UserTeamsUpdated int   `json:"userTeamsUpdated"`
+}
+
+type MatchCenterTeam struct {
+	TeamID        string             `json:"teamId"`
+	Team          TeamInfo           `json:"team"`
+	SetsWon       int                `json:"setsWon"`
+	FantasyPoints int                `json:"fantasyPoints"` // sum of the squad's player points
+	Players       []MatchSquadPlayer `json:"players"`       // highest scorers first
+}
+
+// Scoreboard and both squads' live fantasy points
+type MatchCenter struct {
+	Match          Match           `json:"match"`
+	Team1          MatchCenterTeam `json:"team1"`
+	Team2          MatchCenterTeam `json:"team2"`
+	SquadUpdatedAt time.Time       `json:"squadUpdatedAt"`
+}
+
+// Write only the scoreboard fields, leaving the fixture as the admin set it
+func scoreboardUpdates(match *Match) []firestore.Update {
+	return []firestore.Update{
+		{Path: "setScores", Value: match.SetScores},
+		{Path: "team1SetsWon", Value: match.Team1SetsWon},
+		{Path: "team2SetsWon", Value: match.Team2SetsWon},
+		{Path: "winnerTeamId", Value: match.WinnerTeamID},
+		{Path: "servingTeamId", Value: match.ServingTeamID},
+		{Path: "status", Value: match.Status},
+		{Path: "startedAt", Value: match.StartedAt},
+		{Path: "completedAt", Value: match.CompletedAt},
+		{Path: "durationMinutes", Value: match.DurationMinutes},
+	}
+}
+
+func (s *Server) saveScoreboard(ctx context.Context, match *Match) error {
+	_, err := s.firestoreClient.Collection("matches").Doc(match.MatchID).Update(ctx, scoreboardUpdates(match))
+	return err
+}
+
+// Number of sets with a winner
+func finishedSets(match *Match) int {
+	finished := 0
+	for _, set := range match.SetScores {
+		if set.WinnerTeamID != "" {
+			finished++
+		}
+	}
+	return finished
+}
+
+// Admin: Award one rally. Starts the match and the next set as needed; the
+// rally winner serves next. Set results change player points, so the squad is
+// rescored whenever a set is won. Matches scored through the event log take
+// rallies as rally_won events instead.
+func (s *Server) scoreRally(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	var req RallyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+
+	ctx := r.Context()
+	ref := s.firestoreClient.Collection("matches").Doc(matchId)
+	var match Match
+	setsBefore := 0
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errorf(ErrNotFound, "Match not found")
+		}
+		if err != nil {
+			return err
+		}
+		match = Match{}
+		doc.DataTo(&match)
+		setsBefore = finishedSets(&match)
+		logged, err := tx.Documents(s.anyMatchEvent(matchId)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(logged) > 0 {
+			return errorf(ErrConflict, "Match %s is scored through its event log; record the rally as a %s event", matchId, models.EventRallyWon)
+		}
+		if req.TeamID == "" || (req.TeamID != match.Team1ID && req.TeamID != match.Team2ID) {
+			return errorf(ErrInvalidRequest, "teamId must be one of the match's teams")
+		}
+		if err := match.ScoreRally(req.TeamID, time.Now().UTC()); err != nil {
+			return errorf(ErrConflict, "%v", err)
+		}
+		return tx.Update(ref, scoreboardUpdates(&match))
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	s.scoreboardSaved(ctx, &match, false)
+
+	result := ScoreUpdateResult{Match: match}
+	if finishedSets(&match) != setsBefore {
+		if result.UserTeamsUpdated, err = s.rescoreMatch(ctx, &match); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Admin: Replace a match's scoreboard, to correct the live score or enter a
+// final result, and rescore the squad. Matches scored through the event log
+// are corrected with undo events instead.
+func (s *Server) updateMatchScore(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	var req ScoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchId), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	doc.DataTo(&match)
+	wasCompleted := match.Status == models.MatchCompleted
+
+	logged, err := s.anyMatchEvent(matchId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(logged) > 0 {
+		writeError(w, r, errorf(ErrConflict, "Match %s is scored through its event log; correct it with undo events", matchId))
+		return
+	}
+
+	if req.ServingTeamID != "" && req.ServingTeamID != match.Team1ID && req.ServingTeamID != match.Team2ID {
+		writeError(w, r, errorf(ErrInvalidRequest, "servingTeamId must be one of the match's teams"))
+		return
+	}
+	match.SetScores = req.SetScores
+	if match.SetScores == nil {
+		match.SetScores = []SetScore{}
+	}
+	match.ServingTeamID = req.ServingTeamID
+	if err := match.Settle(time.Now().UTC()); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid score: %v", err))
+		return
+	}
+	if err := s.saveScoreboard(ctx, &match); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.scoreboardSaved(ctx, &match, wasCompleted)
+
+	result := ScoreUpdateResult{Match: match}
+	if result.UserTeamsUpdated, err = s.rescoreMatch(ctx, &match); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Get the match center: scoreboard plus both squads' live fantasy points (public endpoint)
+func (s *Server) getMatchCenter(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchId), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	doc.DataTo(&match)
+
+	center := MatchCenter{
+		Match: match,
+		Team1: MatchCenterTeam{TeamID: match.Team1ID, Team: match.Team1, SetsWon: match.Team1SetsWon, Players: []MatchSquadPlayer{}},
+		Team2: MatchCenterTeam{TeamID: match.Team2ID, Team: match.Team2, SetsWon: match.Team2SetsWon, Players: []MatchSquadPlayer{}},
+	}
+
+	// Squads are announced shortly before the match; until then the teams are empty
+	squadDoc, err := s.firestoreClient.Collection("matchSquads").Doc(matchId).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		writeError(w, r, err)
+		return
+	}
+	if err == nil {
+		var squad MatchSquad
+		squadDoc.DataTo(&squad)
+		center.SquadUpdatedAt = squad.UpdatedAt
+		for _, side := range []struct {
+			team    *MatchCenterTeam
+			players []MatchSquadPlayer
+		}{{&center.Team1, squad.Team1Players}, {&center.Team2, squad.Team2Players}} {
+			if side.players != nil {
+				side.team.Players = side.players
+			}
+			for _, player := range side.players {
+				side.team.FantasyPoints += player.LiveStats.TotalPoints
+			}
+			sort.SliceStable(side.team.Players, func(i, j int) bool {
+				return side.team.Players[i].LiveStats.TotalPoints > side.team.Players[j].LiveStats.TotalPoints
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, center)
+}
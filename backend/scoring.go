@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Fantasy multipliers for the captain and vice-captain, as shown in the points guide
+const (
+	captainMultiplier     = 2.0
+	viceCaptainMultiplier = 1.5
+)
+
+// Score every player in a squad from their live stats and the match's finished
+// sets: a set a player started counts as won or lost with their team
+func scoreMatchSquad(squad *MatchSquad, sets []SetScore) {
+	for _, side := range []struct {
+		teamID  string
+		players []MatchSquadPlayer
+	}{{squad.Team1ID, squad.Team1Players}, {squad.Team2ID, squad.Team2Players}} {
+		for i := range side.players {
+			stats := &side.players[i].LiveStats
+			stats.SetsWon, stats.SetsLost = []int{}, []int{}
+			for _, set := range stats.SetsAsStarter {
+				if set < 1 || set > len(sets) || sets[set-1].WinnerTeamID == "" {
+					continue
+				}
+				if sets[set-1].WinnerTeamID == side.teamID {
+					stats.SetsWon = append(stats.SetsWon, set)
+				} else {
+					stats.SetsLost = append(stats.SetsLost, set)
+				}
+			}
+			stats.TotalPoints = calculateVolleyballPoints(*stats)
+		}
+	}
+}
+
+// Rescore a match's squad against its current set results and update user
+// team points. Returns the number of user teams updated; 0 if the match has no
+// squad yet.
+func (s *Server) rescoreMatch(ctx context.Context, match *Match) (int, error) {
+	squad, err := s.updateLiveStats(ctx, match.MatchID, func(tx *firestore.Transaction, squad *MatchSquad) error {
+		scoreMatchSquad(squad, match.SetScores)
+		return nil
+	})
+	if err != nil || squad == nil {
+		return 0, err
+	}
+	return s.recomputeMatchPoints(ctx, match.MatchID, squad)
+}
+
+// Change a match squad's live stats in a transaction: apply runs on the squad
+// as stored and only its player lists are written back, so the version, lock
+// and pick rates other writers keep on the squad are left alone. Returns the
+// squad as written, or nil if the match has no squad.
+func (s *Server) updateLiveStats(ctx context.Context, matchID string, apply func(tx *firestore.Transaction, squad *MatchSquad) error) (*MatchSquad, error) {
+	var written *MatchSquad
+	err := s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		written = nil
+		squad, err := s.loadSquadTx(tx, matchID)
+		if err != nil || squad == nil {
+			return err
+		}
+		if err := apply(tx, squad); err != nil {
+			return err
+		}
+		squad.UpdatedAt = time.Now().UTC()
+		if err := tx.Update(s.matchSquadRef(matchID), []firestore.Update{
+			{Path: "team1Players", Value: squad.Team1Players},
+			{Path: "team2Players", Value: squad.Team2Players},
+			{Path: "updatedAt", Value: squad.UpdatedAt},
+		}); err != nil {
+			return err
+		}
+		written = squad
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// Carry each player's live stats over from the stored squad, which is nil
+// while the match has none; players new to the squad start without any. Live
+// stats come from scoring, never from the client.
+func keepLiveStats(prev *MatchSquad, sides ...[]MatchSquadPlayer) {
+	stored := map[string]PlayerLiveStats{}
+	if prev != nil {
+		for _, players := range [][]MatchSquadPlayer{prev.Team1Players, prev.Team2Players} {
+			for _, p := range players {
+				stored[p.PlayerID] = p.LiveStats
+			}
+		}
+	}
+	for _, players := range sides {
+		for i := range players {
+			if stats, ok := stored[players[i].PlayerID]; ok {
+				players[i].LiveStats = stats
+			} else {
+				players[i].LiveStats = *emptyLiveStats()
+			}
+		}
+	}
+}
+
+// Fantasy total of a user team given each player's points
+func userTeamPoints(team UserTeam, playerPoints map[string]int) int {
+	total := 0.0
+	for _, playerID := range team.Players {
+		points := float64(playerPoints[playerID])
+		switch playerID {
+		case team.CaptainID:
+			points *= captainMultiplier
+		case team.ViceCaptainID:
+			points *= viceCaptainMultiplier
+		}
+		total += points
+	}
+	return int(math.Round(total))
+}
+
+// Bring the totals of every user team and contest entry for a match in line with
+// the squad's player points. Returns the number of user teams updated.
+func (s *Server) recomputeMatchPoints(ctx context.Context, matchID string, squad *MatchSquad) (int, error) {
+	playerPoints := map[string]int{}
+	for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+		for _, player := range players {
+			playerPoints[player.PlayerID] = player.LiveStats.TotalPoints
+		}
+	}
+
+	teamDocs, err := s.firestoreClient.Collection("userTeams").Where("matchId", "==", matchID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	entryDocs, err := s.firestoreClient.Collection("contestTeams").Where("matchId", "==", matchID).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	batch := s.firestoreClient.Batch()
+	pending := 0
+	write := func(ref *firestore.DocumentRef, points int) error {
+		batch.Update(ref, []firestore.Update{{Path: "totalPoints", Value: points}})
+		pending++
+		if pending == maxBatchWrites {
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch = s.firestoreClient.Batch()
+			pending = 0
+		}
+		return nil
+	}
+
+	teamTotals := map[string]int{}
+	for _, doc := range teamDocs {
+		var team UserTeam
+		doc.DataTo(&team)
+		total := userTeamPoints(team, playerPoints)
+		teamTotals[doc.Ref.ID] = total
+		if team.TotalPoints == total {
+			continue
+		}
+		if err := write(doc.Ref, total); err != nil {
+			return 0, err
+		}
+	}
+	for _, doc := range entryDocs {
+		var entry ContestTeam
+		doc.DataTo(&entry)
+		total, ok := teamTotals[entry.TeamID]
+		if !ok || entry.TotalPoints == total {
+			continue
+		}
+		if err := write(doc.Ref, total); err != nil {
+			return 0, err
+		}
+	}
+	if pending > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return 0, err
+		}
+	}
+	s.syncPlayerHistory(ctx, matchID, squad)
+	return len(teamDocs), nil
+}
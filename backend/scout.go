@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/dvw"
+)
+
+// Largest scout file accepted; real .dvw files are a few hundred kilobytes
+const maxScoutFileBytes = 8 << 20
+
+type ScoutPlayerResult struct {
+	PlayerID     string          `json:"playerId,omitempty"`
+	PlayerName   string          `json:"playerName"`
+	TeamID       string          `json:"teamId"`
+	JerseyNumber int             `json:"jerseyNumber"`
+	LiveStats    PlayerLiveStats `json:"liveStats"`
+	Reason       string          `json:"reason,omitempty"` // why an unmatched player was skipped
+}
+
+type ScoutImportResult struct {
+	MatchID          string              `json:"matchId"`
+	DryRun           bool                `json:"dryRun"`
+	HomeTeamID       string              `json:"homeTeamId"`
+	VisitingTeamID   string              `json:"visitingTeamId"`
+	SetsPlayed       int                 `json:"setsPlayed"`
+	Applied          []ScoutPlayerResult `json:"applied"`
+	Unmatched        []ScoutPlayerResult `json:"unmatched"`
+	UserTeamsUpdated int                 `json:"userTeamsUpdated"`
+}
+
+// Admin: Apply a DataVolley scout file to a match squad's live stats.
+// The file is sent as multipart field "file" or as the raw request body. Scout
+// players are matched to squad players by jersey number through the team's
+// active teamPlayers. Pass ?dryRun=true to see the result without writing, and
+// ?homeTeamId= when the scout file's team names don't match ours. A match
+// scored through its event log is refused, as the next event would fold the
+// scout's stats away.
+func (s *Server) uploadMatchScout(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	data, err := readScoutUpload(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	scout, err := dvw.Parse(bytes.NewReader(data))
+	if err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid scout file: %v", err))
+		return
+	}
+
+	ctx := r.Context()
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(matchId), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	matchDoc.DataTo(&match)
+
+	squadDoc, err := getDocument(ctx, s.firestoreClient.Collection("matchSquads").Doc(matchId), "Match squad")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var squad MatchSquad
+	squadDoc.DataTo(&squad)
+
+	logged, err := s.anyMatchEvent(matchId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(logged) > 0 {
+		writeError(w, r, errorf(ErrConflict, "Match %s is scored through its event log; record its stats as events", matchId))
+		return
+	}
+
+	homeTeamID, err := scoutHomeTeam(scout, match, r.URL.Query().Get("homeTeamId"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	sideTeams := map[dvw.Side]string{dvw.Home: match.Team1ID, dvw.Visiting: match.Team2ID}
+	if homeTeamID == match.Team2ID {
+		sideTeams = map[dvw.Side]string{dvw.Home: match.Team2ID, dvw.Visiting: match.Team1ID}
+	}
+
+	result := ScoutImportResult{
+		MatchID:        matchId,
+		DryRun:         dryRun,
+		HomeTeamID:     sideTeams[dvw.Home],
+		VisitingTeamID: sideTeams[dvw.Visiting],
+		SetsPlayed:     scout.SetsCount,
+		Applied:        []ScoutPlayerResult{},
+		Unmatched:      []ScoutPlayerResult{},
+	}
+
+	jerseys := map[string]map[int][]string{}
+	for _, teamID := range sideTeams {
+		if jerseys[teamID], err = s.activeJerseyNumbers(ctx, teamID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	for _, player := range scout.Players {
+		teamID := sideTeams[player.Side]
+		stats := scout.LiveStats(player)
+		stats.TotalPoints = calculateVolleyballPoints(stats)
+		entry := ScoutPlayerResult{
+			PlayerName:   player.Name(),
+			TeamID:       teamID,
+			JerseyNumber: player.JerseyNumber,
+			LiveStats:    stats,
+		}
+
+		playerIDs := jerseys[teamID][player.JerseyNumber]
+		if len(playerIDs) != 1 {
+			entry.Reason = "no active team player with this jersey number"
+			if len(playerIDs) > 1 {
+				entry.Reason = "several active team players share this jersey number"
+			}
+			result.Unmatched = append(result.Unmatched, entry)
+			continue
+		}
+		entry.PlayerID = playerIDs[0]
+
+		squadPlayer := findSquadPlayer(&squad, teamID, entry.PlayerID)
+		if squadPlayer == nil {
+			entry.Reason = "player is not in the match squad"
+			result.Unmatched = append(result.Unmatched, entry)
+			continue
+		}
+		squadPlayer.LiveStats = stats
+		result.Applied = append(result.Applied, entry)
+	}
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	applied := map[string]PlayerLiveStats{}
+	for _, entry := range result.Applied {
+		applied[entry.PlayerID] = entry.LiveStats
+	}
+	written, err := s.updateLiveStats(ctx, matchId, func(tx *firestore.Transaction, squad *MatchSquad) error {
+		for _, players := range [][]MatchSquadPlayer{squad.Team1Players, squad.Team2Players} {
+			for i := range players {
+				if stats, ok := applied[players[i].PlayerID]; ok {
+					players[i].LiveStats = stats
+				}
+			}
+		}
+		scoreMatchSquad(squad, match.SetScores)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if written == nil {
+		writeError(w, r, errorf(ErrNotFound, "Match squad not found"))
+		return
+	}
+	if result.UserTeamsUpdated, err = s.recomputeMatchPoints(ctx, matchId, written); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func readScoutUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxScoutFileBytes)
+	var source io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errorf(ErrInvalidRequest, "Missing scout file: send it in the \"file\" form field")
+		}
+		defer file.Close()
+		source = file
+	}
+	data, err := io.ReadAll(source)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, errorf(ErrBodyTooLarge, "Scout file exceeds %d bytes", maxScoutFileBytes)
+		}
+		return nil, errorf(ErrInvalidRequest, "Failed to read scout file")
+	}
+	if len(data) == 0 {
+		return nil, errorf(ErrInvalidRequest, "Scout file is empty")
+	}
+	return data, nil
+}
+
+// Which of the match's teams the scout file has as home: the explicit override,
+// else the team whose code or name matches the file's home team
+func scoutHomeTeam(scout *dvw.File, match Match, override string) (string, error) {
+	if override != "" {
+		if override != match.Team1ID && override != match.Team2ID {
+			return "", errorf(ErrInvalidRequest, "homeTeamId %s does not play in this match", override)
+		}
+		return override, nil
+	}
+	sameTeam := func(scoutTeam dvw.Team, ours TeamInfo) bool {
+		return (ours.Code != "" && strings.EqualFold(scoutTeam.Code, ours.Code)) ||
+			(ours.Name != "" && strings.EqualFold(scoutTeam.Name, ours.Name))
+	}
+	switch {
+	case sameTeam(scout.Home, match.Team1) || sameTeam(scout.Visiting, match.Team2):
+		return match.Team1ID, nil
+	case sameTeam(scout.Home, match.Team2) || sameTeam(scout.Visiting, match.Team1):
+		return match.Team2ID, nil
+	}
+	return "", errorf(ErrInvalidRequest, "Cannot tell which team %q (%s) is; pass homeTeamId", scout.Home.Name, scout.Home.Code)
+}
+
+// Player IDs by jersey number among a team's associations in force now
+func (s *Server) activeJerseyNumbers(ctx context.Context, teamID string) (map[int][]string, error) {
+	associations, err := s.associationsOn(ctx, "teamId", teamID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	byNumber := map[int][]string{}
+	for _, association := range associations {
+		byNumber[association.JerseyNumber] = append(byNumber[association.JerseyNumber], association.PlayerID)
+	}
+	return byNumber, nil
+}
+
+// Pointer to a player in the squad list for the given team, or nil
+func findSquadPlayer(squad *MatchSquad, teamID, playerID string) *MatchSquadPlayer {
+	players := squad.Team1Players
+	if teamID == squad.Team2ID {
+		players = squad.Team2Players
+	}
+	for i := range players {
+		if players[i].PlayerID == playerID {
+			return &players[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Results a search returns by default and at most
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Least score a search result needs
+const minSearchScore = 0.5
+
+// In-process copy of players and team-player associations for search. It is
+// filled and kept current by snapshot listeners, so writes from any handler
+// or from the import command show up within moments.
+type playerIndex struct {
+	mu           sync.RWMutex
+	players      map[string]indexedPlayer
+	associations map[string]TeamPlayer // by association ID
+	loaded       map[string]bool       // collections whose first snapshot has arrived
+}
+
+type indexedPlayer struct {
+	player Player
+	name   models.SearchName
+}
+
+func newPlayerIndex() *playerIndex {
+	return &playerIndex{
+		players:      map[string]indexedPlayer{},
+		associations: map[string]TeamPlayer{},
+		loaded:       map[string]bool{},
+	}
+}
+
+func (ix *playerIndex) ready() bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.loaded["players"] && ix.loaded["teamPlayers"]
+}
+
+// Apply one snapshot of a collection. The first snapshot after (re)connecting
+// lists every document, so it replaces what was held and drops documents
+// deleted while disconnected.
+func (ix *playerIndex) apply(collection string, snap *firestore.QuerySnapshot, first bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if first {
+		switch collection {
+		case "players":
+			ix.players = map[string]indexedPlayer{}
+		case "teamPlayers":
+			ix.associations = map[string]TeamPlayer{}
+		}
+	}
+	for _, change := range snap.Changes {
+		id := change.Doc.Ref.ID
+		switch collection {
+		case "players":
+			if change.Kind == firestore.DocumentRemoved {
+				delete(ix.players, id)
+				continue
+			}
+			var player Player
+			change.Doc.DataTo(&player)
+			player.PlayerID = id
+			ix.players[id] = indexedPlayer{player: player, name: models.NewSearchName(player.Name)}
+		case "teamPlayers":
+			if change.Kind == firestore.DocumentRemoved {
+				delete(ix.associations, id)
+				continue
+			}
+			var association TeamPlayer
+			change.Doc.DataTo(&association)
+			ix.associations[id] = association
+		}
+	}
+	ix.loaded[collection] = true
+}
+
+// Listen to a collection until ctx is cancelled, reconnecting with backoff
+func (s *Server) watchPlayerIndex(ctx context.Context, collection string) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		it := s.firestoreClient.Collection(collection).Snapshots(ctx)
+		first := true
+		for {
+			snap, err := it.Next()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Player index listener on %s: %v", collection, err)
+				}
+				break
+			}
+			s.players.apply(collection, snap, first)
+			first = false
+			backoff = time.Second
+		}
+		it.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			backoff = min(backoff*2, time.Minute)
+		}
+	}
+}
+
+// Start the listeners that keep the search index current
+func (s *Server) startPlayerIndex() {
+	for _, collection := range []string{"players", "teamPlayers"} {
+		s.runBackground("player index: "+collection, func(ctx context.Context) {
+			s.watchPlayerIndex(ctx, collection)
+		})
+	}
+}
+
+type PlayerSearchResult struct {
+	Player
+	TeamIDs []string `json:"teamIds"` // teams with an active association
+	Score   float64  `json:"score"`
+	Match   string   `json:"match"` // exact, prefix, phonetic or fuzzy; empty without a query
+}
+
+type playerSearch struct {
+	query           models.SearchName
+	teamID          string
+	leagueID        string
+	category        string
+	active          *bool // on an active roster
+	includeArchived bool
+	limit           int
+}
+
+// Search the index, best matches first. Without a query every player that
+// passes the filters matches, in name order.
+func (ix *playerIndex) search(q playerSearch) []PlayerSearchResult {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	type roster struct {
+		teamIDs   []string
+		leagueIDs []string
+	}
+	rosters := map[string]*roster{}
+	now := time.Now().UTC()
+	for _, a := range ix.associations {
+		if !a.ValidOn(now) {
+			continue
+		}
+		r, ok := rosters[a.PlayerID]
+		if !ok {
+			r = &roster{}
+			rosters[a.PlayerID] = r
+		}
+		r.teamIDs = append(r.teamIDs, a.TeamID)
+		r.leagueIDs = append(r.leagueIDs, a.LeagueID)
+	}
+
+	results := []PlayerSearchResult{}
+	for id, p := range ix.players {
+		if !q.includeArchived && !p.player.ArchivedAt.IsZero() {
+			continue
+		}
+		if q.category != "" && p.player.DefaultCategory != q.category {
+			continue
+		}
+		r := rosters[id]
+		if r == nil {
+			r = &roster{}
+		}
+		if q.active != nil && *q.active != (len(r.teamIDs) > 0) {
+			continue
+		}
+		if q.teamID != "" && !slices.Contains(r.teamIDs, q.teamID) {
+			continue
+		}
+		if q.leagueID != "" && !slices.Contains(r.leagueIDs, q.leagueID) {
+			continue
+		}
+
+		result := PlayerSearchResult{Player: p.player, TeamIDs: r.teamIDs, Score: 1}
+		if len(q.query.Tokens) > 0 {
+			result.Score, result.Match = p.name.Match(q.query)
+			if result.Score < minSearchScore {
+				continue
+			}
+		}
+		if result.TeamIDs == nil {
+			result.TeamIDs = []string{}
+		}
+		sort.Strings(result.TeamIDs)
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+	if len(results) > q.limit {
+		results = results[:q.limit]
+	}
+	return results
+}
+
+// Search players by name with prefix, phonetic and fuzzy matching, filtered by
+// teamId, leagueId, category and active (on an active roster) (public
+// endpoint). Served from the in-process index. Archived players are only
+// included for admins, through /api/admin/players/search.
+func (s *Server) searchPlayers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := playerSearch{
+		query:    models.NewSearchName(query.Get("q")),
+		teamID:   query.Get("teamId"),
+		leagueID: query.Get("leagueId"),
+		category: query.Get("category"),
+		limit:    defaultSearchLimit,
+	}
+	if v := query.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "active must be true or false"))
+			return
+		}
+		search.active = &active
+	}
+	if v := query.Get("includeArchived"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, r, errorf(ErrInvalidRequest, "includeArchived must be true or false"))
+			return
+		}
+		if include && adminID(r) == "" {
+			writeError(w, r, errorf(ErrForbidden, "includeArchived requires admin access; use /api/admin/players/search"))
+			return
+		}
+		search.includeArchived = include
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			writeError(w, r, errorf(ErrInvalidRequest, "limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+		search.limit = limit
+	}
+
+	if !s.players.ready() {
+		writeError(w, r, errorf(ErrUnavailable, "Player search index is still loading"))
+		return
+	}
+	results := s.players.search(search)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query.Get("q"),
+		"results": results,
+	})
+}
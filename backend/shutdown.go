@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Start a background worker that is stopped and waited for on shutdown.
+// The worker must return promptly once ctx is cancelled.
+func (s *Server) runBackground(name string, worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.bgCtx)
+		log.Printf("Background worker %s stopped", name)
+	}()
+}
+
+// Drain in-flight requests, stop background workers and close the Firestore client.
+// Everything must finish within timeout so the process exits before the platform kills it.
+func (s *Server) shutdown(httpServer *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Stop accepting new connections and wait for active requests to complete
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+
+	// Signal workers and wait for them, bounded by the same deadline
+	s.stopBackground()
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Background workers did not stop before deadline")
+	}
+
+	if err := s.firestoreClient.Close(); err != nil {
+		log.Printf("Firestore client close: %v", err)
+	}
+	log.Printf("Shutdown complete")
+}
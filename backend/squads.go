@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func squadID(matchID, teamID string) string {
+	return fmt.Sprintf("%s_%s", matchID, teamID)
+}
+
+// Team-player associations of a team valid on the given date, by player ID
+func (s *Server) teamRoster(ctx context.Context, teamID string, on time.Time) (map[string]TeamPlayer, error) {
+	docs, err := s.firestoreClient.Collection("teamPlayers").Where("teamId", "==", teamID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	roster := make(map[string]TeamPlayer, len(docs))
+	for _, doc := range docs {
+		var tp TeamPlayer
+		doc.DataTo(&tp)
+		if tp.ValidOn(on) {
+			roster[tp.PlayerID] = tp
+		}
+	}
+	return roster, nil
+}
+
+// Player IDs of a roster in a stable order
+func rosterPlayerIDs(roster map[string]TeamPlayer) []string {
+	ids := make([]string, 0, len(roster))
+	for id := range roster {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// A team's announced lineup for a match, or nil if it has not announced one
+func (s *Server) announcedLineup(ctx context.Context, matchID, teamID string) (*Squad, error) {
+	doc, err := s.firestoreClient.Collection("squads").Doc(squadID(matchID, teamID)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var squad Squad
+	doc.DataTo(&squad)
+	return &squad, nil
+}
+
+// Match squad entries for the given players of a roster, in the order given.
+// Players missing from the players collection or archived are left out.
+func (s *Server) squadPlayers(ctx context.Context, roster map[string]TeamPlayer, playerIDs []string) ([]MatchSquadPlayer, error) {
+	players := []MatchSquadPlayer{}
+	if len(playerIDs) == 0 {
+		return players, nil
+	}
+	refs := make([]*firestore.DocumentRef, len(playerIDs))
+	for i, id := range playerIDs {
+		refs[i] = s.firestoreClient.Collection("players").Doc(id)
+	}
+	docs, err := s.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var player Player
+		doc.DataTo(&player)
+		if !player.ArchivedAt.IsZero() {
+			continue
+		}
+		players = append(players, MatchSquadPlayer{
+			PlayerID:       doc.Ref.ID,
+			PlayerName:     player.Name,
+			PlayerImageURL: player.ImageURL,
+			Category:       player.DefaultCategory,
+			Credits:        player.DefaultCredits,
+			JerseyNumber:   roster[doc.Ref.ID].JerseyNumber,
+			LiveStats:      *emptyLiveStats(),
+		})
+	}
+	return players, nil
+}
+
+// Admin: Announce a team's lineup for a match. The lineup is validated against
+// the team's players on the match date and their availability, marks the starters and libero in the
+// match squad (adding lineup players it lacks) and posts an announcement so
+// users can adjust their teams before the match locks. Announcing again
+// revises it.
+func (s *Server) createSquad(w http.ResponseWriter, r *http.Request) {
+	var squad Squad
+	if err := json.NewDecoder(r.Body).Decode(&squad); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+
+	if squad.MatchID == "" {
+		writeError(w, r, errorf(ErrInvalidRequest, "matchId is required"))
+		return
+	}
+
+	ctx := r.Context()
+	matchDoc, err := getDocument(ctx, s.firestoreClient.Collection("matches").Doc(squad.MatchID), "Match")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var match Match
+	matchDoc.DataTo(&match)
+	if err := checkMatchOpen(match, "announce lineups"); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if squad.TeamID == "" || (squad.TeamID != match.Team1ID && squad.TeamID != match.Team2ID) {
+		writeError(w, r, errorf(ErrInvalidRequest, "Team %q does not play match %s", squad.TeamID, squad.MatchID))
+		return
+	}
+
+	roster, err := s.teamRoster(ctx, squad.TeamID, match.StartTime)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	onRoster := make(map[string]bool, len(roster))
+	for id := range roster {
+		onRoster[id] = true
+	}
+	problems := squad.Problems(onRoster)
+	availability, err := s.availabilityOf(ctx, squad.Players())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	problems = append(problems, unavailableProblems(squad.Players(), availability, match)...)
+	if len(problems) > 0 {
+		writeError(w, r, errorWithDetails(ErrTeamInvalid, problems, "Invalid lineup"))
+		return
+	}
+	lineupPlayers, err := s.squadPlayers(ctx, roster, squad.Players())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := s.applyForm(ctx, match, lineupPlayers); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	for i := range lineupPlayers {
+		lineupPlayers[i].Availability = availability[lineupPlayers[i].PlayerID].ForMatch(match.StartTime)
+	}
+
+	now := time.Now().UTC()
+	squad.SquadID = squadID(squad.MatchID, squad.TeamID)
+	squad.PlayerIDs = squad.Players()
+	squad.AnnouncedAt = now
+	announcement := models.Announcement{
+		AnnouncementID: fmt.Sprintf("lineup_%s_%d", squad.SquadID, now.UnixNano()),
+		Type:           models.AnnouncementLineup,
+		MatchID:        squad.MatchID,
+		TeamID:         squad.TeamID,
+		Starting6:      squad.Starting6,
+		Libero:         squad.Libero,
+		LocksAt:        match.StartTime,
+		CreatedAt:      now,
+	}
+
+	squadRef := s.firestoreClient.Collection("squads").Doc(squad.SquadID)
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		squad.CreatedAt = now
+		revised := false
+		if doc, err := tx.Get(squadRef); err == nil {
+			var previous Squad
+			doc.DataTo(&previous)
+			squad.CreatedAt = previous.CreatedAt
+			revised = true
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		matchSquad := MatchSquad{
+			MatchSquadID: fmt.Sprintf("squad_%s", squad.MatchID),
+			MatchID:      squad.MatchID,
+			Team1ID:      match.Team1ID,
+			Team2ID:      match.Team2ID,
+			Team1Players: []MatchSquadPlayer{},
+			Team2Players: []MatchSquadPlayer{},
+			CreatedAt:    now,
+		}
+		prev, err := s.loadSquadTx(tx, squad.MatchID)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			matchSquad = prev.Clone()
+		}
+
+		side, lineupAt := &matchSquad.Team1Players, &matchSquad.Team1LineupAt
+		if squad.TeamID == match.Team2ID {
+			side, lineupAt = &matchSquad.Team2Players, &matchSquad.Team2LineupAt
+		}
+		present := map[string]bool{}
+		for _, p := range *side {
+			present[p.PlayerID] = true
+		}
+		for _, p := range lineupPlayers {
+			if !present[p.PlayerID] {
+				*side = append(*side, p)
+			}
+		}
+		models.ApplyLineup(*side, &squad)
+		*lineupAt = now
+		matchSquad.UpdatedAt = now
+
+		team := match.Team1
+		if squad.TeamID == match.Team2ID {
+			team = match.Team2
+		}
+		announcement.Message = fmt.Sprintf("%s have announced their starting six", team.Name)
+		if revised {
+			announcement.Message = fmt.Sprintf("%s have changed their starting six", team.Name)
+		}
+
+		if _, err := s.saveSquad(tx, match, prev, &matchSquad, SquadEdit{
+			Source: models.SquadSourceLineup,
+			Reason: announcement.Message,
+			By:     adminID(r),
+		}); err != nil {
+			return err
+		}
+		if err := tx.Set(squadRef, squad); err != nil {
+			return err
+		}
+		return tx.Create(s.firestoreClient.Collection("announcements").Doc(announcement.AnnouncementID), announcement)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "announced",
+		"squad":        squad,
+		"announcement": announcement,
+	})
+}
+
+// Admin: Get a team's announced lineups, latest first; ?matchId= narrows to one match
+func (s *Server) getTeamSquads(w http.ResponseWriter, r *http.Request) {
+	teamId := mux.Vars(r)["teamId"]
+
+	ctx := r.Context()
+	q := s.firestoreClient.Collection("squads").Where("teamId", "==", teamId)
+	if matchID := r.URL.Query().Get("matchId"); matchID != "" {
+		q = q.Where("matchId", "==", matchID)
+	}
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	squads := make([]Squad, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&squads[i])
+	}
+	sort.Slice(squads, func(i, j int) bool { return squads[i].AnnouncedAt.After(squads[j].AnnouncedAt) })
+
+	writeJSON(w, http.StatusOK, squads)
+}
+
+// Get a match's announcements, latest first (public endpoint)
+func (s *Server) getMatchAnnouncements(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	docs, err := s.firestoreClient.Collection("announcements").Where("matchId", "==", matchId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	announcements := make([]models.Announcement, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&announcements[i])
+	}
+	sort.Slice(announcements, func(i, j int) bool { return announcements[i].CreatedAt.After(announcements[j].CreatedAt) })
+
+	writeJSON(w, http.StatusOK, announcements)
+}
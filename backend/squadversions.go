@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// How a squad write is recorded in its version
+type SquadEdit struct {
+	Source   string
+	Reason   string
+	By       string // admin ID
+	Override bool   // allow the write after the match locked
+}
+
+// The edit an admin request makes: ?override=true allows it after lock and
+// ?reason= explains it
+func squadEditFrom(r *http.Request, source string) (SquadEdit, error) {
+	params := r.URL.Query()
+	edit := SquadEdit{Source: source, Reason: params.Get("reason"), By: adminID(r)}
+	if raw := params.Get("override"); raw != "" {
+		var err error
+		if edit.Override, err = strconv.ParseBool(raw); err != nil {
+			return SquadEdit{}, errorf(ErrInvalidRequest, "override must be true or false")
+		}
+	}
+	return edit, nil
+}
+
+func (s *Server) matchSquadRef(matchID string) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("matchSquads").Doc(matchID)
+}
+
+func (s *Server) squadVersionRef(matchID string, version int) *firestore.DocumentRef {
+	return s.matchSquadRef(matchID).Collection("versions").Doc(models.SquadVersionID(version))
+}
+
+// A squad locks with its match: when the match is no longer upcoming or its
+// start time has passed
+func squadLocked(match Match, now time.Time) bool {
+	return match.Status != models.MatchUpcoming || (!match.StartTime.IsZero() && match.IsLocked(now))
+}
+
+// Freeze the squad's current version and point the match's contests at it.
+// A squad written before versioning first gets its content stored as version 1.
+func (s *Server) freezeSquad(tx *firestore.Transaction, squad *MatchSquad, contests []*firestore.DocumentSnapshot, now time.Time) error {
+	if squad.Version == 0 {
+		squad.Version = 1
+		baseline := models.SquadVersion{
+			MatchID:   squad.MatchID,
+			Version:   1,
+			Source:    models.SquadSourceLock,
+			Reason:    "squad in force at lock",
+			Changes:   []models.SquadChange{},
+			Squad:     *squad,
+			CreatedAt: now,
+		}
+		if err := tx.Create(s.squadVersionRef(squad.MatchID, 1), baseline); err != nil {
+			return err
+		}
+	}
+	squad.LockedVersion = squad.Version
+	squad.LockedAt = now
+	for _, doc := range contests {
+		if err := tx.Update(doc.Ref, []firestore.Update{{Path: "squadVersion", Value: squad.LockedVersion}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write next as the match's squad in tx, storing a new version with the diff
+// from prev, which is nil while the match has no squad. Once the match locks
+// the version then in force is frozen and referenced by its contests; later
+// changes need edit.Override and a reason, and record which fantasy teams they
+// touch. Writes that only change live stats, form or pick rates need neither.
+// The transaction's own reads must come before the call. Returns the stored
+// version, or nil when nothing compared changed.
+func (s *Server) saveSquad(tx *firestore.Transaction, match Match, prev, next *MatchSquad, edit SquadEdit) (*models.SquadVersion, error) {
+	now := time.Now().UTC()
+	var base MatchSquad
+	if prev != nil {
+		base = *prev
+		base.MatchID = match.MatchID
+	}
+	locked := squadLocked(match, now)
+	edited := len(models.DiffSquads(base, *next)) > 0
+	if locked && edited {
+		if !edit.Override {
+			return nil, errorf(ErrMatchLocked, "Match squad is locked; pass override=true with a reason to change it")
+		}
+		if strings.TrimSpace(edit.Reason) == "" {
+			return nil, errorf(ErrInvalidRequest, "A reason is required to change a locked match squad")
+		}
+	}
+	freeze := locked && base.LockedVersion == 0
+	var teams []UserTeam
+	var contests []*firestore.DocumentSnapshot
+	if locked && edited {
+		docs, err := tx.Documents(s.firestoreClient.Collection("userTeams").Where("matchId", "==", match.MatchID)).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		teams = make([]UserTeam, len(docs))
+		for i, doc := range docs {
+			doc.DataTo(&teams[i])
+			teams[i].TeamID = doc.Ref.ID
+		}
+	}
+	if freeze {
+		var err error
+		if contests, err = tx.Documents(s.firestoreClient.Collection("contests").Where("matchId", "==", match.MatchID)).GetAll(); err != nil {
+			return nil, err
+		}
+	}
+
+	if freeze && prev != nil {
+		if err := s.freezeSquad(tx, &base, contests, now); err != nil {
+			return nil, err
+		}
+	}
+	next.MatchID = match.MatchID
+	next.UpdatedAt = now
+	version, changed := models.NextSquadVersion(base, next, edit.Source, strings.TrimSpace(edit.Reason), edit.By, now)
+	if changed && locked && prev != nil {
+		impacts := models.ImpactOn(teams, version.Changes, base, *next)
+		version.Override = &models.SquadOverride{
+			LockedVersion: base.LockedVersion,
+			TeamsAffected: len(impacts),
+			Teams:         impacts,
+		}
+	}
+	if changed {
+		if err := tx.Create(s.squadVersionRef(match.MatchID, version.Version), version); err != nil {
+			return nil, err
+		}
+	}
+	if freeze && prev == nil {
+		if err := s.freezeSquad(tx, next, contests, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Set(s.matchSquadRef(match.MatchID), *next); err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, nil
+	}
+	return &version, nil
+}
+
+// Writes for a squad change planned outside a transaction and committed in
+// batches: the new version, if anything compared changed, and the squad's
+// player lists. override records an edit to a locked squad on the version.
+func (s *Server) planSquadVersion(prev MatchSquad, next *MatchSquad, edit SquadEdit, override *models.SquadOverride, now time.Time) []planWrite {
+	next.UpdatedAt = now
+	updates := []firestore.Update{
+		{Path: "team1Players", Value: next.Team1Players},
+		{Path: "team2Players", Value: next.Team2Players},
+		{Path: "updatedAt", Value: now},
+	}
+	ref := s.matchSquadRef(next.MatchID)
+	version, changed := models.NextSquadVersion(prev, next, edit.Source, edit.Reason, edit.By, now)
+	if !changed {
+		return []planWrite{{ref: ref, updates: updates}}
+	}
+	version.Override = override
+	return []planWrite{
+		{ref: s.squadVersionRef(next.MatchID, version.Version), data: version},
+		{ref: ref, updates: append(updates, firestore.Update{Path: "version", Value: next.Version})},
+	}
+}
+
+// A match's squad read in tx, or nil if it has none
+func (s *Server) loadSquadTx(tx *firestore.Transaction, matchID string) (*MatchSquad, error) {
+	doc, err := tx.Get(s.matchSquadRef(matchID))
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var squad MatchSquad
+	doc.DataTo(&squad)
+	return &squad, nil
+}
+
+// Changes a write stored, empty when it stored no version
+func versionChanges(version *models.SquadVersion) []models.SquadChange {
+	if version == nil {
+		return []models.SquadChange{}
+	}
+	return version.Changes
+}
+
+func versionOverride(version *models.SquadVersion) *models.SquadOverride {
+	if version == nil {
+		return nil
+	}
+	return version.Override
+}
+
+// How often the lock sweep runs, and how far back it looks for matches whose
+// start time has passed
+const (
+	lockSweepInterval = time.Minute
+	lockSweepWindow   = 24 * time.Hour
+)
+
+// Start the worker that freezes pick counts and squads as matches reach their
+// start time, before the scorer starts them
+func (s *Server) startLockSweep() {
+	s.runBackground("lock sweep", func(ctx context.Context) {
+		ticker := time.NewTicker(lockSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.lockStartedMatches(ctx, time.Now().UTC())
+			}
+		}
+	})
+}
+
+// Freeze the pick counts and squads of upcoming matches whose start time
+// passed within the sweep window, logging failures for the next sweep to retry
+func (s *Server) lockStartedMatches(ctx context.Context, now time.Time) {
+	docs, err := s.firestoreClient.Collection("matches").
+		Where("status", "==", models.MatchUpcoming).
+		Where("startTime", ">", now.Add(-lockSweepWindow)).
+		Where("startTime", "<=", now).
+		Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("Lock sweep: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		var match Match
+		doc.DataTo(&match)
+		if !match.ArchivedAt.IsZero() {
+			continue
+		}
+		if err := s.lockMatch(ctx, doc.Ref.ID); err != nil {
+			log.Printf("Lock sweep: match %s not locked: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// Freeze a locked match's pick counts, then its squad with the final pick
+// rates, skipping whichever is already frozen
+func (s *Server) lockMatch(ctx context.Context, matchID string) error {
+	counts, err := s.loadPicks(ctx, matchID)
+	if err != nil {
+		return err
+	}
+	if counts.FrozenAt.IsZero() {
+		if _, err := s.freezePicks(ctx, matchID); err != nil {
+			return err
+		}
+	}
+	return s.lockSquad(ctx, matchID)
+}
+
+// Freeze a match's squad once the match is under way, logging failures;
+// a later squad write after lock freezes it too
+func (s *Server) lockSquadOnStart(ctx context.Context, match *Match) {
+	if match.Status == models.MatchUpcoming {
+		return
+	}
+	if err := s.lockSquad(ctx, match.MatchID); err != nil {
+		log.Printf("Squad for match %s not locked: %v", match.MatchID, err)
+	}
+}
+
+// Freeze the version of a match's squad in force now, unless already frozen
+func (s *Server) lockSquad(ctx context.Context, matchID string) error {
+	ref := s.matchSquadRef(matchID)
+	return s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		squad, err := s.loadSquadTx(tx, matchID)
+		if err != nil || squad == nil || squad.LockedVersion != 0 {
+			return err
+		}
+		squad.MatchID = matchID
+		contests, err := tx.Documents(s.firestoreClient.Collection("contests").Where("matchId", "==", matchID)).GetAll()
+		if err != nil {
+			return err
+		}
+		if err := s.freezeSquad(tx, squad, contests, time.Now().UTC()); err != nil {
+			return err
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "version", Value: squad.Version},
+			{Path: "lockedVersion", Value: squad.LockedVersion},
+			{Path: "lockedAt", Value: squad.LockedAt},
+		})
+	})
+}
+
+// Admin: List a match squad's versions, latest first, each with its changes
+// from the one before
+func (s *Server) getSquadVersions(w http.ResponseWriter, r *http.Request) {
+	matchId := mux.Vars(r)["matchId"]
+
+	ctx := r.Context()
+	docs, err := s.matchSquadRef(matchId).Collection("versions").OrderBy("version", firestore.Desc).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	versions := make([]models.SquadVersion, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&versions[i])
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// Get one version of a match squad, such as the one a contest is played on
+// (public endpoint)
+func (s *Server) getSquadVersion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchId := vars["matchId"]
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		writeError(w, r, errorf(ErrInvalidRequest, "version must be a positive integer"))
+		return
+	}
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.squadVersionRef(matchId, version), "Squad version")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var v models.SquadVersion
+	doc.DataTo(&v)
+	v.Override = nil // names users' teams; admins see it in the version list
+
+	writeJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"fantasy-volleyball-backend/models"
+)
+
+func (s *Server) standingsRef(leagueID string) *firestore.DocumentRef {
+	return s.firestoreClient.Collection("standings").Doc(leagueID)
+}
+
+// League's points scheme and its live teams' info, for building the table.
+// Archived teams only appear through the results they already have.
+func (s *Server) standingsInputs(ctx context.Context, leagueID string) (models.PointsScheme, map[string]TeamInfo, error) {
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("leagues").Doc(leagueID), "League")
+	if err != nil {
+		return models.PointsScheme{}, nil, err
+	}
+	var league League
+	doc.DataTo(&league)
+
+	teamDocs, err := s.firestoreClient.Collection("teams").Where("leagueId", "==", leagueID).Documents(ctx).GetAll()
+	if err != nil {
+		return models.PointsScheme{}, nil, err
+	}
+	teams := make(map[string]TeamInfo, len(teamDocs))
+	for _, doc := range teamDocs {
+		var team Team
+		doc.DataTo(&team)
+		if !team.ArchivedAt.IsZero() {
+			continue
+		}
+		teams[doc.Ref.ID] = team.Info()
+	}
+	return league.Scheme(), teams, nil
+}
+
+// Change a league's stored results with mutate and rebuild its table, in a
+// transaction so concurrent match completions don't lose each other's results
+func (s *Server) writeStandings(ctx context.Context, leagueID string, mutate func(results map[string]models.MatchResult)) (*models.Standings, error) {
+	scheme, teams, err := s.standingsInputs(ctx, leagueID)
+	if err != nil {
+		return nil, err
+	}
+
+	var standings models.Standings
+	ref := s.standingsRef(leagueID)
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		standings = models.Standings{}
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			doc.DataTo(&standings)
+		}
+		if standings.Results == nil {
+			standings.Results = map[string]models.MatchResult{}
+		}
+		mutate(standings.Results)
+
+		standings.LeagueID = leagueID
+		standings.PointsScheme = scheme
+		standings.Rows = models.BuildStandings(standings.Results, scheme, teams)
+		standings.UpdatedAt = time.Now().UTC()
+		return tx.Set(ref, standings)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &standings, nil
+}
+
+// Add a completed match's result to its league's table, replacing any earlier
+// result for it, or withdraw the result of a match that is no longer completed.
+// Playoff and cancelled matches are not part of the table.
+func (s *Server) applyMatchResult(ctx context.Context, match *Match) error {
+	if match.LeagueID == "" {
+		return nil
+	}
+	_, err := s.writeStandings(ctx, match.LeagueID, func(results map[string]models.MatchResult) {
+		if match.Status == models.MatchCompleted && match.LeagueStage() {
+			results[match.MatchID] = match.Result()
+		} else {
+			delete(results, match.MatchID)
+		}
+	})
+	return err
+}
+
+// Keep pick counts, the squad lock, the standings and playoff brackets in
+// step after a match's scoreboard was saved. The score is already stored, so
+// failures are logged rather than failing the request; a recount, rebuild or
+// bracket advance puts things right.
+func (s *Server) scoreboardSaved(ctx context.Context, match *Match, wasCompleted bool) {
+	s.freezePicksOnStart(ctx, match)
+	s.lockSquadOnStart(ctx, match)
+	if match.Status != models.MatchCompleted && !wasCompleted {
+		return
+	}
+	if err := s.applyMatchResult(ctx, match); err != nil {
+		log.Printf("Standings for league %s not updated after match %s: %v", match.LeagueID, match.MatchID, err)
+	}
+	if match.LeagueID != "" {
+		s.advanceLeagueBrackets(ctx, match.LeagueID)
+	}
+}
+
+// Get a league's standings table (public endpoint)
+func (s *Server) getLeagueStandings(w http.ResponseWriter, r *http.Request) {
+	leagueId := mux.Vars(r)["leagueId"]
+
+	ctx := r.Context()
+	doc, err := s.standingsRef(leagueId).Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		writeError(w, r, err)
+		return
+	}
+	if err == nil {
+		var standings models.Standings
+		doc.DataTo(&standings)
+		writeJSON(w, http.StatusOK, standings)
+		return
+	}
+
+	// No match completed yet: every team on zero
+	scheme, teams, err := s.standingsInputs(ctx, leagueId)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.Standings{
+		LeagueID:     leagueId,
+		PointsScheme: scheme,
+		Rows:         models.BuildStandings(nil, scheme, teams),
+	})
+}
+
+// Admin: Rebuild a league's standings from all of its completed league-stage
+// matches that weren't cancelled
+func (s *Server) rebuildLeagueStandings(w http.ResponseWriter, r *http.Request) {
+	leagueId := mux.Vars(r)["leagueId"]
+
+	ctx := r.Context()
+	docs, err := s.firestoreClient.Collection("matches").
+		Where("leagueId", "==", leagueId).
+		Where("status", "==", models.MatchCompleted).
+		Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rebuilt := map[string]models.MatchResult{}
+	for _, doc := range docs {
+		var match Match
+		doc.DataTo(&match)
+		if match.WinnerTeamID == "" {
+			continue // marked completed before the scoreboard existed
+		}
+		if !match.LeagueStage() {
+			continue
+		}
+		rebuilt[match.MatchID] = match.Result()
+	}
+
+	standings, err := s.writeStandings(ctx, leagueId, func(results map[string]models.MatchResult) {
+		for matchID := range results {
+			delete(results, matchID)
+		}
+		for matchID, result := range rebuilt {
+			results[matchID] = result
+		}
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, standings)
+}
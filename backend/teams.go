@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Load the two teams of a new match, checking they are different live teams
+// of the league
+func (s *Server) loadMatchTeams(ctx context.Context, leagueID, team1ID, team2ID string) (Team, Team, error) {
+	var problems []string
+	if leagueID == "" {
+		problems = append(problems, "leagueId is required")
+	}
+	if team1ID == "" {
+		problems = append(problems, "team1Id is required")
+	}
+	if team2ID == "" {
+		problems = append(problems, "team2Id is required")
+	}
+	if team1ID != "" && team1ID == team2ID {
+		problems = append(problems, "team1Id and team2Id must differ")
+	}
+	if len(problems) > 0 {
+		return Team{}, Team{}, errorWithDetails(ErrInvalidRequest, problems, "Invalid match teams")
+	}
+
+	teamsRef := s.firestoreClient.Collection("teams")
+	docs, err := s.firestoreClient.GetAll(ctx, []*firestore.DocumentRef{teamsRef.Doc(team1ID), teamsRef.Doc(team2ID)})
+	if err != nil {
+		return Team{}, Team{}, err
+	}
+	teams := make([]Team, len(docs))
+	for i, doc := range docs {
+		field := []string{"team1Id", "team2Id"}[i]
+		if !doc.Exists() {
+			problems = append(problems, field+": team "+doc.Ref.ID+" not found")
+			continue
+		}
+		doc.DataTo(&teams[i])
+		teams[i].TeamID = doc.Ref.ID
+		switch {
+		case !teams[i].ArchivedAt.IsZero():
+			problems = append(problems, field+": team "+doc.Ref.ID+" is archived")
+		case teams[i].LeagueID != leagueID:
+			problems = append(problems, field+": team "+doc.Ref.ID+" is not in league "+leagueID)
+		}
+	}
+	if len(problems) > 0 {
+		return Team{}, Team{}, errorWithDetails(ErrInvalidRequest, problems, "Invalid match teams")
+	}
+	return teams[0], teams[1], nil
+}
+
+// Rewrite the team's TeamInfo on its matches that have not started, which
+// display it. Played matches keep the name and logo they were played under.
+func (s *Server) syncTeamInfo(ctx context.Context, teamID string, info TeamInfo) (int, error) {
+	q, _ := filterMatchesByTeam(ctx, s, s.firestoreClient.Collection("matches").Query, teamID)
+	docs, err := q.Where("status", "==", models.MatchUpcoming).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	var refs []*firestore.DocumentRef
+	var updates [][]firestore.Update
+	for _, doc := range docs {
+		var match Match
+		doc.DataTo(&match)
+		if !match.ArchivedAt.IsZero() {
+			continue
+		}
+		var u []firestore.Update
+		if match.Team1ID == teamID && match.Team1 != info {
+			u = append(u, firestore.Update{Path: "team1", Value: info})
+		}
+		if match.Team2ID == teamID && match.Team2 != info {
+			u = append(u, firestore.Update{Path: "team2", Value: info})
+		}
+		if len(u) > 0 {
+			refs = append(refs, doc.Ref)
+			updates = append(updates, u)
+		}
+	}
+
+	for start := 0; start < len(refs); start += maxBatchWrites {
+		batch := s.firestoreClient.Batch()
+		for i := start; i < min(start+maxBatchWrites, len(refs)); i++ {
+			batch.Update(refs[i], updates[i])
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return len(refs), nil
+}
+
+// After a team's display fields change. The team is already saved, so a
+// failure is logged; the sync endpoint can be run again.
+func (s *Server) teamInfoChanged(ctx context.Context, teamID string) int {
+	doc, err := s.firestoreClient.Collection("teams").Doc(teamID).Get(ctx)
+	if err != nil {
+		log.Printf("Matches of team %s not synced: %v", teamID, err)
+		return 0
+	}
+	var team Team
+	doc.DataTo(&team)
+	n, err := s.syncTeamInfo(ctx, teamID, team.Info())
+	if err != nil {
+		log.Printf("Matches of team %s not synced: %v", teamID, err)
+	}
+	return n
+}
+
+// Admin: Rewrite a team's name, code and logo on its upcoming matches
+func (s *Server) syncTeamMatches(w http.ResponseWriter, r *http.Request) {
+	teamId := mux.Vars(r)["teamId"]
+
+	ctx := r.Context()
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("teams").Doc(teamId), "Team")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var team Team
+	doc.DataTo(&team)
+
+	n, err := s.syncTeamInfo(ctx, teamId, team.Info())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"teamId": teamId, "matchesUpdated": n})
+}
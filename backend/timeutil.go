@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Timezone assumed for leagues that don't set one
+const defaultLeagueTimezone = models.DefaultLeagueTimezone
+
+// Parse a client- or legacy-supplied time string; see models.ParseTimestamp
+func parseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	t, err := models.ParseTimestamp(value, loc)
+	if err != nil {
+		return time.Time{}, errorf(ErrInvalidRequest, "%v", err)
+	}
+	return t, nil
+}
+
+// Resolve an IANA timezone name, falling back to the default league timezone
+func loadLeagueLocation(name string) (*time.Location, error) {
+	loc, err := models.LoadLeagueLocation(name)
+	if err != nil {
+		return nil, errorf(ErrInvalidRequest, "%v", err)
+	}
+	return loc, nil
+}
+
+// Timezone of a league, used to interpret match times entered without an
+// offset. Only the timezone field is read, so a league still holding legacy
+// string dates, which don't decode, resolves too.
+func (s *Server) leagueLocation(ctx context.Context, leagueID string) (*time.Location, error) {
+	if leagueID == "" {
+		return loadLeagueLocation("")
+	}
+	doc, err := getDocument(ctx, s.firestoreClient.Collection("leagues").Doc(leagueID), "League")
+	if err != nil {
+		return nil, err
+	}
+	name, _ := doc.Data()["timezone"].(string)
+	return loadLeagueLocation(name)
+}
+
+// Reject changes to fantasy teams and contest entries once the match has
+// started or was cancelled
+func checkMatchOpen(match Match, action string) error {
+	if !match.ArchivedAt.IsZero() {
+		return errorf(ErrMatchLocked, "Cannot %s for cancelled matches", action)
+	}
+	if match.StartTime.IsZero() {
+		return errorf(ErrMatchLocked, "Match start time not set")
+	}
+	if match.IsLocked(time.Now()) {
+		return errorf(ErrMatchLocked, "Cannot %s for matches that have already started", action)
+	}
+	return nil
+}
+
+// Parse an optional time field from a request, leaving it zero when absent
+func parseOptionalTimestamp(field, value string, loc *time.Location) (time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}, nil
+	}
+	t, err := parseTimestamp(value, loc)
+	if err != nil {
+		return time.Time{}, errorf(ErrInvalidRequest, "%s: %v", field, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+
+	"fantasy-volleyball-backend/models"
+)
+
+// Default association ID, as the squad importer writes them; taken IDs get
+// the start date appended
+func associationID(tp TeamPlayer, taken []TeamPlayer) string {
+	id := fmt.Sprintf("assoc_%s_%s_%s", tp.PlayerID, tp.TeamID, tp.Season)
+	for _, other := range taken {
+		if other.AssociationID == id {
+			return fmt.Sprintf("%s_%s", id, tp.StartDate.Format("20060102"))
+		}
+	}
+	return id
+}
+
+// A player's associations and a team's, read in the transaction so the
+// checks hold when the writes land
+func (s *Server) associationSpells(tx *firestore.Transaction, playerID, teamID string) ([]TeamPlayer, []TeamPlayer, error) {
+	read := func(field, value string) ([]TeamPlayer, error) {
+		docs, err := tx.Documents(s.firestoreClient.Collection("teamPlayers").Where(field, "==", value)).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		spells := make([]TeamPlayer, len(docs))
+		for i, doc := range docs {
+			doc.DataTo(&spells[i])
+			spells[i].AssociationID = doc.Ref.ID
+		}
+		return spells, nil
+	}
+	playerSpells, err := read("playerId", playerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	teamSpells, err := read("teamId", teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return playerSpells, teamSpells, nil
+}
+
+// A player's or team's associations (field is playerId or teamId) in force
+// at t. Stored isActive flags go stale as spells start and end, so the dates
+// decide.
+func (s *Server) associationsOn(ctx context.Context, field, id string, t time.Time) ([]TeamPlayer, error) {
+	docs, err := s.firestoreClient.Collection("teamPlayers").Where(field, "==", id).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	associations := []TeamPlayer{}
+	for _, doc := range docs {
+		var tp TeamPlayer
+		doc.DataTo(&tp)
+		if tp.ValidOn(t) {
+			associations = append(associations, tp)
+		}
+	}
+	return associations, nil
+}
+
+// Refuse an association whose spell overlaps another of the player's or
+// whose jersey clashes within the team and season
+func checkAssociation(tp TeamPlayer, playerSpells, teamSpells []TeamPlayer) error {
+	if problems := models.AssociationProblems(tp, playerSpells, teamSpells); len(problems) > 0 {
+		return errorWithDetails(ErrConflict, problems, "Association for player %s at team %s clashes with existing ones", tp.PlayerID, tp.TeamID)
+	}
+	return nil
+}
+
+// Association as submitted by the admin portal; startDate and endDate may be
+// dates without a time, read in the team's league timezone
+type TeamPlayerRequest struct {
+	TeamPlayer
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+}
+
+// Admin: Create a team-player association. The spell starts now unless
+// startDate says otherwise, isActive follows the dates, and it is refused if
+// it overlaps another spell of the player or a teammate's jersey.
+func (s *Server) createTeamPlayer(w http.ResponseWriter, r *http.Request) {
+	var req TeamPlayerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	association := req.TeamPlayer
+
+	ctx := r.Context()
+	teamDoc, err := getDocument(ctx, s.firestoreClient.Collection("teams").Doc(association.TeamID), "Team")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var team Team
+	teamDoc.DataTo(&team)
+	if association.LeagueID == "" {
+		association.LeagueID = team.LeagueID
+	}
+	loc, err := s.leagueLocation(ctx, association.LeagueID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if association.StartDate, err = parseOptionalTimestamp("startDate", req.StartDate, loc); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if association.EndDate, err = parseOptionalTimestamp("endDate", req.EndDate, loc); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	if association.StartDate.IsZero() {
+		association.StartDate = now
+	}
+	if association.Role == "" {
+		association.Role = "player"
+	}
+	association.IsActive = association.ValidOn(now)
+	association.CreatedAt = now
+	if problems := models.AssociationProblems(association, nil, nil); len(problems) > 0 {
+		writeError(w, r, errorWithDetails(ErrInvalidRequest, problems, "Invalid association"))
+		return
+	}
+	if _, err := s.loadPlayer(ctx, association.PlayerID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		playerSpells, teamSpells, err := s.associationSpells(tx, association.PlayerID, association.TeamID)
+		if err != nil {
+			return err
+		}
+		if association.AssociationID == "" {
+			association.AssociationID = associationID(association, playerSpells)
+		}
+		if err := checkAssociation(association, playerSpells, teamSpells); err != nil {
+			return err
+		}
+		return tx.Create(s.firestoreClient.Collection("teamPlayers").Doc(association.AssociationID), association)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "created", "association": association})
+}
+
+type TransferRequest struct {
+	PlayerID          string `json:"playerId"`
+	ToTeamID          string `json:"toTeamId"`
+	FromAssociationID string `json:"fromAssociationId"` // defaults to the player's spell on the date
+	Season            string `json:"season"`            // defaults to the old spell's
+	JerseyNumber      int    `json:"jerseyNumber"`
+	Role              string `json:"role"`
+	Date              string `json:"date"` // defaults to now; may be backdated, not in the future
+	Note              string `json:"note"`
+}
+
+type TransferResult struct {
+	Transfer models.Transfer `json:"transfer"`
+	Closed   *TeamPlayer     `json:"closed"` // null when the player had no team
+	Opened   TeamPlayer      `json:"opened"`
+}
+
+// Admin: Transfer a player to another team. In one transaction the spell at
+// the old team ends on the date, one at the new team starts on it and the
+// move is recorded in transfers.
+func (s *Server) transferPlayer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, errorf(ErrInvalidRequest, "Invalid request body: %v", err))
+		return
+	}
+	if req.PlayerID == "" || req.ToTeamID == "" {
+		writeError(w, r, errorf(ErrInvalidRequest, "playerId and toTeamId are required"))
+		return
+	}
+
+	ctx := r.Context()
+	player, err := s.loadPlayer(ctx, req.PlayerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !player.ArchivedAt.IsZero() {
+		writeError(w, r, errorf(ErrInvalidRequest, "Player %s is archived", req.PlayerID))
+		return
+	}
+	teamDoc, err := getDocument(ctx, s.firestoreClient.Collection("teams").Doc(req.ToTeamID), "Team")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var team Team
+	teamDoc.DataTo(&team)
+	if !team.ArchivedAt.IsZero() {
+		writeError(w, r, errorf(ErrInvalidRequest, "Team %s is archived", req.ToTeamID))
+		return
+	}
+
+	now := time.Now().UTC()
+	loc, err := s.leagueLocation(ctx, team.LeagueID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	date, err := parseOptionalTimestamp("date", req.Date, loc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if date.IsZero() {
+		date = now
+	}
+	date = date.UTC()
+	if date.After(now) {
+		writeError(w, r, errorf(ErrInvalidRequest, "date cannot be in the future"))
+		return
+	}
+
+	var result TransferResult
+	teamPlayers := s.firestoreClient.Collection("teamPlayers")
+	err = s.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		result = TransferResult{}
+		playerSpells, teamSpells, err := s.associationSpells(tx, req.PlayerID, req.ToTeamID)
+		if err != nil {
+			return err
+		}
+
+		// The spell being closed: the one named, else the player's spell on the date
+		var from *TeamPlayer
+		var current []string
+		for i := range playerSpells {
+			spell := &playerSpells[i]
+			if req.FromAssociationID != "" && spell.AssociationID == req.FromAssociationID {
+				from = spell
+			}
+			if spell.ValidOn(date) {
+				current = append(current, spell.AssociationID)
+			}
+		}
+		switch {
+		case req.FromAssociationID != "" && from == nil:
+			return errorf(ErrNotFound, "Association %s of player %s not found", req.FromAssociationID, req.PlayerID)
+		case req.FromAssociationID == "" && len(current) > 1:
+			return errorWithDetails(ErrConflict, current, "Player %s has several spells on %s; name the one to close in fromAssociationId", req.PlayerID, date.Format(time.DateOnly))
+		case req.FromAssociationID == "" && len(current) == 1:
+			for i := range playerSpells {
+				if playerSpells[i].AssociationID == current[0] {
+					from = &playerSpells[i]
+				}
+			}
+		}
+
+		opened := TeamPlayer{
+			PlayerID:     req.PlayerID,
+			TeamID:       req.ToTeamID,
+			LeagueID:     team.LeagueID,
+			Season:       req.Season,
+			JerseyNumber: req.JerseyNumber,
+			Role:         req.Role,
+			StartDate:    date,
+			IsActive:     true,
+			CreatedAt:    now,
+		}
+		if opened.Role == "" {
+			opened.Role = "player"
+		}
+		if from != nil {
+			if from.TeamID == req.ToTeamID {
+				return errorf(ErrInvalidRequest, "Player %s is already at team %s", req.PlayerID, req.ToTeamID)
+			}
+			if !from.ValidOn(date) {
+				return errorf(ErrInvalidRequest, "Association %s does not cover %s", from.AssociationID, date.Format(time.DateOnly))
+			}
+			if !date.After(from.StartDate) {
+				return errorf(ErrInvalidRequest, "date must be after the old spell started on %s", from.StartDate.Format(time.DateOnly))
+			}
+			if opened.Season == "" {
+				opened.Season = from.Season
+			}
+			closed := *from
+			closed.EndDate = date
+			closed.IsActive = false
+			*from = closed // checked against the closed spell below
+			result.Closed = &closed
+		}
+		if opened.Season == "" {
+			return errorf(ErrInvalidRequest, "season is required when the player has no current team")
+		}
+		opened.AssociationID = associationID(opened, playerSpells)
+		if err := checkAssociation(opened, playerSpells, teamSpells); err != nil {
+			return err
+		}
+		result.Opened = opened
+
+		transferRef := s.firestoreClient.Collection("transfers").Doc(fmt.Sprintf("transfer_%s_%d", req.PlayerID, now.UnixNano()))
+		result.Transfer = models.Transfer{
+			TransferID:      transferRef.ID,
+			PlayerID:        req.PlayerID,
+			ToTeamID:        req.ToTeamID,
+			ToAssociationID: opened.AssociationID,
+			LeagueID:        team.LeagueID,
+			Season:          opened.Season,
+			JerseyNumber:    opened.JerseyNumber,
+			Date:            date,
+			Note:            req.Note,
+			CreatedBy:       adminID(r),
+			CreatedAt:       now,
+		}
+		if result.Closed != nil {
+			result.Transfer.FromTeamID = result.Closed.TeamID
+			result.Transfer.FromAssociationID = result.Closed.AssociationID
+			if err := tx.Update(teamPlayers.Doc(result.Closed.AssociationID), []firestore.Update{
+				{Path: "endDate", Value: date},
+				{Path: "isActive", Value: false},
+			}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(teamPlayers.Doc(opened.AssociationID), opened); err != nil {
+			return err
+		}
+		return tx.Create(transferRef, result.Transfer)
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Admin: List transfers, latest first; ?playerId= or ?teamId= (either side)
+// narrows them
+func (s *Server) getTransfers(w http.ResponseWriter, r *http.Request) {
+	q := s.firestoreClient.Collection("transfers").Query
+	if playerID := r.URL.Query().Get("playerId"); playerID != "" {
+		q = q.Where("playerId", "==", playerID)
+	}
+	if teamID := r.URL.Query().Get("teamId"); teamID != "" {
+		q = q.WhereEntity(firestore.OrFilter{Filters: []firestore.EntityFilter{
+			firestore.PropertyFilter{Path: "fromTeamId", Operator: "==", Value: teamID},
+			firestore.PropertyFilter{Path: "toTeamId", Operator: "==", Value: teamID},
+		}})
+	}
+	transfers, err := s.loadTransfers(r.Context(), q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+func (s *Server) loadTransfers(ctx context.Context, q firestore.Query) ([]models.Transfer, error) {
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	transfers := make([]models.Transfer, len(docs))
+	for i, doc := range docs {
+		doc.DataTo(&transfers[i])
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].Date.After(transfers[j].Date) })
+	return transfers, nil
+}
+
+// One spell of a player at a team
+type PlayerSpell struct {
+	TeamPlayer
+	Team TeamInfo `json:"team"`
+}
+
+// Get a player's team history: every spell, latest first, and their transfers
+// (public endpoint)
+func (s *Server) getPlayerTeams(w http.ResponseWriter, r *http.Request) {
+	playerId := mux.Vars(r)["playerId"]
+
+	ctx := r.Context()
+	if _, err := s.loadPlayer(ctx, playerId); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	docs, err := s.firestoreClient.Collection("teamPlayers").Where("playerId", "==", playerId).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	spells := make([]PlayerSpell, len(docs))
+	var teamRefs []*firestore.DocumentRef
+	for i, doc := range docs {
+		doc.DataTo(&spells[i].TeamPlayer)
+		teamRefs = append(teamRefs, s.firestoreClient.Collection("teams").Doc(spells[i].TeamID))
+	}
+	if len(teamRefs) > 0 {
+		teamDocs, err := s.firestoreClient.GetAll(ctx, teamRefs)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		for i, doc := range teamDocs {
+			if doc.Exists() {
+				var team Team
+				doc.DataTo(&team)
+				spells[i].Team = team.Info()
+			}
+		}
+	}
+	sort.Slice(spells, func(i, j int) bool { return spells[i].StartDate.After(spells[j].StartDate) })
+
+	transfers, err := s.loadTransfers(ctx, s.firestoreClient.Collection("transfers").Where("playerId", "==", playerId))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"playerId":  playerId,
+		"spells":    spells,
+		"transfers": transfers,
+	})
+}
@@ -33,7 +33,7 @@ fi
 
 echo ""
 echo "🧪 Running basic syntax check..."
-go build -o main main.go
+go build -o main .
 if [ $? -ne 0 ]; then
     echo "❌ Error: Go build failed"
     exit 1